@@ -4,6 +4,7 @@ import (
         "context"
         "os"
         "os/signal"
+        "strings"
         "syscall"
         "time"
 
@@ -15,7 +16,7 @@ import (
         "github.com/mariasu11/logstreamApp/internal/config"
         "github.com/mariasu11/logstreamApp/internal/processor"
         "github.com/mariasu11/logstreamApp/internal/storage"
-        "github.com/mariasu11/logstreamApp/pkg/worker"
+        "github.com/mariasu11/logstreamApp/pkg/plugin"
 )
 
 var (
@@ -81,15 +82,83 @@ func runCollect(cmd *cobra.Command, args []string) {
         }
 
         // Create worker pool
-        wp := worker.NewPool(cfg.Collect.Workers)
+        wp, err := cfg.Collect.NewPool()
+        if err != nil {
+                logger.Error("Invalid worker pool settings", "error", err)
+                os.Exit(1)
+        }
+        if strings.EqualFold(cfg.Collect.Overflow, "drop") {
+                logger.Warn("Entries are dropped when the work queue is full, see logstream_work_items_dropped_total")
+        }
+        if stats := wp.Metrics(); stats["max_workers"] != stats["min_workers"] {
+                logger.Info("Autoscaling workers", "min", stats["min_workers"], "max", stats["max_workers"])
+        }
+
+        // Load plugins used by the pipeline, and the enabled input and output plugins
+        var registry *plugin.Registry
+        if cfg.NeedsPlugins() || len(cfg.Plugins.Enabled) > 0 {
+                registry = plugin.NewRegistry(logger.Named("plugins"))
+                if err := registry.LoadPlugins(cfg.Plugins.Directory, cfg.Plugins.Enabled); err != nil {
+                        logger.Error("Failed to load plugins", "directory", cfg.Plugins.Directory, "error", err)
+                        os.Exit(1)
+                }
+                defer registry.ClosePlugins()
+        }
+
+        // Create processor with the configured pipeline, dead-letter capture, routing,
+        // enrichment and redaction
+        pipeline, err := cfg.NewPipeline(store, wp, registry)
+        if err != nil {
+                logger.Error("Failed to build processing pipeline", "error", err)
+                os.Exit(1)
+        }
+        proc := pipeline.Processor
+        if len(cfg.Pipeline) > 0 {
+                logger.Info("Processing pipeline configured", "stages", len(cfg.Pipeline))
+        }
+        if registry != nil {
+                for _, output := range registry.OutputPlugins() {
+                        logger.Info("Sending processed entries to output plugin", "plugin", output.Name())
+                }
+        }
+        if cfg.Collect.OrderBy != "" {
+                logger.Info("Keeping entries in order per key", "key", cfg.Collect.OrderBy)
+        }
+        if pipeline.DeadLetter != nil {
+                logger.Info("Capturing unparsed lines", "type", cfg.Collect.DeadLetter.Type, "path", cfg.Collect.DeadLetter.Path)
+        }
+        if cfg.HasRouting() {
+                logger.Info("Routing processed entries", "routes", len(cfg.Routing.Routes), "outputs", len(cfg.Outputs))
+        }
+        for _, db := range pipeline.GeoIP {
+                dbType, built := db.Metadata()
+                logger.Info("Loaded GeoIP database", "path", db.Path(), "type", dbType, "built", built)
+        }
+        for _, table := range pipeline.Lookups {
+                logger.Info("Loaded lookup table", "path", table.Path(), "keys", table.KeyColumns(), "rows", table.Len())
+        }
+        if len(cfg.Transform.MaskFields) > 0 {
+                logger.Info("Redacting sensitive data", "rules", len(cfg.Transform.MaskFields))
+        }
 
-        // Create processor
-        proc := processor.NewProcessor(store, wp)
+        // Spool collected batches on disk, so bursts are absorbed and survive restarts
+        var ingest processor.Processor = proc
+        var spool *processor.SpoolProcessor
+        if cfg.Collect.Spool.Enabled() {
+                spoolQueue, err := cfg.Collect.Spool.Open()
+                if err != nil {
+                        logger.Error("Failed to open spool", "path", cfg.Collect.Spool.Path, "error", err)
+                        os.Exit(1)
+                }
+                spool = processor.NewSpoolProcessor(proc, spoolQueue)
+                ingest = spool
+                logger.Info("Spooling collected batches", "path", cfg.Collect.Spool.Path, "replaying", spoolQueue.Len())
+        }
 
         // Set up collectors based on configuration
         collectors := []collector.Collector{}
         for _, src := range cfg.Collect.Sources {
-                coll, err := collector.NewCollector(src, proc)
+                coll, err := collector.NewCollector(src, ingest)
                 if err != nil {
                         logger.Error("Failed to initialize collector", "source", src, "error", err)
                         continue
@@ -97,6 +166,22 @@ func runCollect(cmd *cobra.Command, args []string) {
                 collectors = append(collectors, coll)
         }
 
+        // Run input plugins alongside the collectors
+        if registry != nil {
+                inputs, err := cfg.PluginInputs(registry)
+                if err != nil {
+                        logger.Error("Failed to set up input plugins", "error", err)
+                        os.Exit(1)
+                }
+                for _, input := range inputs {
+                        if _, ok := input.(plugin.EmittingInputPlugin); !ok {
+                                logger.Warn("Input plugin can't hand entries to the pipeline", "plugin", input.Name())
+                        }
+                        collectors = append(collectors, collector.NewPluginCollector(input, ingest))
+                        logger.Info("Collecting from input plugin", "plugin", input.Name())
+                }
+        }
+
         if len(collectors) == 0 {
                 logger.Error("No valid collectors configured")
                 os.Exit(1)
@@ -114,6 +199,14 @@ func runCollect(cmd *cobra.Command, args []string) {
         // Start the worker pool
         wp.Start(ctx)
 
+        // Hand spooled batches, first those left by the previous run, to the workers
+        if spool != nil {
+                spool.Start(ctx)
+        }
+
+        // Release entries held back by stages such as collapsing deduplication
+        proc.Start(ctx)
+
         // Wait for either error from collectors or context cancellation
         if err := g.Wait(); err != nil && err != context.Canceled {
                 logger.Error("Collector failed", "error", err)
@@ -129,10 +222,23 @@ func runCollect(cmd *cobra.Command, args []string) {
         // Stop the worker pool
         wp.Stop(shutdownCtx)
         
+        // Release the entries stages still hold
+        proc.Flush(shutdownCtx)
+
+        // Unacknowledged batches stay in the spool for the next run
+        if spool != nil {
+                if err := spool.Close(); err != nil {
+                        logger.Error("Error closing spool", "error", err)
+                }
+        }
+
         // Flush storage
         if err := store.Close(); err != nil {
                 logger.Error("Error closing storage", "error", err)
         }
+        if err := pipeline.Close(); err != nil {
+                logger.Error("Error closing pipeline", "error", err)
+        }
 
         logger.Info("LogStream collector shutdown complete")
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+        "bufio"
+        "encoding/json"
+        "fmt"
+        "io"
+        "os"
+        "sort"
+
+        "github.com/spf13/cobra"
+        "github.com/spf13/viper"
+
+        "github.com/mariasu11/logstreamApp/internal/config"
+        "github.com/mariasu11/logstreamApp/pkg/parser"
+)
+
+var (
+        parseCmd = &cobra.Command{
+                Use:   "parse [file]",
+                Short: "Show how sample log lines are parsed",
+                Long: `Parse sample log lines without collecting or storing them. Lines are read from the
+given file, or from stdin when no file is given. For each line the command shows which parser
+claimed it, the resulting log entry and any parse errors, followed by a per-parser summary.`,
+                Args: cobra.MaximumNArgs(1),
+                Run:  runParse,
+        }
+)
+
+func init() {
+        rootCmd.AddCommand(parseCmd)
+
+        // Parse command flags
+        parseCmd.Flags().StringP("parser", "P", "", "Only try this parser or regex rule (e.g. json_zap, cef, apache)")
+        parseCmd.Flags().StringP("source", "s", "", "Source name used for timezone settings")
+        parseCmd.Flags().StringP("output", "o", "text", "Output format (json, text)")
+        parseCmd.Flags().Bool("flatten", false, "Flatten nested JSON objects into dotted keys (e.g. http.request.method)")
+        parseCmd.Flags().String("arrays", "keep", "How flattened JSON arrays are handled (keep, index, join)")
+
+        // Bind flags to viper
+        viper.BindPFlag("json.flatten", parseCmd.Flags().Lookup("flatten"))
+        viper.BindPFlag("json.arrays", parseCmd.Flags().Lookup("arrays"))
+}
+
+func runParse(cmd *cobra.Command, args []string) {
+        parserName, _ := cmd.Flags().GetString("parser")
+        source, _ := cmd.Flags().GetString("source")
+        output, _ := cmd.Flags().GetString("output")
+
+        // Load configuration for timestamp and level settings
+        cfg, err := config.Load()
+        if err != nil {
+                logger.Error("Failed to load configuration", "error", err)
+                os.Exit(1)
+        }
+
+        timestamps, err := cfg.Timestamps.Parser()
+        if err != nil {
+                logger.Error("Invalid timestamp settings", "error", err)
+                os.Exit(1)
+        }
+        levels, err := cfg.Levels.Normalizer()
+        if err != nil {
+                logger.Error("Invalid level normalization settings", "error", err)
+                os.Exit(1)
+        }
+
+        jsonOptions, err := cfg.JSON.Options()
+        if err != nil {
+                logger.Error("Invalid JSON settings", "error", err)
+                os.Exit(1)
+        }
+
+        parsers, err := parser.SelectParsers(parser.NewDefaultParsers(timestamps, jsonOptions), parserName)
+        if err != nil {
+                logger.Error("Failed to select parser", "error", err)
+                os.Exit(1)
+        }
+
+        // Read sample lines from the file or stdin
+        var input io.Reader = os.Stdin
+        if len(args) == 1 {
+                file, err := os.Open(args[0])
+                if err != nil {
+                        logger.Error("Failed to open input", "file", args[0], "error", err)
+                        os.Exit(1)
+                }
+                defer file.Close()
+                input = file
+        }
+
+        var results []*parser.SampleResult
+        scanner := bufio.NewScanner(input)
+        scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+        for scanner.Scan() {
+                line := scanner.Text()
+                if line == "" {
+                        continue
+                }
+                result := parser.ParseSample(parsers, source, line)
+                levels.NormalizeEntry(result.Entry)
+                results = append(results, result)
+        }
+        if err := scanner.Err(); err != nil {
+                logger.Error("Failed to read input", "error", err)
+                os.Exit(1)
+        }
+
+        summary := parser.SummarizeSamples(results)
+
+        switch output {
+        case "json":
+                encoder := json.NewEncoder(os.Stdout)
+                encoder.SetIndent("", "  ")
+                if err := encoder.Encode(map[string]interface{}{"results": results, "summary": summary}); err != nil {
+                        logger.Error("Failed to encode results as JSON", "error", err)
+                        os.Exit(1)
+                }
+        case "text":
+                outputParseText(results, summary)
+        default:
+                logger.Error("Unknown output format", "format", output)
+                os.Exit(1)
+        }
+}
+
+func outputParseText(results []*parser.SampleResult, summary []parser.SampleMatch) {
+        if len(results) == 0 {
+                fmt.Println("No lines to parse")
+                return
+        }
+
+        for i, result := range results {
+                matched := result.Parser
+                if matched == "" {
+                        matched = parser.UnparsedSample
+                }
+
+                fmt.Printf("[%d] %s\n", i+1, result.Line)
+                fmt.Printf("    Parser: %s\n", matched)
+                for _, attempt := range result.Attempts {
+                        if attempt.Error != "" {
+                                fmt.Printf("    Error (%s): %s\n", attempt.Parser, attempt.Error)
+                        }
+                }
+
+                entry := result.Entry
+                fmt.Printf("    Timestamp: %s", entry.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"))
+                if !entry.TimestampParsed() {
+                        fmt.Print(" (not parsed, ingest time)")
+                }
+                fmt.Println()
+                fmt.Printf("    Source: %s\n", entry.Source)
+                fmt.Printf("    Level: %s\n", entry.Level)
+                fmt.Printf("    Message: %s\n", entry.Message)
+                if len(entry.Fields) > 0 {
+                        fmt.Println("    Fields:")
+                        keys := make([]string, 0, len(entry.Fields))
+                        for k := range entry.Fields {
+                                keys = append(keys, k)
+                        }
+                        sort.Strings(keys)
+                        for _, k := range keys {
+                                fmt.Printf("      %s: %v\n", k, entry.Fields[k])
+                        }
+                }
+                fmt.Println()
+        }
+
+        fmt.Printf("Parsed %d lines:\n", len(results))
+        for _, match := range summary {
+                fmt.Printf("  %-20s %d\n", match.Parser, match.Lines)
+        }
+}
@@ -13,6 +13,7 @@ import (
         "github.com/mariasu11/logstreamApp/internal/api"
         "github.com/mariasu11/logstreamApp/internal/config"
         "github.com/mariasu11/logstreamApp/internal/storage"
+        "github.com/mariasu11/logstreamApp/pkg/plugin"
 )
 
 var (
@@ -77,8 +78,39 @@ func runServe(cmd *cobra.Command, args []string) {
                 os.Exit(1)
         }
 
+        // Posted entries go through the configured pipeline and work queue, so ingestion
+        // over capacity is answered with 429 Too Many Requests
+        wp, err := cfg.Collect.NewPool()
+        if err != nil {
+                logger.Error("Invalid worker pool settings", "error", err)
+                os.Exit(1)
+        }
+        var registry *plugin.Registry
+        if cfg.NeedsPlugins() {
+                registry = plugin.NewRegistry(logger.Named("plugins"))
+                if err := registry.LoadPlugins(cfg.Plugins.Directory, cfg.Plugins.Enabled); err != nil {
+                        logger.Error("Failed to load plugins", "directory", cfg.Plugins.Directory, "error", err)
+                        os.Exit(1)
+                }
+                defer registry.ClosePlugins()
+        }
+        // Posted entries get the same dead-letter capture, routing, enrichment and
+        // redaction as collected ones
+        pipeline, err := cfg.NewPipeline(store, wp, registry)
+        if err != nil {
+                logger.Error("Failed to build processing pipeline", "error", err)
+                os.Exit(1)
+        }
+        proc := pipeline.Processor
+        // The workers outlive the signal, so entries accepted while the server shuts down
+        // are still processed
+        workCtx, stopWork := context.WithCancel(context.Background())
+        defer stopWork()
+        wp.Start(workCtx)
+        proc.Start(workCtx)
+
         // Create and configure the API server
-        server := api.NewServer(cfg.API.Host, cfg.API.Port, store, logger)
+        server := api.NewServer(cfg.API.Host, cfg.API.Port, store, logger).WithProcessor(proc)
         
         // Start the server in a goroutine
         go func() {
@@ -104,10 +136,17 @@ func runServe(cmd *cobra.Command, args []string) {
                 logger.Error("Server shutdown failed", "error", err)
         }
 
+        // Process the accepted entries before closing the storage
+        wp.Stop(shutdownCtx)
+        proc.Flush(shutdownCtx)
+
         // Close storage
         if err := store.Close(); err != nil {
                 logger.Error("Error closing storage", "error", err)
         }
+        if err := pipeline.Close(); err != nil {
+                logger.Error("Error closing pipeline", "error", err)
+        }
 
         logger.Info("LogStream API server shutdown complete")
 }
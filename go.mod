@@ -5,11 +5,15 @@ go 1.21
 require (
         github.com/go-chi/chi/v5 v5.0.8
         github.com/hashicorp/go-hclog v1.6.3
+        github.com/maxmind/mmdbwriter v1.0.0
+        github.com/oschwald/maxminddb-golang v1.13.1
         github.com/prometheus/client_golang v1.14.0
         github.com/spf13/cobra v1.7.0
         github.com/spf13/viper v1.13.0
         github.com/stretchr/testify v1.10.0
+        github.com/yuin/gopher-lua v1.1.1
         golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4
+        gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -38,10 +42,10 @@ require (
         github.com/spf13/pflag v1.0.6 // indirect
         github.com/stretchr/objx v0.5.2 // indirect
         github.com/subosito/gotenv v1.6.0 // indirect
+        go4.org/netipx v0.0.0-20220812043211-3cc044ffd68d // indirect
         golang.org/x/sys v0.30.0 // indirect
         golang.org/x/text v0.15.0 // indirect
         google.golang.org/protobuf v1.28.1 // indirect
         gopkg.in/ini.v1 v1.67.0 // indirect
         gopkg.in/yaml.v2 v2.4.0 // indirect
-        gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,7 +1,9 @@
 package api
 
 import (
+        "context"
         "encoding/json"
+        "errors"
         "net/http"
         "strconv"
         "strings"
@@ -9,16 +11,24 @@ import (
 
         "github.com/hashicorp/go-hclog"
 
+        "github.com/mariasu11/logstreamApp/internal/processor"
         "github.com/mariasu11/logstreamApp/internal/query"
         "github.com/mariasu11/logstreamApp/internal/storage"
         "github.com/mariasu11/logstreamApp/pkg/models"
+        "github.com/mariasu11/logstreamApp/pkg/parser"
 )
 
+// maxParseLines limits the number of sample lines accepted by ParseSamples
+const maxParseLines = 1000
+
 // Handlers contains the HTTP handlers for the API
 type Handlers struct {
         storage  storage.Storage
         logger   hclog.Logger
         queryEngine *query.Engine
+        levels   *models.LevelNormalizer
+        parsers  []parser.Parser
+        processor processor.Processor
 }
 
 // NewHandlers creates a new set of API handlers
@@ -27,7 +37,39 @@ func NewHandlers(storage storage.Storage, logger hclog.Logger) *Handlers {
                 storage:     storage,
                 logger:      logger,
                 queryEngine: query.NewEngine(storage),
+                levels:      models.NewLevelNormalizer(),
+                parsers:     parser.DefaultParsers(),
+        }
+}
+
+// WithProcessor sends ingested entries through a processor instead of straight to the storage.
+// Requests the processor refuses for lack of capacity are answered with 429 Too Many Requests.
+func (h *Handlers) WithProcessor(proc processor.Processor) *Handlers {
+        h.processor = proc
+        return h
+}
+
+// ingest hands entries to the processor and reports whether the response was written
+func (h *Handlers) ingest(w http.ResponseWriter, r *http.Request, entries []*models.LogEntry) bool {
+        // The entries are processed after the response is written, so their jobs keep the
+        // request's values but not its cancellation
+        err := h.processor.Process(context.WithoutCancel(r.Context()), entries)
+        if err == nil {
+                return false
+        }
+
+        var backpressure *processor.BackpressureError
+        if processor.IsBackpressure(err) && errors.As(err, &backpressure) {
+                // Tell the client to retry the entries after the accepted ones
+                w.Header().Set("Retry-After", "1")
+                h.respondWithJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+                        "error":    "Ingestion is over capacity, retry later",
+                        "accepted": backpressure.Accepted,
+                })
+                return true
         }
+        h.respondWithError(w, http.StatusServiceUnavailable, "Failed to process log entries: "+err.Error())
+        return true
 }
 
 // StoreLog stores a log entry
@@ -40,8 +82,21 @@ func (h *Handlers) StoreLog(w http.ResponseWriter, r *http.Request) {
         }
 
         // Set timestamp if not provided
+        entry.IngestedAt = time.Now()
         if entry.Timestamp.IsZero() {
-                entry.Timestamp = time.Now()
+                entry.Timestamp = entry.IngestedAt
+                entry.AddField(models.FieldTimestampUnparsed, true)
+        }
+
+        // Store one spelling per severity
+        h.levels.NormalizeEntry(&entry)
+
+        if h.processor != nil {
+                if h.ingest(w, r, []*models.LogEntry{&entry}) {
+                        return
+                }
+                h.respondWithJSON(w, http.StatusAccepted, map[string]string{"status": "ok"})
+                return
         }
 
         // Store the log entry
@@ -62,11 +117,23 @@ func (h *Handlers) StoreLogs(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        // Set timestamp for any entries without one
+        // Set timestamp for any entries without one, and normalize levels
+        now := time.Now()
         for _, entry := range entries {
+                entry.IngestedAt = now
                 if entry.Timestamp.IsZero() {
-                        entry.Timestamp = time.Now()
+                        entry.Timestamp = now
+                        entry.AddField(models.FieldTimestampUnparsed, true)
+                }
+                h.levels.NormalizeEntry(entry)
+        }
+
+        if h.processor != nil {
+                if h.ingest(w, r, entries) {
+                        return
                 }
+                h.respondWithJSON(w, http.StatusAccepted, map[string]string{"status": "ok", "count": strconv.Itoa(len(entries))})
+                return
         }
 
         // Store all log entries
@@ -120,6 +187,13 @@ func (h *Handlers) GetLogs(w http.ResponseWriter, r *http.Request) {
                 levels = []string{level}
         }
 
+        minLevel := r.URL.Query().Get("min_level")
+        if minLevel != "" {
+                if _, ok := models.NormalizeLevel(minLevel); !ok {
+                        h.respondWithError(w, http.StatusBadRequest, "Invalid 'min_level': "+minLevel)
+                        return
+                }
+        }
         filter := r.URL.Query().Get("filter")
 
         // Debug log request parameters
@@ -129,6 +203,7 @@ func (h *Handlers) GetLogs(w http.ResponseWriter, r *http.Request) {
                 "to", to, 
                 "sources", sources, 
                 "levels", levels, 
+                "min_level", minLevel,
                 "filter", filter)
                 
         // Extra debugging to check if there are logs in the system
@@ -148,6 +223,10 @@ func (h *Handlers) GetLogs(w http.ResponseWriter, r *http.Request) {
                 qb.WithLevels(levels...)
         }
 
+        if minLevel != "" {
+                qb.WithMinLevel(minLevel)
+        }
+
         if filter != "" {
                 qb.WithFilter(filter)
         }
@@ -200,6 +279,7 @@ func (h *Handlers) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
                 To         string    `json:"to,omitempty"`
                 Sources    []string  `json:"sources,omitempty"`
                 Levels     []string  `json:"levels,omitempty"`
+                MinLevel   string    `json:"min_level,omitempty"`
                 SortBy     string    `json:"sort_by,omitempty"`
                 SortOrder  string    `json:"sort_order,omitempty"`
         }
@@ -236,6 +316,15 @@ func (h *Handlers) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
                 query = query.WithLevels(queryRequest.Levels...)
         }
 
+        // Apply minimum level if provided
+        if queryRequest.MinLevel != "" {
+                if _, ok := models.NormalizeLevel(queryRequest.MinLevel); !ok {
+                        h.respondWithError(w, http.StatusBadRequest, "Invalid 'min_level': "+queryRequest.MinLevel)
+                        return
+                }
+                query = query.WithMinLevel(queryRequest.MinLevel)
+        }
+
         // Parse time range if provided
         var from, to time.Time
         var err error
@@ -304,6 +393,46 @@ func (h *Handlers) AnalyzeLogs(w http.ResponseWriter, r *http.Request) {
         h.respondWithJSON(w, http.StatusOK, result)
 }
 
+// ParseSamples parses sample lines without storing them, reporting which parser handled each line
+func (h *Handlers) ParseSamples(w http.ResponseWriter, r *http.Request) {
+        var parseRequest struct {
+                Lines  []string `json:"lines"`
+                Parser string   `json:"parser,omitempty"`
+                Source string   `json:"source,omitempty"`
+        }
+
+        if err := json.NewDecoder(r.Body).Decode(&parseRequest); err != nil {
+                h.respondWithError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+                return
+        }
+        if len(parseRequest.Lines) == 0 {
+                h.respondWithError(w, http.StatusBadRequest, "No lines to parse")
+                return
+        }
+        if len(parseRequest.Lines) > maxParseLines {
+                h.respondWithError(w, http.StatusBadRequest, "Too many lines (maximum is "+strconv.Itoa(maxParseLines)+")")
+                return
+        }
+
+        parsers, err := parser.SelectParsers(h.parsers, parseRequest.Parser)
+        if err != nil {
+                h.respondWithError(w, http.StatusBadRequest, err.Error())
+                return
+        }
+
+        results := make([]*parser.SampleResult, 0, len(parseRequest.Lines))
+        for _, line := range parseRequest.Lines {
+                result := parser.ParseSample(parsers, parseRequest.Source, line)
+                h.levels.NormalizeEntry(result.Entry)
+                results = append(results, result)
+        }
+
+        h.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+                "results": results,
+                "summary": parser.SummarizeSamples(results),
+        })
+}
+
 // HealthCheck returns the health status of the API
 func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
         // Check storage connectivity
@@ -336,6 +465,7 @@ func (h *Handlers) GetDocs(w http.ResponseWriter, r *http.Request) {
                         {"path": "/api/v1/logs/stats", "method": "GET", "description": "Get storage statistics"},
                         {"path": "/api/v1/query", "method": "POST", "description": "Execute a custom query"},
                         {"path": "/api/v1/query/analyze", "method": "POST", "description": "Perform log analysis"},
+                        {"path": "/api/v1/parse", "method": "POST", "description": "Parse sample lines without storing them"},
                         {"path": "/api/v1/health", "method": "GET", "description": "Check API health"},
                         {"path": "/metrics", "method": "GET", "description": "Prometheus metrics"},
                 },
@@ -3,8 +3,8 @@ package api
 import (
         "github.com/go-chi/chi/v5"
         "github.com/hashicorp/go-hclog"
-        "github.com/prometheus/client_golang/prometheus/promhttp"
         
+        "github.com/mariasu11/logstreamApp/internal/metrics"
         "github.com/mariasu11/logstreamApp/internal/storage"
 )
 
@@ -30,12 +30,15 @@ func SetupRoutes(router *chi.Mux, storage storage.Storage, logger hclog.Logger)
                         r.Post("/analyze", handlers.AnalyzeLogs)
                 })
 
+                // Parser playground
+                r.Post("/parse", handlers.ParseSamples)
+
                 // Health routes
                 r.Get("/health", handlers.HealthCheck)
         })
 
         // Prometheus metrics endpoint
-        router.Handle("/metrics", promhttp.Handler())
+        router.Handle("/metrics", metrics.Handler())
 
         // Documentation
         router.Get("/", handlers.GetDocs)
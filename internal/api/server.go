@@ -9,8 +9,9 @@ import (
         "github.com/go-chi/chi/v5"
         "github.com/go-chi/chi/v5/middleware"
         "github.com/hashicorp/go-hclog"
-        "github.com/prometheus/client_golang/prometheus/promhttp"
 
+        "github.com/mariasu11/logstreamApp/internal/metrics"
+        "github.com/mariasu11/logstreamApp/internal/processor"
         "github.com/mariasu11/logstreamApp/internal/storage"
 )
 
@@ -22,6 +23,7 @@ type Server struct {
         logger     hclog.Logger
         storage    storage.Storage
         httpServer *http.Server
+        handlers   *Handlers
 }
 
 // NewServer creates a new API server
@@ -67,6 +69,7 @@ func (s *Server) setupMiddleware() {
 func (s *Server) setupRoutes() {
         // Create API handlers
         handlers := NewHandlers(s.storage, s.logger)
+        s.handlers = handlers
         
         // Create Web UI handler
         webHandler := NewWebHandler(s.logger)
@@ -89,12 +92,15 @@ func (s *Server) setupRoutes() {
                         r.Post("/analyze", handlers.AnalyzeLogs)
                 })
                 
+                // Parser playground
+                r.Post("/parse", handlers.ParseSamples)
+                
                 // Health routes
                 r.Get("/health", handlers.HealthCheck)
         })
         
         // Prometheus metrics endpoint
-        s.Router.Handle("/metrics", promhttp.Handler())
+        s.Router.Handle("/metrics", metrics.Handler())
         
         // API documentation
         s.Router.Get("/api", handlers.GetDocs)
@@ -103,6 +109,13 @@ func (s *Server) setupRoutes() {
         webHandler.RegisterRoutes(s.Router)
 }
 
+// WithProcessor sends entries posted to the API through a processor, which answers
+// 429 Too Many Requests when it is over capacity
+func (s *Server) WithProcessor(proc processor.Processor) *Server {
+        s.handlers.WithProcessor(proc)
+        return s
+}
+
 // Start begins the HTTP server
 func (s *Server) Start() error {
         addr := fmt.Sprintf("%s:%d", s.host, s.port)
@@ -2,12 +2,21 @@ package collector
 
 import (
         "context"
+        "errors"
         "fmt"
         "net/url"
         "path/filepath"
         "strings"
+        "time"
 
         "github.com/mariasu11/logstreamApp/internal/processor"
+        "github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Delays between attempts to hand over entries the processor refused for lack of capacity
+const (
+        backpressureMinDelay = 10 * time.Millisecond
+        backpressureMaxDelay = time.Second
 )
 
 // Collector defines the interface for log collectors
@@ -76,3 +85,37 @@ func (b *BaseCollector) Name() string {
 func (b *BaseCollector) Source() string {
         return b.source
 }
+
+// process hands a batch to the processor. Entries it refuses for lack of capacity are retried
+// with a growing delay, so the collector stops reading until the pipeline catches up.
+func (b *BaseCollector) process(ctx context.Context, entries []*models.LogEntry) error {
+        delay := backpressureMinDelay
+        for len(entries) > 0 {
+                err := b.processor.Process(ctx, entries)
+                if err == nil {
+                        return nil
+                }
+                if ctx.Err() != nil {
+                        return ctx.Err()
+                }
+                var backpressure *processor.BackpressureError
+                if !processor.IsBackpressure(err) || !errors.As(err, &backpressure) {
+                        return err
+                }
+
+                // Back off further only while the pipeline makes no progress
+                if backpressure.Accepted > 0 {
+                        delay = backpressureMinDelay
+                }
+                entries = entries[backpressure.Accepted:]
+                select {
+                case <-ctx.Done():
+                        return ctx.Err()
+                case <-time.After(delay):
+                }
+                if delay *= 2; delay > backpressureMaxDelay {
+                        delay = backpressureMaxDelay
+                }
+        }
+        return nil
+}
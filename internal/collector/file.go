@@ -11,8 +11,13 @@ import (
 
         "github.com/mariasu11/logstreamApp/internal/processor"
         "github.com/mariasu11/logstreamApp/pkg/models"
+        "github.com/mariasu11/logstreamApp/pkg/worker"
 )
 
+// fileBatchMaxBytes bounds the raw data of a batch, so files with long lines are handed
+// over in smaller batches
+const fileBatchMaxBytes = 1 << 20
+
 // FileCollector collects logs from files
 type FileCollector struct {
         BaseCollector
@@ -94,7 +99,12 @@ func (fc *FileCollector) Start(ctx context.Context) error {
         ticker := time.NewTicker(fc.pollInterval)
         defer ticker.Stop()
 
-        batch := make([]*models.LogEntry, 0, fc.batchSize)
+        // Batches are processed on this goroutine, so a slow pipeline slows reading down, and a
+        // failed batch stops the collector before it reads on
+        var failed error
+        batches := worker.NewBatchProcessor(nil, fc.batchSize, 0, fc.process).
+                WithMaxBytes(fileBatchMaxBytes, func(entry *models.LogEntry) int { return len(entry.RawData) }).
+                WithDeadLetter(func(ctx context.Context, batch []*models.LogEntry, err error) { failed = err })
         for {
                 select {
                 case <-ctx.Done():
@@ -107,24 +117,24 @@ func (fc *FileCollector) Start(ctx context.Context) error {
                                 line := scanner.Text()
                                 
                                 // Create a log entry
+                                now := time.Now()
                                 entry := &models.LogEntry{
-                                        Timestamp: time.Now(),
-                                        Source:    fc.Source(),
-                                        RawData:   line,
-                                        Message:   line, // Use raw line as message until processed
+                                        Timestamp:  now, // Replaced by the event time when parsed
+                                        IngestedAt: now,
+                                        Source:     fc.Source(),
+                                        RawData:    line,
+                                        Message:    line, // Use raw line as message until processed
                                 }
                                 
                                 // Debug output for log parsing
                                 fmt.Printf("DEBUG: Processing log line: %s\n", line)
                                 
-                                batch = append(batch, entry)
-                                
-                                // Process batch if it's full
-                                if len(batch) >= fc.batchSize {
-                                        if err := fc.processor.Process(ctx, batch); err != nil {
-                                                return fmt.Errorf("failed to process batch: %w", err)
-                                        }
-                                        batch = batch[:0] // Clear batch but keep capacity
+                                // Processed once the batch is full
+                                if err := batches.Add(ctx, entry); err != nil {
+                                        return fmt.Errorf("failed to process batch: %w", err)
+                                }
+                                if failed != nil {
+                                        return fmt.Errorf("failed to process batch: %w", failed)
                                 }
                         }
                         
@@ -133,12 +143,14 @@ func (fc *FileCollector) Start(ctx context.Context) error {
                                 return fmt.Errorf("error reading file %s: %w", fc.filePath, err)
                         }
                         
-                        // Process any remaining entries in the batch
-                        if hasNewContent && len(batch) > 0 {
-                                if err := fc.processor.Process(ctx, batch); err != nil {
+                        // Process any remaining entries, reporting batches that failed
+                        if hasNewContent {
+                                if err := batches.Flush(ctx); err != nil {
                                         return fmt.Errorf("failed to process batch: %w", err)
                                 }
-                                batch = batch[:0] // Clear batch but keep capacity
+                                if failed != nil {
+                                        return fmt.Errorf("failed to process batch: %w", failed)
+                                }
                         }
                 }
         }
@@ -129,18 +129,17 @@ func (hc *HTTPCollector) processJSONResponse(ctx context.Context, data []byte) e
         var entries []*models.LogEntry
         err := json.Unmarshal(data, &entries)
         if err == nil && len(entries) > 0 {
-                // Set source for each entry
+                // Set source for each entry; entries without a timestamp are flagged by the processor
+                now := time.Now()
                 for _, entry := range entries {
                         if entry.Source == "" {
                                 entry.Source = hc.Source()
                         }
-                        if entry.Timestamp.IsZero() {
-                                entry.Timestamp = time.Now()
-                        }
+                        entry.IngestedAt = now
                 }
                 
                 // Process the entries
-                return hc.processor.Process(ctx, entries)
+                return hc.process(ctx, entries)
         }
 
         // Try to parse as single log entry
@@ -149,22 +148,16 @@ func (hc *HTTPCollector) processJSONResponse(ctx context.Context, data []byte) e
                 if entry.Source == "" {
                         entry.Source = hc.Source()
                 }
-                if entry.Timestamp.IsZero() {
-                        entry.Timestamp = time.Now()
-                }
+                entry.IngestedAt = time.Now()
                 
-                return hc.processor.Process(ctx, []*models.LogEntry{&entry})
+                return hc.process(ctx, []*models.LogEntry{&entry})
         }
 
         // If we can't parse as structured log entries, create a raw entry
-        rawEntry := &models.LogEntry{
-                Timestamp: time.Now(),
-                Source:    hc.Source(),
-                RawData:   string(data),
-                Message:   string(data),
-        }
+        rawEntry := models.NewLogEntry(hc.Source(), string(data))
+        rawEntry.RawData = string(data)
         
-        return hc.processor.Process(ctx, []*models.LogEntry{rawEntry})
+        return hc.process(ctx, []*models.LogEntry{rawEntry})
 }
 
 // processTextResponse handles plain text log data
@@ -174,23 +167,25 @@ func (hc *HTTPCollector) processTextResponse(ctx context.Context, data []byte) e
         entries := make([]*models.LogEntry, 0, len(lines))
         
         // Create a log entry for each non-empty line
+        now := time.Now()
         for _, line := range lines {
                 if len(strings.TrimSpace(line)) == 0 {
                         continue
                 }
                 
                 entry := &models.LogEntry{
-                        Timestamp: time.Now(),
-                        Source:    hc.Source(),
-                        RawData:   line,
-                        Message:   line,
+                        Timestamp:  now,
+                        IngestedAt: now,
+                        Source:     hc.Source(),
+                        RawData:    line,
+                        Message:    line,
                 }
                 
                 entries = append(entries, entry)
         }
         
         if len(entries) > 0 {
-                return hc.processor.Process(ctx, entries)
+                return hc.process(ctx, entries)
         }
         
         return nil
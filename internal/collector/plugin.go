@@ -0,0 +1,68 @@
+package collector
+
+import (
+        "context"
+        "fmt"
+
+        "github.com/mariasu11/logstreamApp/internal/metrics"
+        "github.com/mariasu11/logstreamApp/internal/processor"
+        "github.com/mariasu11/logstreamApp/pkg/models"
+        "github.com/mariasu11/logstreamApp/pkg/plugin"
+)
+
+// PluginCollector runs an input plugin alongside the other collectors
+type PluginCollector struct {
+        BaseCollector
+        input   plugin.InputPlugin
+        metrics *metrics.Metrics
+}
+
+// NewPluginCollector creates a collector for an input plugin. Plugins implementing
+// plugin.EmittingInputPlugin have the entries they collect handed to the processor.
+func NewPluginCollector(input plugin.InputPlugin, processor processor.Processor) *PluginCollector {
+        return &PluginCollector{
+                BaseCollector: BaseCollector{
+                        name:      fmt.Sprintf("plugin-%s", input.Name()),
+                        source:    fmt.Sprintf("plugin://%s", input.Name()),
+                        processor: processor,
+                },
+                input:   input,
+                metrics: metrics.GetMetrics(),
+        }
+}
+
+// Start implements the Collector interface. It starts the plugin, then stops it once the
+// context is done.
+func (pc *PluginCollector) Start(ctx context.Context) error {
+        if emitting, ok := pc.input.(plugin.EmittingInputPlugin); ok {
+                emitting.SetEmitter(func(entries []*models.LogEntry) error {
+                        return pc.emit(ctx, entries)
+                })
+        }
+
+        if err := pc.input.Start(); err != nil {
+                pc.metrics.PluginErrors.WithLabelValues(pc.input.Name(), "input").Inc()
+                return fmt.Errorf("failed to start input plugin %s: %w", pc.input.Name(), err)
+        }
+
+        <-ctx.Done()
+        if err := pc.input.Stop(); err != nil {
+                pc.metrics.PluginErrors.WithLabelValues(pc.input.Name(), "input").Inc()
+                return fmt.Errorf("failed to stop input plugin %s: %w", pc.input.Name(), err)
+        }
+        return ctx.Err()
+}
+
+// emit hands entries from the plugin to the processor, waiting out backpressure
+func (pc *PluginCollector) emit(ctx context.Context, entries []*models.LogEntry) error {
+        for _, entry := range entries {
+                if entry.Source == "" {
+                        entry.Source = pc.source
+                }
+        }
+        err := pc.process(ctx, entries)
+        if err != nil && ctx.Err() == nil {
+                pc.metrics.PluginErrors.WithLabelValues(pc.input.Name(), "input").Inc()
+        }
+        return err
+}
@@ -6,15 +6,31 @@ import (
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/mariasu11/logstreamApp/internal/processor"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/parser"
+	"github.com/mariasu11/logstreamApp/pkg/queue"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Log     LogConfig     `mapstructure:"log"`
-	Collect CollectConfig `mapstructure:"collect"`
-	API     APIConfig     `mapstructure:"api"`
-	Query   QueryConfig   `mapstructure:"query"`
-	Plugins PluginsConfig `mapstructure:"plugins"`
+	Log        LogConfig        `mapstructure:"log"`
+	Collect    CollectConfig    `mapstructure:"collect"`
+	API        APIConfig        `mapstructure:"api"`
+	Query      QueryConfig      `mapstructure:"query"`
+	Plugins    PluginsConfig    `mapstructure:"plugins"`
+	Levels     LevelsConfig     `mapstructure:"levels"`
+	Timestamps TimestampsConfig `mapstructure:"timestamps"`
+	JSON       JSONConfig       `mapstructure:"json"`
+	Transform  TransformConfig  `mapstructure:"transform"`
+	// Pipeline lists the filter, transformer and plugin stages entries pass through, in order
+	Pipeline []PipelineStageConfig `mapstructure:"pipeline"`
+	// Outputs are named destinations for routes besides the main storage
+	Outputs []OutputConfig `mapstructure:"outputs"`
+	// Routing decides which outputs processed entries are delivered to
+	Routing RoutingConfig `mapstructure:"routing"`
 }
 
 // LogConfig holds logging configuration
@@ -25,11 +41,146 @@ type LogConfig struct {
 
 // CollectConfig holds configuration for log collection
 type CollectConfig struct {
-	Sources     []string `mapstructure:"sources"`
-	Workers     int      `mapstructure:"workers"`
-	Storage     string   `mapstructure:"storage"`
-	StoragePath string   `mapstructure:"storage-path"`
-	BatchSize   int      `mapstructure:"batch-size"`
+	Sources     []string         `mapstructure:"sources"`
+	Workers     int              `mapstructure:"workers"`
+	Storage     string           `mapstructure:"storage"`
+	StoragePath string           `mapstructure:"storage-path"`
+	BatchSize   int              `mapstructure:"batch-size"`
+	DeadLetter  DeadLetterConfig `mapstructure:"dead-letter"`
+	// BatchInterval is the longest a processed entry waits for its batch of BatchSize
+	// entries to fill before it is written to the storage; a BatchSize of 1 disables batching
+	BatchInterval time.Duration `mapstructure:"batch-interval"`
+	// QueueSize is the capacity of the work queue (default 100 per worker)
+	QueueSize int `mapstructure:"queue-size"`
+	// Overflow is what happens when the work queue is full: block (slow collectors
+	// down), reject (report the refusal to collectors) or drop (discard entries)
+	Overflow string `mapstructure:"overflow"`
+	// BlockTimeout bounds how long a blocked collector waits before its entries are
+	// refused and retried; zero waits as long as it takes
+	BlockTimeout time.Duration `mapstructure:"block-timeout"`
+	// OrderBy keeps entries sharing a key in order by running them on one worker: "source"
+	// or a field name; empty (the default) runs entries on any worker
+	OrderBy string `mapstructure:"order-by"`
+	// KeyQuota caps the entries of one key queued on a worker, so a hot key can't starve
+	// the keys sharing its worker (default half of the worker's share of the queue)
+	KeyQuota int `mapstructure:"key-quota"`
+	// Autoscale grows the pool beyond Workers under load; it can't be combined with OrderBy
+	Autoscale AutoscaleConfig `mapstructure:"autoscale"`
+	// Spool puts collected batches on disk before processing
+	Spool SpoolConfig `mapstructure:"spool"`
+}
+
+// AutoscaleConfig holds configuration for resizing the worker pool with the load. The pool
+// never has fewer than collect.workers workers.
+type AutoscaleConfig struct {
+	// MaxWorkers is the most workers the pool grows to; autoscaling is disabled when it is 0
+	MaxWorkers int `mapstructure:"max-workers"`
+	// Interval is how often the load is checked (default 1s)
+	Interval time.Duration `mapstructure:"interval"`
+	// Cooldown is the least time between resizes (default 30s)
+	Cooldown time.Duration `mapstructure:"cooldown"`
+	// TargetLatency adds workers while entries wait and take longer than this on average
+	TargetLatency time.Duration `mapstructure:"target-latency"`
+}
+
+// SpoolConfig holds configuration for the disk queue between collectors and the worker pool
+type SpoolConfig struct {
+	// Path is the queue directory; spooling is disabled when it is empty
+	Path string `mapstructure:"path"`
+	// MaxSizeMB caps the queue size; collectors are refused beyond it (0 is unbounded)
+	MaxSizeMB int `mapstructure:"max-size-mb"`
+	// SegmentSizeMB is the size at which a new segment file is started (default 64)
+	SegmentSizeMB int `mapstructure:"segment-size-mb"`
+	// Sync is always, interval (default) or never
+	Sync         string        `mapstructure:"sync"`
+	SyncInterval time.Duration `mapstructure:"sync-interval"`
+}
+
+// Enabled reports whether batches are spooled
+func (c SpoolConfig) Enabled() bool {
+	return c.Path != ""
+}
+
+// validate checks the spool settings
+func (c SpoolConfig) validate() (queue.SyncPolicy, error) {
+	policy, err := queue.ParseSyncPolicy(strings.ToLower(c.Sync))
+	if err != nil {
+		return "", err
+	}
+	if c.MaxSizeMB < 0 || c.SegmentSizeMB < 0 {
+		return "", fmt.Errorf("spool sizes must not be negative")
+	}
+	if c.SyncInterval < 0 {
+		return "", fmt.Errorf("spool sync-interval must not be negative")
+	}
+	return policy, nil
+}
+
+// Open opens the spool queue, replaying what a previous run left unacknowledged
+func (c SpoolConfig) Open() (*queue.DiskQueue, error) {
+	policy, err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+	q, err := queue.OpenDiskQueue(c.Path, int64(c.MaxSizeMB)<<20)
+	if err != nil {
+		return nil, err
+	}
+	return q.WithSegmentSize(int64(c.SegmentSizeMB)<<20).WithSyncPolicy(policy, c.SyncInterval), nil
+}
+
+// NewPool creates the worker pool with the configured queue, overflow policy and autoscaling
+func (c CollectConfig) NewPool() (*worker.Pool, error) {
+	policy, err := worker.ParseOverflowPolicy(strings.ToLower(c.Overflow))
+	if err != nil {
+		return nil, err
+	}
+	if c.QueueSize < 0 {
+		return nil, fmt.Errorf("queue-size must not be negative")
+	}
+	if c.BlockTimeout < 0 {
+		return nil, fmt.Errorf("block-timeout must not be negative")
+	}
+	if c.BatchSize < 0 || c.BatchInterval < 0 {
+		return nil, fmt.Errorf("batch-size and batch-interval must not be negative")
+	}
+	if c.KeyQuota < 0 {
+		return nil, fmt.Errorf("key-quota must not be negative")
+	}
+	scale := c.Autoscale
+	if scale.MaxWorkers != 0 && scale.MaxWorkers < c.Workers {
+		return nil, fmt.Errorf("autoscale max-workers (%d) must not be below workers (%d)", scale.MaxWorkers, c.Workers)
+	}
+	if scale.Interval < 0 || scale.Cooldown < 0 || scale.TargetLatency < 0 {
+		return nil, fmt.Errorf("autoscale durations must not be negative")
+	}
+	// Ordered entries only run on the first workers, so added workers would sit idle
+	if scale.MaxWorkers > c.Workers && c.OrderBy != "" {
+		return nil, fmt.Errorf("autoscale max-workers can't be combined with order-by")
+	}
+	pool := worker.NewPool(c.Workers).
+		WithQueueSize(c.QueueSize).
+		WithOverflowPolicy(policy).
+		WithBlockTimeout(c.BlockTimeout).
+		WithKeyQuota(c.KeyQuota)
+	if scale.MaxWorkers > c.Workers {
+		pool.WithAutoscale(c.Workers, scale.MaxWorkers).
+			WithScaleInterval(scale.Interval, scale.Cooldown).
+			WithTargetLatency(scale.TargetLatency)
+	}
+	return pool, nil
+}
+
+// DeadLetterConfig holds configuration for capturing lines no parser could handle
+type DeadLetterConfig struct {
+	// Type selects the sink: "" (disabled), "file" or "disk"
+	Type string `mapstructure:"type"`
+	// Path is the dead-letter file, or the directory for disk storage
+	Path string `mapstructure:"path"`
+	// Format is the file format: raw or json
+	Format string `mapstructure:"format"`
+	// Keep also stores unparsed entries in the main storage
+	Keep bool `mapstructure:"keep"`
 }
 
 // APIConfig holds configuration for the API server
@@ -58,6 +209,297 @@ type PluginsConfig struct {
 	Directory string            `mapstructure:"directory"`
 	Enabled   []string          `mapstructure:"enabled"`
 	Config    map[string]string `mapstructure:"config"`
+	// OnError selects what happens to an entry a processing plugin fails on: ignore, drop or fail
+	OnError string             `mapstructure:"on-error"`
+	Output  PluginOutputConfig `mapstructure:"output"`
+}
+
+// PluginOutputConfig holds configuration for handing entries to output plugins
+type PluginOutputConfig struct {
+	// BatchSize is the most entries handed to an output plugin at once
+	BatchSize int `mapstructure:"batch-size"`
+	// BufferSize is how many entries may wait for an output plugin before new ones are dropped
+	BufferSize int `mapstructure:"buffer-size"`
+	// FlushInterval is the longest an entry waits for its batch to fill
+	FlushInterval time.Duration `mapstructure:"flush-interval"`
+	// Retries is how many times a refused batch is handed over again before it is dropped
+	Retries int `mapstructure:"retries"`
+	// RetryBackoff is the wait before the first retry, doubling for each next one
+	RetryBackoff time.Duration `mapstructure:"retry-backoff"`
+}
+
+// LevelsConfig holds configuration for log level normalization
+type LevelsConfig struct {
+	// Aliases maps raw level values onto canonical levels (trace, debug, info, warn, error, fatal)
+	Aliases map[string]string `mapstructure:"aliases"`
+	// Numeric selects how numeric levels are read: auto, syslog, otel or bunyan
+	Numeric string `mapstructure:"numeric"`
+}
+
+// Normalizer builds the level normalizer described by the configuration
+func (c LevelsConfig) Normalizer() (*models.LevelNormalizer, error) {
+	normalizer, err := models.NewLevelNormalizer().WithNumericScheme(c.Numeric)
+	if err != nil {
+		return nil, err
+	}
+	return normalizer.WithAliases(c.Aliases)
+}
+
+// TimestampsConfig holds configuration for event time parsing
+type TimestampsConfig struct {
+	// Timezone is the IANA zone used for timestamps that carry no zone
+	Timezone string `mapstructure:"timezone"`
+	// MaxAge rejects event times older than this (0 disables the check)
+	MaxAge time.Duration `mapstructure:"max-age"`
+	// MaxAhead rejects event times further in the future than this (0 disables the check)
+	MaxAhead time.Duration `mapstructure:"max-ahead"`
+	// Sources overrides the timezone for individual sources
+	Sources []SourceTimezoneConfig `mapstructure:"sources"`
+}
+
+// SourceTimezoneConfig sets the default timezone of one source
+type SourceTimezoneConfig struct {
+	Source   string `mapstructure:"source"`
+	Timezone string `mapstructure:"timezone"`
+}
+
+// Parser builds the timestamp parser described by the configuration
+func (c TimestampsConfig) Parser() (*parser.TimestampParser, error) {
+	timestamps := parser.NewTimestampParser().WithSkewLimits(c.MaxAge, c.MaxAhead)
+
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		timestamps.WithLocation(loc)
+	}
+
+	for _, source := range c.Sources {
+		if source.Source == "" {
+			return nil, fmt.Errorf("source timezone %q has no source", source.Timezone)
+		}
+		loc, err := time.LoadLocation(source.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q for source %s: %w", source.Timezone, source.Source, err)
+		}
+		timestamps.WithSourceLocation(source.Source, loc)
+	}
+
+	return timestamps, nil
+}
+
+// JSONConfig holds configuration for parsing generic JSON logs
+type JSONConfig struct {
+	// Fields lists the paths tried, in order, for each core field (timestamp, level, message, source)
+	Fields JSONFieldsConfig `mapstructure:"fields"`
+	// Flatten turns nested objects into dotted keys such as http.request.method
+	Flatten bool `mapstructure:"flatten"`
+	// MaxDepth limits how many levels are flattened (0 means unlimited)
+	MaxDepth int `mapstructure:"max-depth"`
+	// Arrays selects how arrays are flattened: keep, index or join
+	Arrays string `mapstructure:"arrays"`
+}
+
+// JSONFieldsConfig maps dotted JSON paths onto the core log entry fields
+type JSONFieldsConfig struct {
+	Timestamp []string `mapstructure:"timestamp"`
+	Level     []string `mapstructure:"level"`
+	Message   []string `mapstructure:"message"`
+	Source    []string `mapstructure:"source"`
+}
+
+// Options builds the JSON parser options described by the configuration
+func (c JSONConfig) Options() (parser.JSONOptions, error) {
+	arrays, err := parser.ParseArrayMode(c.Arrays)
+	if err != nil {
+		return parser.JSONOptions{}, err
+	}
+	if c.MaxDepth < 0 {
+		return parser.JSONOptions{}, fmt.Errorf("max-depth must not be negative")
+	}
+	return parser.JSONOptions{
+		Mapping: parser.JSONFieldMapping{
+			Timestamp: c.Fields.Timestamp,
+			Level:     c.Fields.Level,
+			Message:   c.Fields.Message,
+			Source:    c.Fields.Source,
+		},
+		Flatten:   c.Flatten,
+		MaxDepth:  c.MaxDepth,
+		ArrayMode: arrays,
+	}, nil
+}
+
+// TransformConfig holds configuration for transformations applied to collected log entries
+type TransformConfig struct {
+	// MaskFields are redaction rules applied in order
+	MaskFields []MaskFieldConfig `mapstructure:"mask_fields"`
+	// HashKey is the HMAC key for rules in hash mode
+	HashKey string      `mapstructure:"hash-key"`
+	GeoIP   GeoIPConfig `mapstructure:"geoip"`
+	// Lookups join entry fields against local tables, in order
+	Lookups []LookupConfig `mapstructure:"lookups"`
+}
+
+// MaskFieldConfig is a redaction rule
+type MaskFieldConfig struct {
+	// Name labels the rule in metrics (defaults to the field)
+	Name string `mapstructure:"name"`
+	// Field is "message", "*" (message and all fields) or a field name, optionally prefixed with "fields."
+	Field string `mapstructure:"field"`
+	// Patterns are regular expressions matching the sensitive data
+	Patterns []string `mapstructure:"patterns"`
+	// Detectors are built-in detectors: credit_card, email, jwt, aws_access_key, aws_secret_key, ipv4, ipv6
+	Detectors []string `mapstructure:"detectors"`
+	// Replacement replaces pattern matches in mask mode and may reference capture groups
+	Replacement string `mapstructure:"replacement"`
+	// Mode is mask (default), hash or drop
+	Mode string `mapstructure:"mode"`
+}
+
+// Redactor builds the redaction transformer described by the configuration, or nil when there are no rules
+func (c TransformConfig) Redactor() (*processor.RedactTransformer, error) {
+	if len(c.MaskFields) == 0 {
+		return nil, nil
+	}
+
+	var rules []*processor.RedactRule
+	for i, mask := range c.MaskFields {
+		name := mask.Name
+		if name == "" {
+			name = mask.Field
+		}
+		if name == "" {
+			name = processor.RedactTargetMessage
+		}
+		if len(mask.Patterns) == 0 && len(mask.Detectors) == 0 {
+			return nil, fmt.Errorf("mask rule %d (%s) has no patterns or detectors", i+1, name)
+		}
+
+		var maskRules []*processor.RedactRule
+		for _, pattern := range mask.Patterns {
+			rule, err := processor.NewRedactRule(name, mask.Field, pattern, mask.Replacement)
+			if err != nil {
+				return nil, fmt.Errorf("mask rule %s: %w", name, err)
+			}
+			maskRules = append(maskRules, rule)
+		}
+		for _, detector := range mask.Detectors {
+			rule, err := processor.NewDetectorRule(strings.ToLower(detector), mask.Field)
+			if err != nil {
+				return nil, fmt.Errorf("mask rule %s: %w", name, err)
+			}
+			rule.Name = name
+			maskRules = append(maskRules, rule)
+		}
+
+		for _, rule := range maskRules {
+			if _, err := rule.WithMode(strings.ToLower(mask.Mode)); err != nil {
+				return nil, fmt.Errorf("mask rule %s: %w", name, err)
+			}
+		}
+		rules = append(rules, maskRules...)
+	}
+
+	return processor.NewRedactTransformer(c.HashKey, rules...)
+}
+
+// GeoIPConfig holds configuration for IP enrichment from local MaxMind databases
+type GeoIPConfig struct {
+	// Field is the field holding the IP address; enrichment is disabled when empty
+	Field string `mapstructure:"field"`
+	// Databases are .mmdb files (e.g. GeoLite2-City and GeoLite2-ASN), consulted in order
+	Databases []string `mapstructure:"databases"`
+	// CacheSize is the number of lookups cached per database
+	CacheSize int `mapstructure:"cache-size"`
+	// ReloadInterval is how often the database files are checked for changes (0 disables reloading)
+	ReloadInterval time.Duration `mapstructure:"reload-interval"`
+}
+
+// LookupConfig enriches entries from a CSV or JSON table
+type LookupConfig struct {
+	// Name labels the lookup in logs and errors (defaults to the file)
+	Name string `mapstructure:"name"`
+	// File is the table; a CSV file with a header row, or a JSON array or stream of objects
+	File string `mapstructure:"file"`
+	// Format is csv or json (taken from the file extension when empty)
+	Format string `mapstructure:"format"`
+	// Keys are the table columns rows are looked up by
+	Keys []string `mapstructure:"keys"`
+	// Fields are the entry fields matched against the keys, in order (defaults to the keys)
+	Fields []string `mapstructure:"fields"`
+	// Columns limits the table columns added to entries (all non-key columns when empty)
+	Columns []string `mapstructure:"columns"`
+	// Prefix is prepended to the added field names
+	Prefix string `mapstructure:"prefix"`
+	// Default is set on every column for keys missing from the table; nothing is added when unset
+	Default *string `mapstructure:"default"`
+	// ReloadInterval is how often the file is checked for changes (defaults to 1m)
+	ReloadInterval time.Duration `mapstructure:"reload-interval"`
+	// Static disables reloading the file
+	Static bool `mapstructure:"static"`
+}
+
+// label returns the lookup name used in logs and errors
+func (l LookupConfig) label() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.File
+}
+
+// validate checks the lookup without reading its file
+func (l LookupConfig) validate() error {
+	if l.File == "" {
+		return fmt.Errorf("file is required")
+	}
+	if len(l.Keys) == 0 {
+		return fmt.Errorf("at least one key column is required")
+	}
+	if len(l.Fields) > 0 && len(l.Fields) != len(l.Keys) {
+		return fmt.Errorf("%d fields given for %d keys", len(l.Fields), len(l.Keys))
+	}
+	switch strings.ToLower(l.Format) {
+	case "":
+		if _, err := processor.LookupFormat(l.File); err != nil {
+			return err
+		}
+	case processor.LookupFormatCSV, processor.LookupFormatJSON:
+	default:
+		return fmt.Errorf("invalid format %q (must be csv or json)", l.Format)
+	}
+	if l.ReloadInterval < 0 {
+		return fmt.Errorf("reload interval must not be negative")
+	}
+	return nil
+}
+
+// Open loads the lookup table and builds its transformer
+func (l LookupConfig) Open() (*processor.LookupTransformer, *processor.LookupTable, error) {
+	if err := l.validate(); err != nil {
+		return nil, nil, fmt.Errorf("lookup %s: %w", l.label(), err)
+	}
+	table, err := processor.OpenLookupTable(l.File, strings.ToLower(l.Format), l.Keys, l.Columns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("lookup %s: %w", l.label(), err)
+	}
+	switch {
+	case l.Static:
+		table.WithReloadInterval(0)
+	case l.ReloadInterval > 0:
+		table.WithReloadInterval(l.ReloadInterval)
+	}
+
+	transformer, err := processor.NewLookupTransformer(table, l.Fields...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("lookup %s: %w", l.label(), err)
+	}
+	transformer.WithPrefix(l.Prefix)
+	if l.Default != nil {
+		transformer.WithDefault(*l.Default)
+	}
+	return transformer, table, nil
 }
 
 // Load loads configuration from viper
@@ -68,11 +510,23 @@ func Load() (*Config, error) {
 			Format: "json",
 		},
 		Collect: CollectConfig{
-			Sources:     []string{},
-			Workers:     4,
-			Storage:     "memory",
-			StoragePath: "./logs",
-			BatchSize:   100,
+			Sources:       []string{},
+			Workers:       4,
+			Storage:       "memory",
+			StoragePath:   "./logs",
+			BatchSize:     100,
+			BatchInterval: processor.DefaultStoreBatchInterval,
+			DeadLetter: DeadLetterConfig{
+				Format: "raw",
+			},
+			Overflow: string(worker.OverflowBlock),
+			Autoscale: AutoscaleConfig{
+				Interval: worker.DefaultScaleInterval,
+				Cooldown: worker.DefaultScaleCooldown,
+			},
+			Spool: SpoolConfig{
+				Sync: string(queue.SyncInterval),
+			},
 		},
 		API: APIConfig{
 			Host:        "0.0.0.0",
@@ -93,6 +547,30 @@ func Load() (*Config, error) {
 			Directory: "./plugins",
 			Enabled:   []string{},
 			Config:    make(map[string]string),
+			OnError:   string(processor.PluginErrorIgnore),
+			Output: PluginOutputConfig{
+				BatchSize:     processor.DefaultOutputBatchSize,
+				BufferSize:    processor.DefaultOutputBufferSize,
+				FlushInterval: processor.DefaultOutputFlushInterval,
+				Retries:       processor.DefaultOutputRetries,
+				RetryBackoff:  processor.DefaultOutputRetryBackoff,
+			},
+		},
+		Levels: LevelsConfig{
+			Aliases: make(map[string]string),
+			Numeric: models.NumericSchemeAuto,
+		},
+		Timestamps: TimestampsConfig{
+			Timezone: "UTC",
+			MaxAge:   parser.DefaultMaxTimestampAge,
+			MaxAhead: parser.DefaultMaxTimestampAhead,
+			Sources:  []SourceTimezoneConfig{},
+		},
+		Transform: TransformConfig{
+			GeoIP: GeoIPConfig{
+				CacheSize:      8192,
+				ReloadInterval: time.Minute,
+			},
 		},
 	}
 
@@ -151,6 +629,20 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid worker count: %d (must be at least 1)", config.Collect.Workers)
 	}
 
+	// Validate the work queue settings
+	if _, err := config.Collect.NewPool(); err != nil {
+		return fmt.Errorf("invalid collect settings: %w", err)
+	}
+	if config.Collect.Spool.Enabled() {
+		if _, err := config.Collect.Spool.validate(); err != nil {
+			return fmt.Errorf("invalid spool settings: %w", err)
+		}
+		// A dropped job would leave its spooled batch unacknowledged forever
+		if strings.EqualFold(config.Collect.Overflow, string(worker.OverflowDrop)) {
+			return fmt.Errorf("invalid collect settings: the drop overflow policy can't be used with a spool")
+		}
+	}
+
 	// Validate storage type
 	validStorage := map[string]bool{
 		"memory": true,
@@ -160,10 +652,79 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid storage type: %s", config.Collect.Storage)
 	}
 
+	// Validate dead-letter capture
+	switch strings.ToLower(config.Collect.DeadLetter.Type) {
+	case "":
+	case "file", "disk":
+		if config.Collect.DeadLetter.Path == "" {
+			return fmt.Errorf("dead-letter path is required for type %s", config.Collect.DeadLetter.Type)
+		}
+	default:
+		return fmt.Errorf("invalid dead-letter type: %s (must be file or disk)", config.Collect.DeadLetter.Type)
+	}
+	if format := strings.ToLower(config.Collect.DeadLetter.Format); format != "" && format != "raw" && format != "json" {
+		return fmt.Errorf("invalid dead-letter format: %s (must be raw or json)", config.Collect.DeadLetter.Format)
+	}
+
+	// Validate plugin settings
+	if _, err := processor.ParsePluginErrorPolicy(strings.ToLower(config.Plugins.OnError)); err != nil {
+		return fmt.Errorf("invalid plugin settings: %w", err)
+	}
+	if output := config.Plugins.Output; output.BatchSize < 1 || output.BufferSize < 1 || output.FlushInterval < 0 || output.Retries < 0 || output.RetryBackoff < 0 {
+		return fmt.Errorf("invalid plugin output settings: batch-size and buffer-size must be at least 1 and the other settings can't be negative")
+	}
+
 	// Validate query limit
 	if config.Query.Limit < 1 {
 		return fmt.Errorf("invalid query limit: %d (must be at least 1)", config.Query.Limit)
 	}
 
+	// Validate level normalization
+	if _, err := config.Levels.Normalizer(); err != nil {
+		return fmt.Errorf("invalid levels configuration: %w", err)
+	}
+
+	// Validate timestamp parsing
+	if config.Timestamps.MaxAge < 0 || config.Timestamps.MaxAhead < 0 {
+		return fmt.Errorf("invalid timestamps configuration: skew limits must not be negative")
+	}
+	if _, err := config.JSON.Options(); err != nil {
+		return fmt.Errorf("invalid json settings: %w", err)
+	}
+	if _, err := config.Timestamps.Parser(); err != nil {
+		return fmt.Errorf("invalid timestamps configuration: %w", err)
+	}
+
+	// Validate pipeline stages (plugins are only checked for a name until they are loaded,
+	// GeoIP databases and lookup tables until they are opened)
+	if _, err := config.stages(nil, false); err != nil {
+		return fmt.Errorf("invalid pipeline configuration: %w", err)
+	}
+
+	// Validate routes and their outputs
+	if err := config.validateRouting(); err != nil {
+		return fmt.Errorf("invalid routing configuration: %w", err)
+	}
+
+	// Validate redaction rules
+	if _, err := config.Transform.Redactor(); err != nil {
+		return fmt.Errorf("invalid transform configuration: %w", err)
+	}
+
+	// Validate IP enrichment
+	if config.Transform.GeoIP.Field != "" && len(config.Transform.GeoIP.Databases) == 0 {
+		return fmt.Errorf("invalid geoip configuration: at least one database is required")
+	}
+	if config.Transform.GeoIP.CacheSize < 0 || config.Transform.GeoIP.ReloadInterval < 0 {
+		return fmt.Errorf("invalid geoip configuration: cache size and reload interval must not be negative")
+	}
+
+	// Validate lookups (their files are read when collection starts)
+	for _, lookup := range config.Transform.Lookups {
+		if err := lookup.validate(); err != nil {
+			return fmt.Errorf("invalid lookup configuration: lookup %s: %w", lookup.label(), err)
+		}
+	}
+
 	return nil
 }
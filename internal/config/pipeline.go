@@ -0,0 +1,785 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/internal/processor"
+	"github.com/mariasu11/logstreamApp/internal/storage"
+	"github.com/mariasu11/logstreamApp/pkg/plugin"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+// Pipeline stage types
+const (
+	StageLevel     = "level"
+	StageRegex     = "regex"
+	StageSource    = "source"
+	StageField     = "field"
+	StageTime      = "time"
+	StageAdd       = "add"
+	StageRemove    = "remove"
+	StageRename    = "rename"
+	StageExtract   = "extract"
+	StageUserAgent = "useragent"
+	StageDedup     = "dedup"
+	StageSample    = "sample"
+	StageThrottle  = "throttle"
+	StageExpr      = "expression"
+	StageCompute   = "compute"
+	StageScript    = "script"
+	StageMetrics   = "metrics"
+	StageGeoIP     = "geoip"
+	StageLookup    = "lookup"
+	StagePlugin    = "plugin"
+)
+
+// PipelineStageConfig is one step of the processing pipeline. Which parameters apply depends on the type:
+//
+//	level      levels (+ exclude) or min-level
+//	regex      pattern (+ exclude), matched against the message
+//	source     match (+ exclude), exact sources or path.Match patterns
+//	field      field, value (+ exact)
+//	time       from and/or to (RFC 3339)
+//	expression expression: entries it holds for are kept
+//	add        field, value
+//	remove     field
+//	rename     field, to
+//	extract    pattern, fields: capture groups of the message copied to fields
+//	useragent  field (default user_agent)
+//	compute    field, expression; or expression as an assignment ("latency_ms = fields.duration * 1000")
+//	script     script (inline Lua) or file, timeout (per-entry budget, default 50ms)
+//	metrics    metrics: Prometheus metrics derived from entries (see LogMetricConfig)
+//	geoip      field, databases, cache-size, reload-interval (0 for the defaults) or static
+//	lookup     file, keys, fields, format, columns, prefix, default, reload-interval or static (see LookupConfig)
+//	dedup      fields (whole content when empty), window, mode (suppress or collapse), max-keys
+//	sample     rate, overrides (source or level, rate), keep-level (default error, or none), key
+//	throttle   rate (entries per second per source), burst, overrides (source, rate, burst), max-keys
+//	plugin     plugin, config
+type PipelineStageConfig struct {
+	Type string `mapstructure:"type"`
+	// Name labels the stage in logs and errors (defaults to the type)
+	Name string `mapstructure:"name"`
+	// Sources limits the stage to entries from these sources (exact or path.Match patterns)
+	Sources []string `mapstructure:"sources"`
+
+	Levels         []string             `mapstructure:"levels"`
+	MinLevel       string               `mapstructure:"min-level"`
+	Pattern        string               `mapstructure:"pattern"`
+	Exclude        bool                 `mapstructure:"exclude"`
+	Match          []string             `mapstructure:"match"`
+	Field          string               `mapstructure:"field"`
+	Value          interface{}          `mapstructure:"value"`
+	Exact          bool                 `mapstructure:"exact"`
+	From           string               `mapstructure:"from"`
+	To             string               `mapstructure:"to"`
+	Fields         []string             `mapstructure:"fields"`
+	Window         time.Duration        `mapstructure:"window"`
+	Mode           string               `mapstructure:"mode"`
+	MaxKeys        int                  `mapstructure:"max-keys"`
+	Rate           float64              `mapstructure:"rate"`
+	Burst          int                  `mapstructure:"burst"`
+	KeepLevel      string               `mapstructure:"keep-level"`
+	Key            string               `mapstructure:"key"`
+	Overrides      []RateOverrideConfig `mapstructure:"overrides"`
+	Expression     string               `mapstructure:"expression"`
+	Script         string               `mapstructure:"script"`
+	File           string               `mapstructure:"file"`
+	Timeout        time.Duration        `mapstructure:"timeout"`
+	Metrics        []LogMetricConfig    `mapstructure:"metrics"`
+	Databases      []string             `mapstructure:"databases"`
+	CacheSize      int                  `mapstructure:"cache-size"`
+	Format         string               `mapstructure:"format"`
+	Keys           []string             `mapstructure:"keys"`
+	Columns        []string             `mapstructure:"columns"`
+	Prefix         string               `mapstructure:"prefix"`
+	Default        *string              `mapstructure:"default"`
+	ReloadInterval time.Duration        `mapstructure:"reload-interval"`
+	Static         bool                 `mapstructure:"static"`
+	Plugin         string               `mapstructure:"plugin"`
+	Config         map[string]string    `mapstructure:"config"`
+}
+
+// RateOverrideConfig sets the rate of a sample or throttle stage for some entries.
+// Overrides are listed rather than keyed, as sources contain dots and mixed case.
+type RateOverrideConfig struct {
+	// Source is an exact source or path.Match pattern
+	Source string `mapstructure:"source"`
+	// Level is a canonical level (sample stages only)
+	Level string  `mapstructure:"level"`
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// LogMetricConfig defines a metric of a metrics stage
+type LogMetricConfig struct {
+	// Name is the full Prometheus metric name, such as http_requests_total
+	Name string `mapstructure:"name"`
+	// Type is counter, gauge or histogram
+	Type string `mapstructure:"type"`
+	Help string `mapstructure:"help"`
+	// Match is an expression selecting the entries recorded (every entry when empty)
+	Match string `mapstructure:"match"`
+	// Field holds the value: added by counters (which count entries without it), set by
+	// gauges and observed by histograms
+	Field string `mapstructure:"field"`
+	// Labels are the fields labelling the metric; source and level are the entry's own
+	Labels []string `mapstructure:"labels"`
+	// MaxSeries caps the label combinations (default 1000); the rest share an overflow series
+	MaxSeries int       `mapstructure:"max-series"`
+	Buckets   []float64 `mapstructure:"buckets"`
+}
+
+// metric builds and registers the metric with the log metrics registry
+func (c LogMetricConfig) metric() (*processor.LogMetric, error) {
+	if c.MaxSeries < 0 {
+		return nil, fmt.Errorf("max-series must not be negative")
+	}
+	m, err := processor.NewLogMetric(c.Name, strings.ToLower(c.Type))
+	if err != nil {
+		return nil, err
+	}
+	if m, err = m.WithMatch(c.Match); err != nil {
+		return nil, err
+	}
+	m = m.WithHelp(c.Help).
+		WithValueField(c.Field).
+		WithLabels(c.Labels...).
+		WithBuckets(c.Buckets...).
+		WithMaxSeries(c.MaxSeries)
+	if err := m.Register(metrics.LogRegistry()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// label returns the stage name used in errors
+func (c PipelineStageConfig) label(index int) string {
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+	return fmt.Sprintf("pipeline stage %d (%s)", index+1, name)
+}
+
+// Stage builds the processor stage. Plugin stages look their plugin up in the registry;
+// with a nil registry they are only checked for a plugin name.
+func (c PipelineStageConfig) Stage(registry *plugin.Registry) (processor.Stage, error) {
+	return c.stage(registry, true)
+}
+
+// stage builds the processor stage; unless open is set, GeoIP and lookup stages are only
+// checked and their files left unread
+func (c PipelineStageConfig) stage(registry *plugin.Registry, open bool) (processor.Stage, error) {
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+
+	var stage processor.Stage
+	switch strings.ToLower(c.Type) {
+	case StageLevel:
+		switch {
+		case c.MinLevel != "" && len(c.Levels) > 0:
+			return stage, fmt.Errorf("levels and min-level are mutually exclusive")
+		case c.MinLevel != "":
+			filter, err := processor.NewMinLevelFilter(c.MinLevel)
+			if err != nil {
+				return stage, err
+			}
+			stage = processor.NewFilterStage(name, filter)
+		case len(c.Levels) > 0:
+			stage = processor.NewFilterStage(name, processor.NewLevelFilter(c.Levels, !c.Exclude))
+		default:
+			return stage, fmt.Errorf("levels or min-level is required")
+		}
+
+	case StageRegex:
+		if c.Pattern == "" {
+			return stage, fmt.Errorf("pattern is required")
+		}
+		filter, err := processor.NewRegexFilter(c.Pattern, !c.Exclude)
+		if err != nil {
+			return stage, fmt.Errorf("invalid pattern: %w", err)
+		}
+		stage = processor.NewFilterStage(name, filter)
+
+	case StageSource:
+		if len(c.Match) == 0 {
+			return stage, fmt.Errorf("match is required")
+		}
+		stage = processor.NewFilterStage(name, processor.NewSourceFilter(c.Match, !c.Exclude))
+
+	case StageField:
+		if c.Field == "" {
+			return stage, fmt.Errorf("field is required")
+		}
+		value := ""
+		if c.Value != nil {
+			value = fmt.Sprint(c.Value)
+		}
+		stage = processor.NewFilterStage(name, processor.NewFieldFilter(c.Field, value, c.Exact))
+
+	case StageTime:
+		if c.From == "" && c.To == "" {
+			return stage, fmt.Errorf("from or to is required")
+		}
+		var from, to time.Time
+		var err error
+		if c.From != "" {
+			if from, err = time.Parse(time.RFC3339, c.From); err != nil {
+				return stage, fmt.Errorf("invalid from time: %w", err)
+			}
+		}
+		if c.To != "" {
+			if to, err = time.Parse(time.RFC3339, c.To); err != nil {
+				return stage, fmt.Errorf("invalid to time: %w", err)
+			}
+		}
+		if !from.IsZero() && !to.IsZero() && to.Before(from) {
+			return stage, fmt.Errorf("to is before from")
+		}
+		stage = processor.NewFilterStage(name, processor.NewTimeRangeFilter(from, to))
+
+	case StageExpr:
+		if c.Expression == "" {
+			return stage, fmt.Errorf("expression is required")
+		}
+		filter, err := processor.NewExpressionFilter(c.Expression)
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewFilterStage(name, filter)
+
+	case StageAdd:
+		if c.Field == "" {
+			return stage, fmt.Errorf("field is required")
+		}
+		stage = processor.NewTransformerStage(name, processor.NewAddFieldTransformer(c.Field, c.Value))
+
+	case StageRemove:
+		if c.Field == "" {
+			return stage, fmt.Errorf("field is required")
+		}
+		stage = processor.NewTransformerStage(name, processor.NewRemoveFieldTransformer(c.Field))
+
+	case StageRename:
+		if c.Field == "" || c.To == "" {
+			return stage, fmt.Errorf("field and to are required")
+		}
+		stage = processor.NewTransformerStage(name, processor.NewRenameFieldTransformer(c.Field, c.To))
+
+	case StageExtract:
+		if c.Pattern == "" || len(c.Fields) == 0 {
+			return stage, fmt.Errorf("pattern and fields are required")
+		}
+		transformer, err := processor.NewRegexExtractTransformer(c.Pattern, c.Fields)
+		if err != nil {
+			return stage, fmt.Errorf("invalid pattern: %w", err)
+		}
+		if groups := transformer.Pattern.NumSubexp(); groups < len(c.Fields) {
+			return stage, fmt.Errorf("pattern has %d capture groups for %d fields", groups, len(c.Fields))
+		}
+		stage = processor.NewTransformerStage(name, transformer)
+
+	case StageCompute:
+		if c.Expression == "" {
+			return stage, fmt.Errorf("expression is required")
+		}
+		var transformer *processor.ComputeTransformer
+		var err error
+		if c.Field != "" {
+			transformer, err = processor.NewComputeTransformer(c.Field, c.Expression)
+		} else {
+			transformer, err = processor.ParseAssignment(c.Expression)
+		}
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewTransformerStage(name, transformer)
+
+	case StageScript:
+		source := c.Script
+		switch {
+		case c.Script != "" && c.File != "":
+			return stage, fmt.Errorf("script and file are mutually exclusive")
+		case c.File != "":
+			data, err := os.ReadFile(c.File)
+			if err != nil {
+				return stage, fmt.Errorf("failed to read script: %w", err)
+			}
+			source = string(data)
+		case c.Script == "":
+			return stage, fmt.Errorf("script or file is required")
+		}
+		if c.Timeout < 0 {
+			return stage, fmt.Errorf("timeout must not be negative")
+		}
+		script, err := processor.NewScriptFilter(name, source)
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewFilterStage(name, script.WithTimeout(c.Timeout))
+
+	case StageMetrics:
+		if len(c.Metrics) == 0 {
+			return stage, fmt.Errorf("metrics is required")
+		}
+		logMetrics := make([]*processor.LogMetric, 0, len(c.Metrics))
+		for i, metricConfig := range c.Metrics {
+			m, err := metricConfig.metric()
+			if err != nil {
+				return stage, fmt.Errorf("metric %d: %w", i+1, err)
+			}
+			logMetrics = append(logMetrics, m)
+		}
+		stage = processor.NewTransformerStage(name, processor.NewLogMetricsTransformer(logMetrics...))
+
+	case StageGeoIP:
+		switch {
+		case c.Field == "" || len(c.Databases) == 0:
+			return stage, fmt.Errorf("field and databases are required")
+		case c.CacheSize < 0 || c.ReloadInterval < 0:
+			return stage, fmt.Errorf("cache-size and reload-interval must not be negative")
+		case !open:
+			stage = processor.Stage{Name: name}
+		default:
+			transformer, err := c.enrichIP()
+			if err != nil {
+				return stage, err
+			}
+			stage = processor.NewTransformerStage(name, transformer)
+		}
+
+	case StageLookup:
+		lookup := c.lookup()
+		if !open {
+			if err := lookup.validate(); err != nil {
+				return stage, err
+			}
+			stage = processor.Stage{Name: name}
+			break
+		}
+		transformer, _, err := lookup.Open()
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewTransformerStage(name, transformer)
+
+	case StageUserAgent:
+		transformer, err := processor.NewUserAgentTransformer(c.Field)
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewTransformerStage(name, transformer)
+
+	case StageDedup:
+		if c.MaxKeys < 0 {
+			return stage, fmt.Errorf("max-keys must not be negative")
+		}
+		dedup, err := processor.NewDeduplicator(c.Fields, c.Window, strings.ToLower(c.Mode))
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewFilterStage(name, dedup.WithMaxKeys(c.MaxKeys))
+
+	case StageSample:
+		sampler, err := c.sampler()
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewFilterStage(name, sampler)
+
+	case StageThrottle:
+		throttler, err := c.throttler()
+		if err != nil {
+			return stage, err
+		}
+		stage = processor.NewFilterStage(name, throttler)
+
+	case StagePlugin:
+		if c.Plugin == "" {
+			return stage, fmt.Errorf("plugin is required")
+		}
+		if registry == nil {
+			stage = processor.NewPluginStage(name, nil)
+			break
+		}
+		p, err := registry.GetPlugin(c.Plugin)
+		if err != nil {
+			return stage, err
+		}
+		if err := p.Init(c.Config); err != nil {
+			return stage, fmt.Errorf("failed to initialize plugin %s: %w", c.Plugin, err)
+		}
+		stage = processor.NewPluginStage(name, p)
+
+	case "":
+		return stage, fmt.Errorf("type is required")
+	default:
+		return stage, fmt.Errorf("unknown stage type %q", c.Type)
+	}
+
+	for _, source := range c.Sources {
+		if _, err := path.Match(source, ""); err != nil {
+			return stage, fmt.Errorf("invalid source pattern %q: %w", source, err)
+		}
+	}
+	return stage.ForSources(c.Sources...), nil
+}
+
+// sampler builds the filter of a sample stage
+func (c PipelineStageConfig) sampler() (*processor.Sampler, error) {
+	sampler, err := processor.NewSampler(c.Rate)
+	if err != nil {
+		return nil, err
+	}
+	if c.KeepLevel != "" {
+		if sampler, err = sampler.WithKeepLevel(strings.ToLower(c.KeepLevel)); err != nil {
+			return nil, fmt.Errorf("invalid keep-level: %w", err)
+		}
+	}
+	for i, override := range c.Overrides {
+		switch {
+		case (override.Source == "") == (override.Level == ""):
+			return nil, fmt.Errorf("override %d: exactly one of source and level is required", i+1)
+		case override.Source != "":
+			sampler, err = sampler.WithSourceRate(override.Source, override.Rate)
+		default:
+			sampler, err = sampler.WithLevelRate(override.Level, override.Rate)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("override %d: %w", i+1, err)
+		}
+	}
+	return sampler.WithKeyField(c.Key), nil
+}
+
+// throttler builds the filter of a throttle stage
+func (c PipelineStageConfig) throttler() (*processor.Throttler, error) {
+	if c.MaxKeys < 0 {
+		return nil, fmt.Errorf("max-keys must not be negative")
+	}
+	throttler, err := processor.NewThrottler(c.Rate, c.Burst)
+	if err != nil {
+		return nil, err
+	}
+	for i, override := range c.Overrides {
+		if override.Source == "" || override.Level != "" {
+			return nil, fmt.Errorf("override %d: throttle overrides need a source and no level", i+1)
+		}
+		if throttler, err = throttler.WithSourceLimit(override.Source, override.Rate, override.Burst); err != nil {
+			return nil, fmt.Errorf("override %d: %w", i+1, err)
+		}
+	}
+	return throttler.WithMaxSources(c.MaxKeys), nil
+}
+
+// enrichIP opens the databases of a geoip stage and builds its transformer
+func (c PipelineStageConfig) enrichIP() (*processor.EnrichIPTransformer, error) {
+	databases := make([]*processor.GeoIPDatabase, 0, len(c.Databases))
+	for _, path := range c.Databases {
+		db, err := processor.OpenGeoIPDatabase(path)
+		if err != nil {
+			for _, opened := range databases {
+				opened.Close()
+			}
+			return nil, err
+		}
+		if c.CacheSize > 0 {
+			db.WithCacheSize(c.CacheSize)
+		}
+		switch {
+		case c.Static:
+			db.WithReloadInterval(0)
+		case c.ReloadInterval > 0:
+			db.WithReloadInterval(c.ReloadInterval)
+		}
+		databases = append(databases, db)
+	}
+	return processor.NewEnrichIPTransformer(c.Field, databases...), nil
+}
+
+// lookup returns the table settings of a lookup stage
+func (c PipelineStageConfig) lookup() LookupConfig {
+	return LookupConfig{
+		Name:           c.Name,
+		File:           c.File,
+		Format:         c.Format,
+		Keys:           c.Keys,
+		Fields:         c.Fields,
+		Columns:        c.Columns,
+		Prefix:         c.Prefix,
+		Default:        c.Default,
+		ReloadInterval: c.ReloadInterval,
+		Static:         c.Static,
+	}
+}
+
+// Stages builds every pipeline stage in order
+func (c *Config) Stages(registry *plugin.Registry) ([]processor.Stage, error) {
+	return c.stages(registry, true)
+}
+
+// stages builds the pipeline stages; see PipelineStageConfig.stage for open
+func (c *Config) stages(registry *plugin.Registry, open bool) ([]processor.Stage, error) {
+	stages := make([]processor.Stage, 0, len(c.Pipeline))
+	for i, stageConfig := range c.Pipeline {
+		stage, err := stageConfig.stage(registry, open)
+		if err != nil {
+			closeStages(stages)
+			return nil, fmt.Errorf("%s: %w", stageConfig.label(i), err)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// closeStages releases the GeoIP databases opened by the stages of a pipeline that isn't used
+func closeStages(stages []processor.Stage) {
+	for _, stage := range stages {
+		if enrich, ok := stage.Transformer.(*processor.EnrichIPTransformer); ok {
+			for _, db := range enrich.Databases() {
+				db.Close()
+			}
+		}
+	}
+}
+
+// NeedsPlugins reports whether any pipeline stage uses a plugin
+func (c *Config) NeedsPlugins() bool {
+	for _, stage := range c.Pipeline {
+		if strings.ToLower(stage.Type) == StagePlugin {
+			return true
+		}
+	}
+	return false
+}
+
+// NewProcessor builds a processor with the configured level normalization,
+// timestamp parsing and pipeline stages
+func (c *Config) NewProcessor(store storage.Storage, pool *worker.Pool, registry *plugin.Registry) (*processor.LogProcessor, error) {
+	levels, err := c.Levels.Normalizer()
+	if err != nil {
+		return nil, fmt.Errorf("invalid level normalization settings: %w", err)
+	}
+	timestamps, err := c.Timestamps.Parser()
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp settings: %w", err)
+	}
+	jsonOptions, err := c.JSON.Options()
+	if err != nil {
+		return nil, fmt.Errorf("invalid json settings: %w", err)
+	}
+	if registry == nil && c.NeedsPlugins() {
+		return nil, fmt.Errorf("the pipeline has plugin stages but no plugin registry was given")
+	}
+	policy, err := processor.ParsePluginErrorPolicy(strings.ToLower(c.Plugins.OnError))
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin settings: %w", err)
+	}
+	stages, err := c.Stages(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	proc := processor.NewLogProcessor(store, pool).
+		WithLevelNormalizer(levels).
+		WithTimestampParser(timestamps).
+		WithJSONOptions(jsonOptions).
+		WithOrderingKey(c.Collect.OrderBy).
+		WithStoreBatching(c.Collect.BatchSize, c.Collect.BatchInterval).
+		WithPluginErrorPolicy(policy)
+	for _, stage := range stages {
+		// Keep an interpreter per worker
+		if script, ok := stage.Filter.(*processor.ScriptFilter); ok && c.Collect.Workers > 0 {
+			script.WithPoolSize(max(c.Collect.Workers, c.Collect.Autoscale.MaxWorkers))
+		}
+		proc.AddStage(stage)
+	}
+
+	if registry != nil {
+		outputs, err := c.PluginOutputs(registry)
+		if err != nil {
+			closeStages(stages)
+			return nil, err
+		}
+		for _, output := range outputs {
+			proc.AddOutput(output)
+		}
+	}
+	return proc, nil
+}
+
+// Pipeline is a processor with everything the configuration attaches to it besides its
+// stages: dead-letter capture, routing, GeoIP and lookup enrichment, and redaction
+type Pipeline struct {
+	Processor *processor.LogProcessor
+	// DeadLetter captures unparsed lines; nil when disabled
+	DeadLetter processor.DeadLetterSink
+	// Routed are the storages opened for routing outputs
+	Routed []storage.Storage
+	// GeoIP are the databases consulted by geoip stages and GeoIP enrichment
+	GeoIP []*processor.GeoIPDatabase
+	// Lookups are the tables joined against entry fields by lookup stages and lookups
+	Lookups []*processor.LookupTable
+}
+
+// NewPipeline builds the processor and attaches the rest of the configured pipeline to it,
+// so every command ingesting entries processes them the same way. Close releases what it
+// opened; the store is left to the caller.
+func (c *Config) NewPipeline(store storage.Storage, pool *worker.Pool, registry *plugin.Registry) (*Pipeline, error) {
+	proc, err := c.NewProcessor(store, pool, registry)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pipeline{Processor: proc}
+	for _, stage := range proc.Stages() {
+		switch enrich := stage.Transformer.(type) {
+		case *processor.EnrichIPTransformer:
+			p.GeoIP = append(p.GeoIP, enrich.Databases()...)
+		case *processor.LookupTransformer:
+			p.Lookups = append(p.Lookups, enrich.Table())
+		}
+	}
+	if err := c.attach(p, store); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// attach opens the dead-letter sink, routes and enrichment tables of a pipeline
+func (c *Config) attach(p *Pipeline, store storage.Storage) error {
+	// Capture lines no parser could handle
+	deadLetter := c.Collect.DeadLetter
+	switch strings.ToLower(deadLetter.Type) {
+	case "file":
+		sink, err := processor.NewFileDeadLetter(deadLetter.Path, strings.ToLower(deadLetter.Format))
+		if err != nil {
+			return fmt.Errorf("failed to open dead-letter file: %w", err)
+		}
+		p.DeadLetter = sink
+	case "disk":
+		deadStore, err := storage.NewDiskStorage(deadLetter.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open dead-letter storage: %w", err)
+		}
+		p.DeadLetter = processor.NewStorageDeadLetter(deadStore)
+	}
+	if p.DeadLetter != nil {
+		p.Processor.WithDeadLetter(p.DeadLetter, deadLetter.Keep)
+	}
+
+	// Route processed entries to their outputs
+	if c.HasRouting() {
+		router, routed, err := c.NewRouter(store)
+		if err != nil {
+			return fmt.Errorf("failed to set up routing: %w", err)
+		}
+		p.Routed = routed
+		p.Processor.WithRouter(router)
+	}
+
+	// Enrich IP addresses from local MaxMind databases. Like the lookups, this runs after
+	// every pipeline stage; geoip and lookup stages enrich entries at their own position.
+	if geo := c.Transform.GeoIP; geo.Field != "" {
+		for _, path := range geo.Databases {
+			db, err := processor.OpenGeoIPDatabase(path)
+			if err != nil {
+				return err
+			}
+			db.WithCacheSize(geo.CacheSize).WithReloadInterval(geo.ReloadInterval)
+			p.GeoIP = append(p.GeoIP, db)
+		}
+		p.Processor.AddTransformer(processor.NewEnrichIPTransformer(geo.Field, p.GeoIP...))
+	}
+
+	// Join entry fields against local lookup tables
+	for _, lookup := range c.Transform.Lookups {
+		transformer, table, err := lookup.Open()
+		if err != nil {
+			return err
+		}
+		p.Lookups = append(p.Lookups, table)
+		p.Processor.AddTransformer(transformer)
+	}
+
+	// Redact sensitive data last, so enrichment still sees the original values
+	redactor, err := c.Transform.Redactor()
+	if err != nil {
+		return fmt.Errorf("invalid redaction rules: %w", err)
+	}
+	if redactor != nil {
+		p.Processor.AddTransformer(redactor)
+	}
+	return nil
+}
+
+// Close releases the dead-letter sink, routed storages and GeoIP databases
+func (p *Pipeline) Close() error {
+	var errs []error
+	for _, routed := range p.Routed {
+		if err := routed.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close routed storage: %w", err))
+		}
+	}
+	if p.DeadLetter != nil {
+		if err := p.DeadLetter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close dead-letter capture: %w", err))
+		}
+	}
+	for _, db := range p.GeoIP {
+		db.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// PluginOutputs wraps the registry's output plugins for the processor. Plugins not already
+// set up by a pipeline stage are initialized with the plugins config.
+func (c *Config) PluginOutputs(registry *plugin.Registry) ([]*processor.PluginOutput, error) {
+	output := c.Plugins.Output
+	var outputs []*processor.PluginOutput
+	for _, p := range registry.OutputPlugins() {
+		if !c.usedByStage(p.Name()) {
+			if err := p.Init(c.Plugins.Config); err != nil {
+				return nil, fmt.Errorf("failed to initialize output plugin %s: %w", p.Name(), err)
+			}
+		}
+		outputs = append(outputs, processor.NewPluginOutput(p, output.BatchSize, output.FlushInterval).
+			WithBufferSize(output.BufferSize).
+			WithRetry(output.Retries, output.RetryBackoff))
+	}
+	return outputs, nil
+}
+
+// PluginInputs returns the registry's input plugins, initializing those not already set up
+// by a pipeline stage or as an output plugin with the plugins config. It is called after
+// NewProcessor.
+func (c *Config) PluginInputs(registry *plugin.Registry) ([]plugin.InputPlugin, error) {
+	inputs := registry.InputPlugins()
+	for _, p := range inputs {
+		if _, isOutput := p.(plugin.OutputPlugin); isOutput || c.usedByStage(p.Name()) {
+			continue
+		}
+		if err := p.Init(c.Plugins.Config); err != nil {
+			return nil, fmt.Errorf("failed to initialize input plugin %s: %w", p.Name(), err)
+		}
+	}
+	return inputs, nil
+}
+
+// usedByStage reports whether a pipeline stage runs the named plugin
+func (c *Config) usedByStage(name string) bool {
+	for _, stage := range c.Pipeline {
+		if strings.ToLower(stage.Type) == StagePlugin && stage.Plugin == name {
+			return true
+		}
+	}
+	return false
+}
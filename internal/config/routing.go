@@ -0,0 +1,232 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/processor"
+	"github.com/mariasu11/logstreamApp/internal/storage"
+)
+
+// MainOutput is the reserved output name for the collector's own storage
+const MainOutput = "main"
+
+// Output types
+const (
+	OutputMemory  = "memory"
+	OutputDisk    = "disk"
+	OutputWebhook = "webhook"
+)
+
+// OutputConfig defines a named destination routes can send entries to
+type OutputConfig struct {
+	Name string `mapstructure:"name"`
+	// Type is memory, disk or webhook
+	Type string `mapstructure:"type"`
+	// Path is the directory of disk storage
+	Path string `mapstructure:"path"`
+	// Capacity bounds memory storage, which then drops its oldest entries
+	Capacity int `mapstructure:"capacity"`
+	// URL is the webhook endpoint
+	URL string `mapstructure:"url"`
+	// Headers are added to webhook requests
+	Headers map[string]string `mapstructure:"headers"`
+	// Timeout bounds webhook requests
+	Timeout time.Duration `mapstructure:"timeout"`
+	// BatchSize is the most entries posted to a webhook at once
+	BatchSize int `mapstructure:"batch-size"`
+	// FlushInterval is the longest an entry waits for its webhook batch to fill
+	FlushInterval time.Duration `mapstructure:"flush-interval"`
+	// BufferSize is how many entries may wait for a webhook before new ones are refused
+	BufferSize int `mapstructure:"buffer-size"`
+}
+
+// RoutingConfig holds the routes deciding where processed entries are delivered
+type RoutingConfig struct {
+	Routes []RouteConfig `mapstructure:"routes"`
+	// Default lists the outputs of entries no route stopped (defaults to main)
+	Default []string `mapstructure:"default"`
+}
+
+// RouteConfig is a named route
+type RouteConfig struct {
+	Name string `mapstructure:"name"`
+	// Filters select the entries of the route; all must pass. Only filter stage types are allowed.
+	Filters []PipelineStageConfig `mapstructure:"filters"`
+	// Outputs are the names of the outputs matching entries are sent to
+	Outputs []string `mapstructure:"outputs"`
+	// Continue also offers matching entries to later routes
+	Continue bool `mapstructure:"continue"`
+}
+
+// validateRouting checks routes and outputs without opening any of them
+func (c *Config) validateRouting() error {
+	outputs := map[string]bool{MainOutput: true}
+	for i, output := range c.Outputs {
+		if output.Name == "" {
+			return fmt.Errorf("output %d has no name", i+1)
+		}
+		if outputs[output.Name] {
+			return fmt.Errorf("duplicate output name %q", output.Name)
+		}
+		outputs[output.Name] = true
+
+		switch strings.ToLower(output.Type) {
+		case OutputMemory:
+			if output.Capacity < 0 {
+				return fmt.Errorf("output %s: capacity must not be negative", output.Name)
+			}
+		case OutputDisk:
+			if output.Path == "" {
+				return fmt.Errorf("output %s: path is required", output.Name)
+			}
+		case OutputWebhook:
+			if !strings.HasPrefix(output.URL, "http://") && !strings.HasPrefix(output.URL, "https://") {
+				return fmt.Errorf("output %s: an http(s) url is required", output.Name)
+			}
+			if output.BatchSize < 0 || output.FlushInterval < 0 || output.BufferSize < 0 {
+				return fmt.Errorf("output %s: batch-size, flush-interval and buffer-size must not be negative", output.Name)
+			}
+		default:
+			return fmt.Errorf("output %s: invalid type %q (must be memory, disk or webhook)", output.Name, output.Type)
+		}
+	}
+
+	routes := make(map[string]bool)
+	for i, route := range c.Routing.Routes {
+		if route.Name == "" {
+			return fmt.Errorf("route %d has no name", i+1)
+		}
+		if route.Name == processor.DefaultRouteName || routes[route.Name] {
+			return fmt.Errorf("duplicate route name %q", route.Name)
+		}
+		routes[route.Name] = true
+
+		if len(route.Outputs) == 0 {
+			return fmt.Errorf("route %s has no outputs", route.Name)
+		}
+		for _, name := range route.Outputs {
+			if !outputs[name] {
+				return fmt.Errorf("route %s: unknown output %q", route.Name, name)
+			}
+		}
+		if _, err := route.filter(); err != nil {
+			return fmt.Errorf("route %s: %w", route.Name, err)
+		}
+	}
+	for _, name := range c.Routing.Default {
+		if !outputs[name] {
+			return fmt.Errorf("default route: unknown output %q", name)
+		}
+	}
+
+	return nil
+}
+
+// filter builds the route predicate from its filter stages
+func (r RouteConfig) filter() (processor.Filter, error) {
+	filters := make([]processor.Filter, 0, len(r.Filters))
+	for i, stageConfig := range r.Filters {
+		if len(stageConfig.Sources) > 0 {
+			return nil, fmt.Errorf("filter %d: sources can't scope a route filter, use a source filter instead", i+1)
+		}
+		// These stages modify the entry, which every route shares
+		switch strings.ToLower(stageConfig.Type) {
+		case StageSample, StageThrottle, StageScript, StageGeoIP, StageLookup:
+			return nil, fmt.Errorf("filter %d: %q can't select a route", i+1, stageConfig.Type)
+		}
+		stage, err := stageConfig.Stage(nil)
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", i+1, err)
+		}
+		if _, holds := stage.Filter.(processor.Flusher); stage.Filter == nil || holds {
+			return nil, fmt.Errorf("filter %d: %q can't select a route", i+1, stageConfig.Type)
+		}
+		filters = append(filters, stage.Filter)
+	}
+	return processor.NewCompositeFilter(filters...), nil
+}
+
+// HasRouting reports whether entries are routed rather than stored in the main storage only
+func (c *Config) HasRouting() bool {
+	return len(c.Routing.Routes) > 0 || len(c.Routing.Default) > 0
+}
+
+// NewRouter builds the configured router around the main storage.
+// It returns the storages it opened, which the caller must close.
+func (c *Config) NewRouter(main storage.Storage) (*processor.Router, []storage.Storage, error) {
+	if err := c.validateRouting(); err != nil {
+		return nil, nil, err
+	}
+
+	targets := map[string]processor.Target{
+		MainOutput: processor.NewStorageTarget(MainOutput, main),
+	}
+	var opened []storage.Storage
+	closeOpened := func() {
+		for _, s := range opened {
+			s.Close()
+		}
+	}
+
+	for _, output := range c.Outputs {
+		switch strings.ToLower(output.Type) {
+		case OutputMemory:
+			memory := storage.NewMemoryStorage()
+			if output.Capacity > 0 {
+				memory.WithCapacity(output.Capacity)
+			}
+			opened = append(opened, memory)
+			targets[output.Name] = processor.NewStorageTarget(output.Name, memory)
+		case OutputDisk:
+			disk, err := storage.NewDiskStorage(output.Path)
+			if err != nil {
+				closeOpened()
+				return nil, nil, fmt.Errorf("output %s: %w", output.Name, err)
+			}
+			opened = append(opened, disk)
+			targets[output.Name] = processor.NewStorageTarget(output.Name, disk)
+		case OutputWebhook:
+			webhook := processor.NewWebhookTarget(output.Name, output.URL).
+				WithBufferSize(output.BufferSize)
+			if output.Timeout > 0 {
+				webhook.WithTimeout(output.Timeout)
+			}
+			if output.BatchSize > 0 || output.FlushInterval > 0 {
+				size, interval := processor.DefaultOutputBatchSize, processor.DefaultOutputFlushInterval
+				if output.BatchSize > 0 {
+					size = output.BatchSize
+				}
+				if output.FlushInterval > 0 {
+					interval = output.FlushInterval
+				}
+				webhook.WithBatching(size, interval)
+			}
+			for key, value := range output.Headers {
+				webhook.WithHeader(key, value)
+			}
+			targets[output.Name] = webhook
+		}
+	}
+
+	lookup := func(names []string) []processor.Target {
+		result := make([]processor.Target, 0, len(names))
+		for _, name := range names {
+			result = append(result, targets[name])
+		}
+		return result
+	}
+
+	defaults := c.Routing.Default
+	if len(defaults) == 0 {
+		defaults = []string{MainOutput}
+	}
+	router := processor.NewRouter(lookup(defaults)...)
+	for _, route := range c.Routing.Routes {
+		filter, _ := route.filter()
+		router.AddRoute(processor.NewRoute(route.Name, filter, lookup(route.Outputs)...).WithContinue(route.Continue))
+	}
+
+	return router, opened, nil
+}
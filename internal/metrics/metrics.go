@@ -1,10 +1,12 @@
 package metrics
 
 import (
+        "net/http"
         "sync"
 
         "github.com/prometheus/client_golang/prometheus"
         "github.com/prometheus/client_golang/prometheus/promauto"
+        "github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Metrics holds all the Prometheus metrics for the application
@@ -15,13 +17,45 @@ type Metrics struct {
         LogEntriesProcessed prometheus.Counter
         LogEntriesFiltered prometheus.Counter
         LogEntriesErrored prometheus.Counter
+        LogEntriesDeduplicated prometheus.Counter
+        LogEntriesSampledOut prometheus.Counter
+        ThrottledEntries *prometheus.CounterVec
         LogProcessingTime prometheus.Histogram
 
+        // Parsing Metrics
+        ParserResults *prometheus.CounterVec
+        LogEntriesUnparsed prometheus.Counter
+        DeadLetterEntries prometheus.Counter
+        DeadLetterErrors prometheus.Counter
+
+        // Transformation Metrics
+        Redactions *prometheus.CounterVec
+        ScriptErrors *prometheus.CounterVec
+        LogMetricSeriesOverflow *prometheus.CounterVec
+
+        // Routing Metrics
+        RouteEntries *prometheus.CounterVec
+        RouteErrors *prometheus.CounterVec
+        WebhookEntries *prometheus.CounterVec
+
+        // Plugin Metrics
+        PluginErrors *prometheus.CounterVec
+        PluginOutputEntries *prometheus.CounterVec
+
         // Worker Pool Metrics
         WorkersActive prometheus.Gauge
         WorkQueueSize prometheus.Gauge
         WorkItemsProcessed prometheus.Counter
         WorkItemsErrored prometheus.Counter
+        WorkItemsRejected prometheus.Counter
+        WorkItemsDropped prometheus.Counter
+        WorkItemsKeyLimited prometheus.Counter
+        WorkLaneQueueSize *prometheus.GaugeVec
+
+        // Spool Metrics
+        SpoolBytes prometheus.Gauge
+        SpoolBatches prometheus.Gauge
+        SpoolRetries prometheus.Counter
         WorkerProcessingTime prometheus.Histogram
 
         // Storage Metrics
@@ -29,6 +63,7 @@ type Metrics struct {
         StorageErrors *prometheus.CounterVec
         StorageSize prometheus.Gauge
         QueryTime prometheus.Histogram
+        StorageBatchSize prometheus.Histogram
 
         // API Metrics
         APIRequestsTotal *prometheus.CounterVec
@@ -39,6 +74,8 @@ type Metrics struct {
 var (
         metrics *Metrics
         once sync.Once
+
+        logRegistry = prometheus.NewRegistry()
 )
 
 // GetMetrics returns the singleton metrics instance
@@ -51,6 +88,21 @@ func GetMetrics() *Metrics {
         return metrics
 }
 
+// LogRegistry returns the registry of the metrics derived from log entries. It is kept apart
+// from the default registry so user-defined names can't collide with the application's own.
+func LogRegistry() *prometheus.Registry {
+        return logRegistry
+}
+
+// Handler serves the application metrics together with the metrics derived from log entries
+func Handler() http.Handler {
+        gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, logRegistry}
+        return promhttp.InstrumentMetricHandler(
+                prometheus.DefaultRegisterer,
+                promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}),
+        )
+}
+
 func initMetrics() *Metrics {
         return &Metrics{
                 // Log Processing Metrics
@@ -74,12 +126,104 @@ func initMetrics() *Metrics {
                         Name: "logstream_log_entries_errored_total",
                         Help: "The total number of log entries that had processing errors",
                 }),
+                LogEntriesDeduplicated: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_log_entries_deduplicated_total",
+                        Help: "The total number of repeated log entries dropped or collapsed by deduplication",
+                }),
+                LogEntriesSampledOut: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_log_entries_sampled_out_total",
+                        Help: "The total number of log entries dropped by sampling",
+                }),
+                ThrottledEntries: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_log_entries_throttled_total",
+                                Help: "The total number of log entries dropped by throttling, by source",
+                        },
+                        []string{"source"},
+                ),
                 LogProcessingTime: promauto.NewHistogram(prometheus.HistogramOpts{
                         Name: "logstream_log_processing_duration_seconds",
                         Help: "The time taken to process a log entry",
                         Buckets: prometheus.DefBuckets,
                 }),
 
+                // Parsing Metrics
+                ParserResults: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_parser_results_total",
+                                Help: "The total number of parse attempts by parser and result (success, failure)",
+                        },
+                        []string{"parser", "result"},
+                ),
+                LogEntriesUnparsed: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_log_entries_unparsed_total",
+                        Help: "The total number of raw log entries no parser could handle",
+                }),
+                DeadLetterEntries: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_dead_letter_entries_total",
+                        Help: "The total number of unparsed log entries written to the dead-letter sink",
+                }),
+                DeadLetterErrors: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_dead_letter_errors_total",
+                        Help: "The total number of unparsed log entries that could not be written to the dead-letter sink",
+                }),
+
+                // Transformation Metrics
+                Redactions: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_redactions_total",
+                                Help: "The total number of sensitive values redacted by rule",
+                        },
+                        []string{"rule"},
+                ),
+                ScriptErrors: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_script_errors_total",
+                                Help: "The total number of script calls that failed or ran out of time, by script",
+                        },
+                        []string{"script"},
+                ),
+                LogMetricSeriesOverflow: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_log_metric_series_overflow_total",
+                                Help: "The total number of observations of log-derived metrics folded into the overflow series, by metric",
+                        },
+                        []string{"metric"},
+                ),
+
+                // Routing Metrics
+                RouteEntries: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_route_entries_total",
+                                Help: "The total number of log entries delivered by route",
+                        },
+                        []string{"route"},
+                ),
+                RouteErrors: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_route_errors_total",
+                                Help: "The total number of failed deliveries by route and target",
+                        },
+                        []string{"route", "target"},
+                ),
+                WebhookEntries: promauto.NewCounterVec(
+                        prometheus.CounterOpts{
+                                Name: "logstream_webhook_entries_total",
+                                Help: "The total number of entries posted to webhooks by target and result (sent, dropped, overflow)",
+                        },
+                        []string{"target", "result"},
+                ),
+
+                // Plugin Metrics
+                PluginErrors: promauto.NewCounterVec(prometheus.CounterOpts{
+                        Name: "logstream_plugin_errors_total",
+                        Help: "The total number of plugin errors by plugin and operation (process, output, input)",
+                }, []string{"plugin", "operation"}),
+                PluginOutputEntries: promauto.NewCounterVec(prometheus.CounterOpts{
+                        Name: "logstream_plugin_output_entries_total",
+                        Help: "The total number of entries handed to output plugins by plugin and result (sent, dropped)",
+                }, []string{"plugin", "result"}),
+
                 // Worker Pool Metrics
                 WorkersActive: promauto.NewGauge(prometheus.GaugeOpts{
                         Name: "logstream_workers_active",
@@ -97,6 +241,36 @@ func initMetrics() *Metrics {
                         Name: "logstream_work_items_errored_total",
                         Help: "The total number of work items that resulted in errors",
                 }),
+                WorkItemsRejected: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_work_items_rejected_total",
+                        Help: "The total number of work items refused because the work queue was full, and reported to the submitter",
+                }),
+                WorkItemsDropped: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_work_items_dropped_total",
+                        Help: "The total number of work items discarded because the work queue was full",
+                }),
+                WorkItemsKeyLimited: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_work_items_key_limited_total",
+                        Help: "The total number of keyed work items that found their key's share of a lane used up",
+                }),
+                WorkLaneQueueSize: promauto.NewGaugeVec(prometheus.GaugeOpts{
+                        Name: "logstream_work_lane_queue_size",
+                        Help: "The number of keyed work items waiting in each worker lane",
+                }, []string{"lane"}),
+
+                // Spool Metrics
+                SpoolBytes: promauto.NewGauge(prometheus.GaugeOpts{
+                        Name: "logstream_spool_size_bytes",
+                        Help: "The size of the disk spool in bytes",
+                }),
+                SpoolBatches: promauto.NewGauge(prometheus.GaugeOpts{
+                        Name: "logstream_spool_batches",
+                        Help: "The number of spooled batches not yet acknowledged",
+                }),
+                SpoolRetries: promauto.NewCounter(prometheus.CounterOpts{
+                        Name: "logstream_spool_delivery_retries_total",
+                        Help: "The total number of attempts to deliver a spooled entry again after the storage refused it",
+                }),
                 WorkerProcessingTime: promauto.NewHistogram(prometheus.HistogramOpts{
                         Name: "logstream_worker_processing_duration_seconds",
                         Help: "The time taken by a worker to process a work item",
@@ -127,6 +301,11 @@ func initMetrics() *Metrics {
                         Help: "The time taken to execute a query",
                         Buckets: prometheus.DefBuckets,
                 }),
+                StorageBatchSize: promauto.NewHistogram(prometheus.HistogramOpts{
+                        Name: "logstream_storage_batch_size",
+                        Help: "The number of entries written to the storage per batch",
+                        Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+                }),
 
                 // API Metrics
                 APIRequestsTotal: promauto.NewCounterVec(
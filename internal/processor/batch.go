@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/internal/storage"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+// DefaultStoreBatchInterval is the longest an entry waits for its batch to fill by default
+const DefaultStoreBatchInterval = 100 * time.Millisecond
+
+// storeBatcher accumulates processed entries and writes them to the storage in batches, once
+// a batch is full or its first entry has waited for the interval. Each entry's outcome is
+// reported to its callback when its batch is written. Batches are written in the order they
+// were filled.
+type storeBatcher struct {
+	storage storage.Storage
+	batches *worker.BatchProcessor[pendingEntry]
+	metrics *metrics.Metrics
+}
+
+// pendingEntry is an entry waiting for its batch, with the callback reporting its outcome
+type pendingEntry struct {
+	entry *models.LogEntry
+	done  func(error)
+}
+
+// newStoreBatcher creates a batcher writing batches of up to size entries
+func newStoreBatcher(store storage.Storage, size int, interval time.Duration) *storeBatcher {
+	b := &storeBatcher{
+		storage: store,
+		metrics: metrics.GetMetrics(),
+	}
+	// Batches are written by the goroutine filling them, usually a worker, which keeps them
+	// in order and slows the workers down to the storage's pace
+	b.batches = worker.NewBatchProcessor(nil, size, interval, b.write)
+	return b
+}
+
+// add queues an entry, writing the batch when it is full. done may be nil.
+func (b *storeBatcher) add(ctx context.Context, entry *models.LogEntry, done func(error)) {
+	// Never closed, and write reports failures to the entries themselves
+	_ = b.batches.Add(ctx, pendingEntry{entry: entry, done: done})
+}
+
+// flush writes the pending entries and waits for the batches being written
+func (b *storeBatcher) flush(ctx context.Context) {
+	_ = b.batches.Flush(ctx)
+}
+
+// write stores a batch and reports each entry's outcome
+func (b *storeBatcher) write(ctx context.Context, batch []pendingEntry) error {
+	entries := make([]*models.LogEntry, len(batch))
+	for i, pending := range batch {
+		entries[i] = pending.entry
+	}
+	err := storage.StoreBatch(ctx, b.storage, entries)
+	b.metrics.StorageBatchSize.Observe(float64(len(entries)))
+
+	var batchErr *storage.BatchError
+	partial := errors.As(err, &batchErr)
+	for i, pending := range batch {
+		entryErr := err
+		if partial {
+			entryErr = batchErr.Errors[i]
+		}
+		if entryErr != nil {
+			b.metrics.LogEntriesErrored.Inc()
+		} else {
+			b.metrics.LogEntriesProcessed.Inc()
+		}
+		report(pending.done, entryErr)
+	}
+	return nil
+}
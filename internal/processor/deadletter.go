@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/storage"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// DeadLetterSink receives log entries whose raw data no parser could handle,
+// so they can be inspected and reprocessed later
+type DeadLetterSink interface {
+	// Write records an unparsed entry
+	Write(ctx context.Context, entry *models.LogEntry) error
+	// Close flushes and releases the sink
+	Close() error
+}
+
+// StorageDeadLetter stores unparsed entries in a separate storage backend
+type StorageDeadLetter struct {
+	storage storage.Storage
+}
+
+// NewStorageDeadLetter creates a dead-letter sink backed by a storage
+func NewStorageDeadLetter(storage storage.Storage) *StorageDeadLetter {
+	return &StorageDeadLetter{storage: storage}
+}
+
+// Write stores a copy of the entry with the raw line as its message
+func (d *StorageDeadLetter) Write(ctx context.Context, entry *models.LogEntry) error {
+	dead := entry.Clone()
+	if dead.RawData != "" {
+		dead.Message = dead.RawData
+	}
+	return d.storage.Store(ctx, dead)
+}
+
+// Close closes the underlying storage
+func (d *StorageDeadLetter) Close() error {
+	return d.storage.Close()
+}
+
+// Dead-letter file formats
+const (
+	// DeadLetterFormatRaw writes the raw lines only, so the file can be fed back to a collector
+	DeadLetterFormatRaw = "raw"
+	// DeadLetterFormatJSON writes one JSON object per line with the raw line, source, ingest time and parse error
+	DeadLetterFormatJSON = "json"
+)
+
+// deadLetterRecord is a line of a JSON dead-letter file
+type deadLetterRecord struct {
+	IngestedAt time.Time `json:"ingested_at"`
+	Source     string    `json:"source"`
+	Error      string    `json:"error,omitempty"`
+	Raw        string    `json:"raw"`
+}
+
+// FileDeadLetter appends unparsed raw lines to a file
+type FileDeadLetter struct {
+	file   *os.File
+	writer *bufio.Writer
+	format string
+	mu     sync.Mutex
+}
+
+// NewFileDeadLetter opens (or creates) a dead-letter file in the given format
+func NewFileDeadLetter(path, format string) (*FileDeadLetter, error) {
+	switch format {
+	case "":
+		format = DeadLetterFormatRaw
+	case DeadLetterFormatRaw, DeadLetterFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid dead-letter format %q (must be raw or json)", format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+
+	return &FileDeadLetter{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		format: format,
+	}, nil
+}
+
+// Write appends the entry's raw line to the file
+func (d *FileDeadLetter) Write(ctx context.Context, entry *models.LogEntry) error {
+	raw := entry.RawData
+	if raw == "" {
+		raw = entry.Message
+	}
+
+	var line []byte
+	if d.format == DeadLetterFormatJSON {
+		parseError, _ := entry.GetStringField(models.FieldParseError)
+		record, err := json.Marshal(deadLetterRecord{
+			IngestedAt: entry.IngestedAt,
+			Source:     entry.Source,
+			Error:      parseError,
+			Raw:        raw,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode dead-letter record: %w", err)
+		}
+		line = record
+	} else {
+		// Keep one entry per line even if the raw data spans several
+		line = []byte(strings.ReplaceAll(raw, "\n", "\\n"))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead-letter record: %w", err)
+	}
+	return d.writer.Flush()
+}
+
+// Close flushes and closes the file
+func (d *FileDeadLetter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.writer.Flush(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
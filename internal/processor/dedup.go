@@ -0,0 +1,290 @@
+package processor
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Deduplication modes
+const (
+	// DedupModeSuppress passes the first entry of each key and drops repeats within the window
+	DedupModeSuppress = "suppress"
+	// DedupModeCollapse holds the first entry of each key until its window ends, then emits it
+	// once with the repeat count and first/last seen times
+	DedupModeCollapse = "collapse"
+)
+
+// Fields added to collapsed entries
+const (
+	FieldRepeatCount = "repeat_count"
+	FieldFirstSeen   = "first_seen"
+	FieldLastSeen    = "last_seen"
+)
+
+// DefaultDedupWindow is the deduplication window when none is set
+const DefaultDedupWindow = time.Minute
+
+// DefaultDedupMaxKeys bounds the number of keys tracked when no limit is set
+const DefaultDedupMaxKeys = 100000
+
+// Flusher is implemented by stages that hold entries back and release them later
+type Flusher interface {
+	// Flush returns the held entries that are due at now, or every held entry when force is set
+	Flush(now time.Time, force bool) []*models.LogEntry
+}
+
+// Holder is implemented by Flushers that keep the outcome callbacks of the entries they take
+// in until the entry standing for them is released, so an entry acknowledged by its callback
+// is never lost while held back
+type Holder interface {
+	Flusher
+	// Hold is Apply for an entry whose outcome is reported to done. kept reports whether the
+	// stage took done, to be returned by Release with the entry it was held back for.
+	Hold(entry *models.LogEntry, done func(error)) (pass, kept bool)
+	// Release is Flush, returning each entry with the callbacks waiting for its outcome
+	Release(now time.Time, force bool) []HeldEntry
+}
+
+// HeldEntry is an entry released by a Holder with its own outcome callback and those of the
+// entries folded into it
+type HeldEntry struct {
+	Entry  *models.LogEntry
+	Done   func(error)
+	Folded []func(error)
+}
+
+// dedupKey identifies a group of duplicate entries
+type dedupKey [sha256.Size]byte
+
+// dedupGroup tracks the entries seen for one key
+type dedupGroup struct {
+	key       dedupKey
+	entry     *models.LogEntry
+	firstSeen time.Time
+	lastSeen  time.Time
+	count     int
+	done      func(error)
+	folded    []func(error)
+}
+
+// Deduplicator is a filter dropping repeated entries. Groups are kept in first-seen order,
+// which is also the order their windows end, so expiry and the memory bound both evict
+// from the front. It is safe for concurrent use.
+type Deduplicator struct {
+	fields  []string
+	window  time.Duration
+	mode    string
+	maxKeys int
+	clock   func() time.Time
+
+	mu     sync.Mutex
+	groups map[dedupKey]*list.Element
+	order  *list.List
+	// due holds collapsed entries evicted early, until the next flush
+	due []HeldEntry
+
+	metrics *metrics.Metrics
+}
+
+// NewDeduplicator creates a deduplicator keyed on the given fields ("message", "source",
+// "level" or entry fields), or on the whole content when no fields are given
+func NewDeduplicator(fields []string, window time.Duration, mode string) (*Deduplicator, error) {
+	switch mode {
+	case "":
+		mode = DedupModeSuppress
+	case DedupModeSuppress, DedupModeCollapse:
+	default:
+		return nil, fmt.Errorf("invalid dedup mode %q (must be suppress or collapse)", mode)
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("dedup window must not be negative")
+	}
+	if window == 0 {
+		window = DefaultDedupWindow
+	}
+
+	return &Deduplicator{
+		fields:  fields,
+		window:  window,
+		mode:    mode,
+		maxKeys: DefaultDedupMaxKeys,
+		clock:   time.Now,
+		groups:  make(map[dedupKey]*list.Element),
+		order:   list.New(),
+		metrics: metrics.GetMetrics(),
+	}, nil
+}
+
+// WithMaxKeys bounds the number of tracked keys; the oldest group is evicted beyond it
+func (d *Deduplicator) WithMaxKeys(maxKeys int) *Deduplicator {
+	if maxKeys > 0 {
+		d.maxKeys = maxKeys
+	}
+	return d
+}
+
+// WithClock sets the time source, for tests
+func (d *Deduplicator) WithClock(clock func() time.Time) *Deduplicator {
+	d.clock = clock
+	return d
+}
+
+// Len returns the number of tracked keys
+func (d *Deduplicator) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
+
+// key computes the dedup key of an entry
+func (d *Deduplicator) key(entry *models.LogEntry) dedupKey {
+	h := sha256.New()
+	write := func(value interface{}) {
+		fmt.Fprintf(h, "%v\x00", value)
+	}
+
+	if len(d.fields) > 0 {
+		for _, field := range d.fields {
+			switch field {
+			case "message":
+				write(entry.Message)
+			case "source":
+				write(entry.Source)
+			case "level":
+				write(entry.Level)
+			default:
+				value, _ := entry.GetField(field)
+				write(value)
+			}
+		}
+	} else if entry.RawData != "" {
+		write(entry.Source)
+		write(entry.RawData)
+	} else {
+		write(entry.Source)
+		write(entry.Timestamp.UnixNano())
+		write(entry.Level)
+		write(entry.Message)
+		keys := make([]string, 0, len(entry.Fields))
+		for k := range entry.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encoded, _ := json.Marshal(entry.Fields[k])
+			write(k)
+			write(string(encoded))
+		}
+	}
+
+	var key dedupKey
+	h.Sum(key[:0])
+	return key
+}
+
+// Apply implements the Filter interface
+func (d *Deduplicator) Apply(entry *models.LogEntry) bool {
+	pass, _ := d.Hold(entry, nil)
+	return pass
+}
+
+// Hold implements the Holder interface. In collapse mode, the callbacks of a group's entries
+// wait for the collapsed entry.
+func (d *Deduplicator) Hold(entry *models.LogEntry, done func(error)) (pass, kept bool) {
+	key := d.key(entry)
+	now := d.clock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+
+	if elem, ok := d.groups[key]; ok {
+		group := elem.Value.(*dedupGroup)
+		group.count++
+		group.lastSeen = now
+		d.metrics.LogEntriesDeduplicated.Inc()
+		if group.entry == nil || done == nil {
+			return false, false
+		}
+		group.folded = append(group.folded, done)
+		return false, true
+	}
+
+	group := &dedupGroup{key: key, firstSeen: now, lastSeen: now, count: 1}
+	if d.mode == DedupModeCollapse {
+		group.entry = entry
+		group.done = done
+	}
+	d.groups[key] = d.order.PushBack(group)
+
+	for d.order.Len() > d.maxKeys {
+		d.evict(d.order.Front())
+	}
+
+	// Collapsed entries are released when their window ends
+	if d.mode == DedupModeSuppress {
+		return true, false
+	}
+	return false, done != nil
+}
+
+// expire evicts the groups whose window has ended
+func (d *Deduplicator) expire(now time.Time) {
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		if now.Sub(front.Value.(*dedupGroup).firstSeen) < d.window {
+			return
+		}
+		d.evict(front)
+	}
+}
+
+// evict stops tracking a group, queueing its collapsed entry
+func (d *Deduplicator) evict(elem *list.Element) {
+	group := d.order.Remove(elem).(*dedupGroup)
+	delete(d.groups, group.key)
+
+	if group.entry != nil {
+		entry := group.entry
+		entry.AddField(FieldRepeatCount, group.count)
+		entry.AddField(FieldFirstSeen, group.firstSeen.UTC().Format(time.RFC3339Nano))
+		entry.AddField(FieldLastSeen, group.lastSeen.UTC().Format(time.RFC3339Nano))
+		d.due = append(d.due, HeldEntry{Entry: entry, Done: group.done, Folded: group.folded})
+	}
+}
+
+// Flush implements the Flusher interface
+func (d *Deduplicator) Flush(now time.Time, force bool) []*models.LogEntry {
+	held := d.Release(now, force)
+	entries := make([]*models.LogEntry, len(held))
+	for i, h := range held {
+		entries[i] = h.Entry
+	}
+	return entries
+}
+
+// Release implements the Holder interface
+func (d *Deduplicator) Release(now time.Time, force bool) []HeldEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if force {
+		for d.order.Len() > 0 {
+			d.evict(d.order.Front())
+		}
+	} else {
+		d.expire(now)
+	}
+
+	due := d.due
+	d.due = nil
+	return due
+}
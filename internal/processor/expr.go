@@ -0,0 +1,1207 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Expression is a compiled expression over a log entry, such as
+//
+//	level in ["error", "fatal"] && fields.status >= 500 && !(source matches "^test-")
+//
+// Names are source, level, message, timestamp and fields; fields.name, fields["name"] and
+// fields.a.b reach entry fields and nested objects. Missing fields are null, and null is
+// safe everywhere: comparisons with it are false (except == and !=), arithmetic and string
+// functions return null, and a null condition is false. Numeric strings compare and compute
+// as numbers, except with +, which concatenates strings. Operators, from lowest precedence:
+//
+//	|| or    && and    == != < <= > >= in (not in) matches    + -    * / %    ! not -(unary)
+//
+// Functions: lower, upper, trim, len, contains, startsWith, endsWith, replace, substr,
+// number, string, coalesce, severity (the numeric severity of a level, so that
+// severity(level) >= severity("warn")), abs, round, floor, ceil, min and max.
+//
+// Expressions are immutable once compiled and safe for concurrent use.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// CompileExpression parses an expression
+func CompileExpression(source string) (*Expression, error) {
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = fmt.Errorf("unexpected %s at offset %d", p.peek(), p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// MustCompileExpression is like CompileExpression but panics on error
+func MustCompileExpression(source string) *Expression {
+	expr, err := CompileExpression(source)
+	if err != nil {
+		panic(err)
+	}
+	return expr
+}
+
+// String returns the expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against an entry. The result is nil, bool, float64,
+// string, time.Time, []interface{} or map[string]interface{}.
+func (e *Expression) Eval(entry *models.LogEntry) (interface{}, error) {
+	return e.root.eval(entry)
+}
+
+// Match evaluates the expression as a condition; errors and non-true results don't match
+func (e *Expression) Match(entry *models.LogEntry) bool {
+	value, err := e.root.eval(entry)
+	return err == nil && truthy(value)
+}
+
+// truthy reports whether a value holds as a condition
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// normalizeValue converts entry values to the expression types
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, float64, string, time.Time, []interface{}, map[string]interface{}:
+		return v
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return m
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// toNumber converts a number or numeric string
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// toString renders a value as a string
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// typeName names a value type in errors
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// valuesEqual compares two values, numerically when both are numbers or numeric strings
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch av := a.(type) {
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	case time.Time:
+		if bt, ok := toTime(b); ok {
+			return av.Equal(bt)
+		}
+		return false
+	case string:
+		if bs, ok := b.(string); ok {
+			return av == bs
+		}
+	}
+	if bt, ok := b.(time.Time); ok {
+		if at, ok := toTime(a); ok {
+			return at.Equal(bt)
+		}
+		return false
+	}
+	if af, ok := toNumber(a); ok {
+		if _, isBool := b.(bool); !isBool {
+			if bf, ok := toNumber(b); ok {
+				return af == bf
+			}
+		}
+	}
+	return false
+}
+
+// toTime converts a time or RFC 3339 string
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// compareValues orders two values; ok is false when they can't be ordered
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	_, aTime := a.(time.Time)
+	_, bTime := b.(time.Time)
+	if aTime || bTime {
+		at, ok1 := toTime(a)
+		bt, ok2 := toTime(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return at.Compare(bt), true
+	}
+	as, aString := a.(string)
+	bs, bString := b.(string)
+	if aString && bString {
+		// Numeric strings order as numbers
+		if af, ok := toNumber(as); ok {
+			if bf, ok := toNumber(bs); ok {
+				return compareFloats(af, bf), true
+			}
+		}
+		return strings.Compare(as, bs), true
+	}
+	af, ok1 := toNumber(a)
+	bf, ok2 := toNumber(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return compareFloats(af, bf), true
+}
+
+// compareFloats orders two numbers
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Token kinds
+const (
+	tokenEOF = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+// exprToken is a lexical token
+type exprToken struct {
+	kind  int
+	text  string
+	value interface{}
+	pos   int
+}
+
+// String describes the token in errors
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// exprOperators lists the operator tokens, longest first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "(", ")", "[", "]", ",", ".", "!", "<", ">", "+", "-", "*", "/", "%"}
+
+// lexExpression splits an expression into tokens
+func lexExpression(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.' || source[i] == 'e' || source[i] == 'E' ||
+				(source[i] == '-' || source[i] == '+') && (source[i-1] == 'e' || source[i-1] == 'E')) {
+				i++
+			}
+			value, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", source[start:i], start)
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: source[start:i], value: value, pos: start})
+
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(source) {
+					return nil, fmt.Errorf("unterminated string at offset %d", start)
+				}
+				if rune(source[i]) == c {
+					i++
+					break
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+					switch source[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					default:
+						// Other escapes keep their backslash so regular expressions read naturally
+						if source[i] != '"' && source[i] != '\'' && source[i] != '\\' {
+							b.WriteByte('\\')
+						}
+						b.WriteByte(source[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(source[i])
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: b.String(), value: b.String(), pos: start})
+
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: source[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, exprToken{kind: tokenOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// exprParser is a recursive descent parser over the tokens
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// peek returns the next token
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+// next consumes the next token
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator or keyword
+func (p *exprParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenOp || t.kind == tokenIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes an operator or fails
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q but found %s at offset %d", text, p.peek(), p.peek().pos)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") || p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") || p.accept("and") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	op := t.text
+	switch {
+	case t.kind == tokenOp && (op == "==" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">="):
+		p.next()
+	case t.kind == tokenIdent && (op == "in" || op == "matches"):
+		p.next()
+	case t.kind == tokenIdent && op == "not" && p.tokens[p.pos+1].kind == tokenIdent && p.tokens[p.pos+1].text == "in":
+		p.pos += 2
+		op = "not in"
+	default:
+		return left, nil
+	}
+
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op == "matches" {
+		node := &matchNode{left: left, right: right}
+		// Literal patterns are compiled once
+		if lit, ok := right.(*literalNode); ok {
+			pattern, isString := lit.value.(string)
+			if !isString {
+				return nil, fmt.Errorf("matches needs a string pattern")
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			node.re = re
+		}
+		return node, nil
+	}
+	return &compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOp || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmeticNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmeticNode{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") || p.accept("not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmeticNode{op: "-", left: &literalNode{value: float64(0)}, right: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a name after '.' at offset %d", name.pos)
+			}
+			node = &indexNode{target: node, index: &literalNode{value: name.text}}
+		case p.accept("["):
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{target: node, index: index}
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &literalNode{value: t.value}, nil
+
+	case tokenOp:
+		switch t.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			list := &listNode{}
+			if p.accept("]") {
+				return list, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if p.accept("]") {
+					return list, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		case "source", "level", "message", "timestamp", "fields":
+			if p.peek().kind == tokenOp && p.peek().text == "(" {
+				break
+			}
+			return &nameNode{name: t.text}, nil
+		}
+
+		if p.accept("(") {
+			fn, ok := exprFunctions[t.text]
+			if !ok {
+				return nil, fmt.Errorf("unknown function %q at offset %d", t.text, t.pos)
+			}
+			call := &callNode{name: t.text, fn: fn}
+			if !p.accept(")") {
+				for {
+					arg, err := p.parseOr()
+					if err != nil {
+						return nil, err
+					}
+					call.args = append(call.args, arg)
+					if p.accept(")") {
+						break
+					}
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+				return nil, fmt.Errorf("wrong number of arguments to %s at offset %d", t.text, t.pos)
+			}
+			return call, nil
+		}
+		return nil, fmt.Errorf("unknown name %q at offset %d (entry fields are fields.%s)", t.text, t.pos, t.text)
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+}
+
+// exprNode is a node of the syntax tree
+type exprNode interface {
+	eval(entry *models.LogEntry) (interface{}, error)
+}
+
+// literalNode is a constant
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(*models.LogEntry) (interface{}, error) {
+	return n.value, nil
+}
+
+// listNode is a list literal
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(entry *models.LogEntry) (interface{}, error) {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(entry)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value
+	}
+	return list, nil
+}
+
+// nameNode reads an entry attribute
+type nameNode struct {
+	name string
+}
+
+func (n *nameNode) eval(entry *models.LogEntry) (interface{}, error) {
+	switch n.name {
+	case "source":
+		return entry.Source, nil
+	case "level":
+		return entry.Level, nil
+	case "message":
+		return entry.Message, nil
+	case "timestamp":
+		return entry.Timestamp, nil
+	default:
+		if entry.Fields == nil {
+			return map[string]interface{}{}, nil
+		}
+		return entry.Fields, nil
+	}
+}
+
+// indexNode reads a member of an object or list
+type indexNode struct {
+	target exprNode
+	index  exprNode
+}
+
+func (n *indexNode) eval(entry *models.LogEntry) (interface{}, error) {
+	target, err := n.target.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case map[string]interface{}:
+		return normalizeValue(t[toString(index)]), nil
+	case []interface{}:
+		i, ok := toNumber(index)
+		if !ok || i != math.Trunc(i) || i < 0 || int(i) >= len(t) {
+			return nil, nil
+		}
+		return normalizeValue(t[int(i)]), nil
+	default:
+		// Members of null and scalars are null
+		return nil, nil
+	}
+}
+
+// logicalNode is a short-circuit && or ||
+type logicalNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(entry *models.LogEntry) (interface{}, error) {
+	left, err := n.left.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(left) == n.or {
+		return n.or, nil
+	}
+	right, err := n.right.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+// notNode negates a condition
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) eval(entry *models.LogEntry) (interface{}, error) {
+	value, err := n.operand.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+// compareNode is a comparison or membership test
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) eval(entry *models.LogEntry) (interface{}, error) {
+	left, err := n.left.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "in", "not in":
+		found := contains(right, left)
+		return found == (n.op == "in"), nil
+	}
+
+	cmp, ok := compareValues(left, right)
+	if !ok {
+		return false, nil
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// contains reports whether a list holds a value, an object has a key or a string a substring
+func contains(container, value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	switch c := container.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if valuesEqual(normalizeValue(item), value) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		_, ok := c[toString(value)]
+		return ok
+	case string:
+		return strings.Contains(c, toString(value))
+	}
+	return false
+}
+
+// matchCacheSize bounds the patterns compiled at run time, which can come from entry data
+const matchCacheSize = 1024
+
+// matchCache holds patterns compiled at run time, shared across goroutines
+var matchCache = newLRUCache[string, *regexp.Regexp](matchCacheSize)
+
+// matchNode tests a value against a regular expression
+type matchNode struct {
+	left, right exprNode
+	re          *regexp.Regexp
+}
+
+func (n *matchNode) eval(entry *models.LogEntry) (interface{}, error) {
+	left, err := n.left.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil {
+		return false, nil
+	}
+
+	re := n.re
+	if re == nil {
+		right, err := n.right.eval(entry)
+		if err != nil {
+			return nil, err
+		}
+		pattern, ok := right.(string)
+		if !ok {
+			return false, nil
+		}
+		if cached, ok := matchCache.Get(pattern); ok {
+			re = cached
+		} else {
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			matchCache.Add(pattern, re)
+		}
+	}
+	return re.MatchString(toString(left)), nil
+}
+
+// arithmeticNode computes + - * / %
+type arithmeticNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *arithmeticNode) eval(entry *models.LogEntry) (interface{}, error) {
+	left, err := n.left.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(entry)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	if n.op == "+" {
+		_, leftString := left.(string)
+		_, rightString := right.(string)
+		if leftString || rightString {
+			return toString(left) + toString(right), nil
+		}
+	}
+
+	a, ok1 := toNumber(left)
+	b, ok2 := toNumber(right)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("can't apply %s to %s and %s", n.op, typeName(left), typeName(right))
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, nil
+		}
+		return a / b, nil
+	default:
+		if b == 0 {
+			return nil, nil
+		}
+		return math.Mod(a, b), nil
+	}
+}
+
+// exprFunction is a built-in function
+type exprFunction struct {
+	minArgs, maxArgs int
+	call             func(args []interface{}) (interface{}, error)
+}
+
+// callNode calls a built-in function
+type callNode struct {
+	name string
+	fn   exprFunction
+	args []exprNode
+}
+
+func (n *callNode) eval(entry *models.LogEntry) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(entry)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	result, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return result, nil
+}
+
+// stringFunction lifts a string function; null arguments give null
+func stringFunction(fn func(s string, args []string) interface{}) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			strs[i] = toString(arg)
+		}
+		return fn(strs[0], strs[1:]), nil
+	}
+}
+
+// numberFunction lifts a numeric function; null arguments give null
+func numberFunction(fn func(x float64) float64) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		x, ok := toNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %s", typeName(args[0]))
+		}
+		return fn(x), nil
+	}
+}
+
+// extremum returns the least or greatest numeric argument, ignoring nulls
+func extremum(greatest bool) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		var result interface{}
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			x, ok := toNumber(arg)
+			if !ok {
+				return nil, fmt.Errorf("expected numbers, got %s", typeName(arg))
+			}
+			if current, ok := result.(float64); !ok || (greatest && x > current) || (!greatest && x < current) {
+				result = x
+			}
+		}
+		return result, nil
+	}
+}
+
+// exprFunctions are the built-in functions
+var exprFunctions = map[string]exprFunction{
+	"lower": {1, 1, stringFunction(func(s string, _ []string) interface{} { return strings.ToLower(s) })},
+	"upper": {1, 1, stringFunction(func(s string, _ []string) interface{} { return strings.ToUpper(s) })},
+	"trim":  {1, 1, stringFunction(func(s string, _ []string) interface{} { return strings.TrimSpace(s) })},
+	"contains": {2, 2, stringFunction(func(s string, args []string) interface{} {
+		return strings.Contains(s, args[0])
+	})},
+	"startsWith": {2, 2, stringFunction(func(s string, args []string) interface{} {
+		return strings.HasPrefix(s, args[0])
+	})},
+	"endsWith": {2, 2, stringFunction(func(s string, args []string) interface{} {
+		return strings.HasSuffix(s, args[0])
+	})},
+	"replace": {3, 3, stringFunction(func(s string, args []string) interface{} {
+		return strings.ReplaceAll(s, args[0], args[1])
+	})},
+	"substr": {2, 3, func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		runes := []rune(toString(args[0]))
+		start, ok := toNumber(args[1])
+		if !ok {
+			return nil, fmt.Errorf("expected a number start")
+		}
+		end := float64(len(runes))
+		if len(args) == 3 {
+			length, ok := toNumber(args[2])
+			if !ok {
+				return nil, fmt.Errorf("expected a number length")
+			}
+			end = start + length
+		}
+		from := int(math.Max(0, math.Min(start, float64(len(runes)))))
+		to := int(math.Max(float64(from), math.Min(end, float64(len(runes)))))
+		return string(runes[from:to]), nil
+	}},
+	"len": {1, 1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		default:
+			return float64(len(toString(v))), nil
+		}
+	}},
+	"number": {1, 1, func(args []interface{}) (interface{}, error) {
+		if t, ok := args[0].(time.Time); ok {
+			return float64(t.UnixNano()) / 1e9, nil
+		}
+		if x, ok := toNumber(args[0]); ok {
+			return x, nil
+		}
+		return nil, nil
+	}},
+	"string": {1, 1, func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return toString(args[0]), nil
+	}},
+	"coalesce": {1, -1, func(args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if arg != nil && arg != "" {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}},
+	"severity": {1, 1, func(args []interface{}) (interface{}, error) {
+		if level, ok := models.NormalizeLevel(toString(args[0])); ok {
+			return float64(level), nil
+		}
+		return nil, nil
+	}},
+	"abs":   {1, 1, numberFunction(math.Abs)},
+	"round": {1, 1, numberFunction(math.Round)},
+	"floor": {1, 1, numberFunction(math.Floor)},
+	"ceil":  {1, 1, numberFunction(math.Ceil)},
+	"min":   {1, -1, extremum(false)},
+	"max":   {1, -1, extremum(true)},
+}
+
+// ExpressionFilter keeps the entries an expression holds for
+type ExpressionFilter struct {
+	Expression *Expression
+}
+
+// NewExpressionFilter compiles a filter expression
+func NewExpressionFilter(source string) (*ExpressionFilter, error) {
+	expr, err := CompileExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return &ExpressionFilter{Expression: expr}, nil
+}
+
+// Apply implements the Filter interface
+func (f *ExpressionFilter) Apply(entry *models.LogEntry) bool {
+	return f.Expression.Match(entry)
+}
+
+// ComputeTransformer sets a field to the value of an expression. Null results and
+// evaluation errors leave the entry unchanged.
+type ComputeTransformer struct {
+	Field      string
+	Expression *Expression
+}
+
+// NewComputeTransformer compiles an expression computing a field. The field is an entry
+// field name (optionally written fields.name), or message or level.
+func NewComputeTransformer(field, source string) (*ComputeTransformer, error) {
+	field = strings.TrimPrefix(strings.TrimSpace(field), "fields.")
+	if field == "" {
+		return nil, fmt.Errorf("a target field is required")
+	}
+	expr, err := CompileExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return &ComputeTransformer{Field: field, Expression: expr}, nil
+}
+
+// assignmentTarget matches the left-hand side of an assignment
+var assignmentTarget = regexp.MustCompile(`^(fields\.)?[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// ParseAssignment compiles an assignment such as "latency_ms = fields.duration * 1000"
+func ParseAssignment(assignment string) (*ComputeTransformer, error) {
+	field, source, ok := strings.Cut(assignment, "=")
+	if !ok || strings.HasPrefix(source, "=") || !assignmentTarget.MatchString(strings.TrimSpace(field)) {
+		return nil, fmt.Errorf("invalid assignment %q (expected field = expression)", assignment)
+	}
+	return NewComputeTransformer(field, source)
+}
+
+// Transform implements the Transformer interface
+func (t *ComputeTransformer) Transform(entry *models.LogEntry) {
+	value, err := t.Expression.Eval(entry)
+	if err != nil || value == nil {
+		return
+	}
+
+	switch t.Field {
+	case "message":
+		entry.Message = toString(value)
+	case "level":
+		entry.Level = toString(value)
+	default:
+		entry.AddField(t.Field, value)
+	}
+}
@@ -25,6 +25,10 @@ func NewLevelFilter(levels []string, include bool) *LevelFilter {
 	levelSet := make(map[string]bool)
 	for _, level := range levels {
 		levelSet[strings.ToLower(level)] = true
+		// Also match every spelling of the same severity
+		if canonical, ok := models.NormalizeLevel(level); ok {
+			levelSet[canonical.String()] = true
+		}
 	}
 
 	return &LevelFilter{
@@ -41,12 +45,44 @@ func (f *LevelFilter) Apply(entry *models.LogEntry) bool {
 	}
 
 	levelExists := f.Levels[strings.ToLower(entry.Level)]
-	
+	if !levelExists {
+		if canonical, ok := models.NormalizeLevel(entry.Level); ok {
+			levelExists = f.Levels[canonical.String()]
+		}
+	}
+
 	// If include levels is true, we want to include entries with matching levels
 	// If include levels is false, we want to exclude entries with matching levels
 	return levelExists == f.IncludeLevels
 }
 
+// MinLevelFilter keeps log entries at or above a minimum severity
+type MinLevelFilter struct {
+	MinLevel models.Level
+}
+
+// NewMinLevelFilter creates a new minimum level filter
+func NewMinLevelFilter(minLevel string) (*MinLevelFilter, error) {
+	level, err := models.ParseLevel(minLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MinLevelFilter{
+		MinLevel: level,
+	}, nil
+}
+
+// Apply implements the Filter interface
+func (f *MinLevelFilter) Apply(entry *models.LogEntry) bool {
+	level, ok := models.NormalizeLevel(entry.Level)
+	if !ok {
+		// Entries with an unknown level can't be compared
+		return false
+	}
+	return level >= f.MinLevel
+}
+
 // RegexFilter filters log entries based on a regular expression applied to the message
 type RegexFilter struct {
 	Pattern *regexp.Regexp
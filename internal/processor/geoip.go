@@ -0,0 +1,361 @@
+package processor
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// DefaultGeoIPCacheSize is the number of IP lookups kept per database by default
+const DefaultGeoIPCacheSize = 8192
+
+// DefaultGeoIPReloadInterval is how often a database file is checked for changes by default
+const DefaultGeoIPReloadInterval = time.Minute
+
+// GeoLocation is the result of looking an IP address up in one or more MaxMind databases
+type GeoLocation struct {
+	CountryCode string
+	Country     string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	HasLocation bool
+	ASN         uint
+	ASOrg       string
+}
+
+// merge fills the parts of l that other has and l lacks
+func (l *GeoLocation) merge(other GeoLocation) {
+	if l.CountryCode == "" {
+		l.CountryCode = other.CountryCode
+	}
+	if l.Country == "" {
+		l.Country = other.Country
+	}
+	if l.City == "" {
+		l.City = other.City
+	}
+	if !l.HasLocation && other.HasLocation {
+		l.Latitude, l.Longitude, l.HasLocation = other.Latitude, other.Longitude, true
+	}
+	if l.ASN == 0 {
+		l.ASN = other.ASN
+	}
+	if l.ASOrg == "" {
+		l.ASOrg = other.ASOrg
+	}
+}
+
+// empty reports whether the lookup found nothing
+func (l GeoLocation) empty() bool {
+	return l == GeoLocation{}
+}
+
+// mmdbRecord covers the fields of the GeoLite2/GeoIP2 City, Country and ASN databases
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoCacheEntry is a cached lookup, tagged with the generation of the database it came from
+type geoCacheEntry struct {
+	location   GeoLocation
+	generation uint64
+}
+
+// GeoIPDatabase is a MaxMind DB file that is reloaded when it changes on disk
+type GeoIPDatabase struct {
+	path           string
+	reloadInterval time.Duration
+	cache          *lruCache[netip.Addr, geoCacheEntry]
+
+	mu         sync.RWMutex
+	reader     *maxminddb.Reader
+	generation uint64
+	modTime    time.Time
+	size       int64
+	lastCheck  time.Time
+}
+
+// OpenGeoIPDatabase opens a MaxMind DB (.mmdb) file such as GeoLite2-City or GeoLite2-ASN
+func OpenGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	db := &GeoIPDatabase{
+		path:           path,
+		reloadInterval: DefaultGeoIPReloadInterval,
+		cache:          newLRUCache[netip.Addr, geoCacheEntry](DefaultGeoIPCacheSize),
+	}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// WithReloadInterval sets how often the file is checked for changes (0 disables reloading)
+func (d *GeoIPDatabase) WithReloadInterval(interval time.Duration) *GeoIPDatabase {
+	d.reloadInterval = interval
+	return d
+}
+
+// WithCacheSize sets how many lookups are cached
+func (d *GeoIPDatabase) WithCacheSize(size int) *GeoIPDatabase {
+	d.cache = newLRUCache[netip.Addr, geoCacheEntry](size)
+	return d
+}
+
+// Path returns the database file path
+func (d *GeoIPDatabase) Path() string {
+	return d.path
+}
+
+// Metadata returns the database type and build time
+func (d *GeoIPDatabase) Metadata() (string, time.Time) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.reader.Metadata.DatabaseType, time.Unix(int64(d.reader.Metadata.BuildEpoch), 0)
+}
+
+// load reads the database file and swaps it in
+func (d *GeoIPDatabase) load() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat GeoIP database: %w", err)
+	}
+
+	// The file is read into memory rather than memory-mapped so it can be
+	// replaced in place while lookups are running
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("invalid GeoIP database %s: %w", d.path, err)
+	}
+
+	// Lookups still running against the previous database cache their results under its
+	// generation, so they're ignored after the purge below
+	d.mu.Lock()
+	d.reader = reader
+	d.generation++
+	d.modTime = info.ModTime()
+	d.size = info.Size()
+	d.lastCheck = time.Now()
+	d.mu.Unlock()
+
+	d.cache.Purge()
+	return nil
+}
+
+// Reload reloads the database if the file has changed since it was loaded
+func (d *GeoIPDatabase) Reload() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat GeoIP database: %w", err)
+	}
+
+	d.mu.Lock()
+	d.lastCheck = time.Now()
+	changed := !info.ModTime().Equal(d.modTime) || info.Size() != d.size
+	d.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return d.load()
+}
+
+// maybeReload reloads the database when the reload interval has passed. Only one caller
+// reloads at a time, and a file that fails to load keeps the previous database in use.
+func (d *GeoIPDatabase) maybeReload() {
+	if d.reloadInterval <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	due := time.Since(d.lastCheck) >= d.reloadInterval
+	if due {
+		// Claim the check so concurrent lookups keep using the current database
+		d.lastCheck = time.Now()
+	}
+	d.mu.Unlock()
+
+	if due {
+		_ = d.Reload()
+	}
+}
+
+// Lookup returns what the database knows about an address
+func (d *GeoIPDatabase) Lookup(addr netip.Addr) (GeoLocation, error) {
+	d.maybeReload()
+
+	d.mu.RLock()
+	generation := d.generation
+	d.mu.RUnlock()
+	if cached, ok := d.cache.Get(addr); ok && cached.generation == generation {
+		return cached.location, nil
+	}
+
+	var record mmdbRecord
+	d.mu.RLock()
+	err := d.reader.Lookup(net.IP(addr.AsSlice()), &record)
+	generation = d.generation
+	d.mu.RUnlock()
+	if err != nil {
+		return GeoLocation{}, fmt.Errorf("GeoIP lookup failed for %s: %w", addr, err)
+	}
+
+	location := GeoLocation{
+		CountryCode: record.Country.ISOCode,
+		Country:     record.Country.Names["en"],
+		City:        record.City.Names["en"],
+		ASN:         record.ASN,
+		ASOrg:       record.ASOrg,
+	}
+	if record.Location.Latitude != nil && record.Location.Longitude != nil {
+		location.Latitude = *record.Location.Latitude
+		location.Longitude = *record.Location.Longitude
+		location.HasLocation = true
+	}
+
+	d.cache.Add(addr, geoCacheEntry{location: location, generation: generation})
+	return location, nil
+}
+
+// Close releases the database
+func (d *GeoIPDatabase) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reader.Close()
+}
+
+// reservedPrefixes are special-purpose ranges (RFC 6890 and friends) not covered by the netip helpers
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublicIP reports whether an address is globally routable, i.e. not private, loopback,
+// link-local, multicast, documentation or otherwise reserved
+func IsPublicIP(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnrichIPTransformer enriches IP addresses with location and network data from MaxMind databases
+type EnrichIPTransformer struct {
+	IPFieldName string
+	databases   []*GeoIPDatabase
+}
+
+// NewEnrichIPTransformer creates a transformer that looks the IP in the given field up in each
+// database (e.g. a City and an ASN database), the first database to know a value winning
+func NewEnrichIPTransformer(fieldName string, databases ...*GeoIPDatabase) *EnrichIPTransformer {
+	return &EnrichIPTransformer{
+		IPFieldName: fieldName,
+		databases:   databases,
+	}
+}
+
+// Databases returns the databases consulted, in order
+func (t *EnrichIPTransformer) Databases() []*GeoIPDatabase {
+	return t.databases
+}
+
+// Transform implements the Transformer interface
+func (t *EnrichIPTransformer) Transform(entry *models.LogEntry) {
+	value, ok := entry.GetStringField(t.IPFieldName)
+	if !ok {
+		return
+	}
+
+	addr, err := parseIPField(value)
+	if err != nil || !IsPublicIP(addr) {
+		return
+	}
+	addr = addr.Unmap()
+
+	var location GeoLocation
+	for _, db := range t.databases {
+		found, err := db.Lookup(addr)
+		if err != nil {
+			continue
+		}
+		location.merge(found)
+	}
+	if location.empty() {
+		return
+	}
+
+	if location.CountryCode != "" {
+		entry.AddField("ip_geo_country_code", location.CountryCode)
+	}
+	if location.Country != "" {
+		entry.AddField("ip_geo_country", location.Country)
+	}
+	if location.City != "" {
+		entry.AddField("ip_geo_city", location.City)
+	}
+	if location.HasLocation {
+		entry.AddField("ip_geo_latitude", location.Latitude)
+		entry.AddField("ip_geo_longitude", location.Longitude)
+		entry.AddField("ip_geo_coordinates", strconv.FormatFloat(location.Latitude, 'f', -1, 64)+","+
+			strconv.FormatFloat(location.Longitude, 'f', -1, 64))
+	}
+	if location.ASN != 0 {
+		entry.AddField("ip_geo_asn", location.ASN)
+	}
+	if location.ASOrg != "" {
+		entry.AddField("ip_geo_as_org", location.ASOrg)
+	}
+}
+
+// parseIPField reads an address, tolerating a port ("1.2.3.4:80", "[::1]:80") or surrounding spaces
+func parseIPField(value string) (netip.Addr, error) {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr, nil
+	}
+	addrPort, err := netip.ParseAddrPort(value)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrPort.Addr(), nil
+}
@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Log metric types
+const (
+	MetricCounter   = "counter"
+	MetricGauge     = "gauge"
+	MetricHistogram = "histogram"
+)
+
+// DefaultLogMetricMaxSeries bounds the label combinations of a log metric when no cap is set
+const DefaultLogMetricMaxSeries = 1000
+
+// LogMetricOverflow is the value of every label of the series that combinations beyond the cap are folded into
+const LogMetricOverflow = "_other"
+
+// invalidLabelChars matches the characters Prometheus label names can't contain
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// LogMetric is a Prometheus metric derived from log entries. Counters count matching entries,
+// or add their value field when one is set; gauges are set to the value field and histograms
+// observe it. Labels take their values from entry fields, except source and level which come
+// from the entry itself. Once a metric has as many series as its cap, entries with new label
+// values are counted in a single series whose labels are all LogMetricOverflow.
+type LogMetric struct {
+	name      string
+	kind      string
+	help      string
+	match     *Expression
+	field     string
+	labels    []string
+	buckets   []float64
+	maxSeries int
+
+	observe func(labels []string, value float64)
+
+	mu     sync.Mutex
+	series map[string]struct{}
+
+	metrics *metrics.Metrics
+}
+
+// NewLogMetric creates a metric of the given type (counter, gauge or histogram)
+func NewLogMetric(name, kind string) (*LogMetric, error) {
+	switch kind {
+	case MetricCounter, MetricGauge, MetricHistogram:
+	default:
+		return nil, fmt.Errorf("unknown metric type %q (expected counter, gauge or histogram)", kind)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("metric name is required")
+	}
+	return &LogMetric{
+		name:      name,
+		kind:      kind,
+		help:      fmt.Sprintf("Log-derived %s %s", kind, name),
+		maxSeries: DefaultLogMetricMaxSeries,
+		series:    make(map[string]struct{}),
+		metrics:   metrics.GetMetrics(),
+	}, nil
+}
+
+// WithHelp sets the help text of the metric
+func (m *LogMetric) WithHelp(help string) *LogMetric {
+	if help != "" {
+		m.help = help
+	}
+	return m
+}
+
+// WithMatch limits the metric to the entries an expression holds for
+func (m *LogMetric) WithMatch(source string) (*LogMetric, error) {
+	if source == "" {
+		m.match = nil
+		return m, nil
+	}
+	expr, err := CompileExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match of metric %s: %w", m.name, err)
+	}
+	m.match = expr
+	return m, nil
+}
+
+// WithValueField sets the field holding the value counted, set or observed
+func (m *LogMetric) WithValueField(field string) *LogMetric {
+	m.field = strings.TrimPrefix(field, "fields.")
+	return m
+}
+
+// WithLabels sets the fields labelling the metric. Label names are the field names with
+// characters Prometheus doesn't allow replaced by underscores.
+func (m *LogMetric) WithLabels(fields ...string) *LogMetric {
+	m.labels = make([]string, len(fields))
+	for i, field := range fields {
+		m.labels[i] = strings.TrimPrefix(field, "fields.")
+	}
+	return m
+}
+
+// WithBuckets sets the upper bounds of histogram buckets (prometheus.DefBuckets by default)
+func (m *LogMetric) WithBuckets(buckets ...float64) *LogMetric {
+	m.buckets = buckets
+	return m
+}
+
+// WithMaxSeries caps the number of label combinations
+func (m *LogMetric) WithMaxSeries(maxSeries int) *LogMetric {
+	if maxSeries > 0 {
+		m.maxSeries = maxSeries
+	}
+	return m
+}
+
+// Name returns the metric name
+func (m *LogMetric) Name() string {
+	return m.name
+}
+
+// labelNames returns the Prometheus names of the labels
+func (m *LogMetric) labelNames() ([]string, error) {
+	names := make([]string, len(m.labels))
+	seen := make(map[string]bool, len(m.labels))
+	for i, field := range m.labels {
+		name := invalidLabelChars.ReplaceAllString(field, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("metric %s has label %s twice", m.name, name)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// Register creates the metric in a registry. A metric already registered under the same
+// name and labels, as when the configuration is loaded again, is reused.
+func (m *LogMetric) Register(registerer prometheus.Registerer) error {
+	if m.kind != MetricCounter && m.field == "" {
+		return fmt.Errorf("%s %s needs a value field", m.kind, m.name)
+	}
+	if m.kind != MetricHistogram && len(m.buckets) > 0 {
+		return fmt.Errorf("buckets only apply to histograms, %s is a %s", m.name, m.kind)
+	}
+	if !sort.Float64sAreSorted(m.buckets) {
+		return fmt.Errorf("buckets of %s must be in increasing order", m.name)
+	}
+	labels, err := m.labelNames()
+	if err != nil {
+		return err
+	}
+
+	var collector prometheus.Collector
+	switch m.kind {
+	case MetricCounter:
+		collector = prometheus.NewCounterVec(prometheus.CounterOpts{Name: m.name, Help: m.help}, labels)
+	case MetricGauge:
+		collector = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: m.name, Help: m.help}, labels)
+	default:
+		collector = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: m.name, Help: m.help, Buckets: m.buckets}, labels)
+	}
+	if err := registerer.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			return fmt.Errorf("failed to register metric %s: %w", m.name, err)
+		}
+		collector = registered.ExistingCollector
+	}
+
+	switch vec := collector.(type) {
+	case *prometheus.CounterVec:
+		m.observe = func(labels []string, value float64) { vec.WithLabelValues(labels...).Add(value) }
+	case *prometheus.GaugeVec:
+		m.observe = func(labels []string, value float64) { vec.WithLabelValues(labels...).Set(value) }
+	case *prometheus.HistogramVec:
+		m.observe = func(labels []string, value float64) { vec.WithLabelValues(labels...).Observe(value) }
+	default:
+		return fmt.Errorf("metric %s is already registered with another type", m.name)
+	}
+	return nil
+}
+
+// labelValues returns the label values of an entry, folding new combinations beyond the cap
+func (m *LogMetric) labelValues(entry *models.LogEntry) []string {
+	values := make([]string, len(m.labels))
+	for i, field := range m.labels {
+		switch field {
+		case "source":
+			values[i] = entry.Source
+		case "level":
+			values[i] = entry.Level
+		default:
+			if value, ok := entry.GetField(field); ok {
+				values[i] = toString(normalizeValue(value))
+			}
+		}
+	}
+	if len(values) == 0 {
+		return values
+	}
+
+	key := strings.Join(values, "\xff")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.series[key]; ok {
+		return values
+	}
+	if len(m.series) < m.maxSeries {
+		m.series[key] = struct{}{}
+		return values
+	}
+	m.metrics.LogMetricSeriesOverflow.WithLabelValues(m.name).Inc()
+	for i := range values {
+		values[i] = LogMetricOverflow
+	}
+	return values
+}
+
+// Observe records an entry. Entries the match rejects, and entries whose value field is
+// missing or not a number, are ignored; so are negative values of counters.
+func (m *LogMetric) Observe(entry *models.LogEntry) {
+	if m.observe == nil || (m.match != nil && !m.match.Match(entry)) {
+		return
+	}
+
+	value := 1.0
+	if m.field != "" {
+		raw, ok := entry.GetField(m.field)
+		if !ok {
+			return
+		}
+		if value, ok = toNumber(normalizeValue(raw)); !ok {
+			return
+		}
+		if m.kind == MetricCounter && value < 0 {
+			return
+		}
+	}
+	m.observe(m.labelValues(entry), value)
+}
+
+// LogMetricsTransformer records log-derived metrics. It doesn't modify entries.
+type LogMetricsTransformer struct {
+	Metrics []*LogMetric
+}
+
+// NewLogMetricsTransformer creates a transformer recording registered metrics
+func NewLogMetricsTransformer(logMetrics ...*LogMetric) *LogMetricsTransformer {
+	return &LogMetricsTransformer{Metrics: logMetrics}
+}
+
+// Transform implements the Transformer interface
+func (t *LogMetricsTransformer) Transform(entry *models.LogEntry) {
+	for _, m := range t.Metrics {
+		m.Observe(entry)
+	}
+}
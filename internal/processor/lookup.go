@@ -0,0 +1,552 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Lookup table file formats
+const (
+	// LookupFormatCSV is a CSV file whose first row names the columns
+	LookupFormatCSV = "csv"
+	// LookupFormatJSON is a JSON array of objects, or one object per line
+	LookupFormatJSON = "json"
+)
+
+// DefaultLookupReloadInterval is how often lookup files are checked for changes by default
+const DefaultLookupReloadInterval = time.Minute
+
+// lookupKeySeparator joins the values of composite keys
+const lookupKeySeparator = "\x1f"
+
+// LookupFormat returns the format of a lookup file from its extension
+func LookupFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return LookupFormatCSV, nil
+	case ".json", ".jsonl", ".ndjson":
+		return LookupFormatJSON, nil
+	default:
+		return "", fmt.Errorf("can't tell the format of lookup file %s, set csv or json", path)
+	}
+}
+
+// lookupData is one loaded version of a table. To stay compact with millions of rows,
+// each cell is an index into a pool of distinct values, and rows are runs of cells that
+// stop after their last present value.
+type lookupData struct {
+	columns []string
+	// values[0] is the empty string standing for missing values
+	values  []string
+	cells   []uint32
+	offsets []uint32
+	index   map[string]uint32
+}
+
+// row returns the cells of a row
+func (d *lookupData) row(i uint32) []uint32 {
+	return d.cells[d.offsets[i]:d.offsets[i+1]]
+}
+
+// lookupLoader builds lookupData row by row
+type lookupLoader struct {
+	keyColumns []string
+	// wanted limits the value columns; all non-key columns are kept when nil
+	wanted   map[string]bool
+	columns  []string
+	position map[string]int
+	// shared maps repeated values to their pool index
+	shared map[string]uint32
+	data   *lookupData
+}
+
+// newLookupLoader creates a loader for a table keyed on keyColumns
+func newLookupLoader(keyColumns, columns []string) *lookupLoader {
+	l := &lookupLoader{
+		keyColumns: keyColumns,
+		position:   make(map[string]int),
+		shared:     make(map[string]uint32),
+		data: &lookupData{
+			values:  []string{""},
+			offsets: []uint32{0},
+			index:   make(map[string]uint32),
+		},
+	}
+	if len(columns) > 0 {
+		l.wanted = make(map[string]bool, len(columns))
+		for _, column := range columns {
+			l.wanted[column] = true
+		}
+	}
+	return l
+}
+
+// intern returns the pool index of a value
+func (l *lookupLoader) intern(value string) uint32 {
+	if i, ok := l.shared[value]; ok {
+		return i
+	}
+	// Values may point into a larger buffer holding the whole line
+	value = strings.Clone(value)
+	i := uint32(len(l.data.values))
+	l.data.values = append(l.data.values, value)
+	// Bound the dedup map so unique values (ids, timestamps) aren't held twice
+	if len(l.shared) < 1<<16 {
+		l.shared[value] = i
+	}
+	return i
+}
+
+// column returns the position of a value column, adding it on first use
+func (l *lookupLoader) column(name string) (int, bool) {
+	if pos, ok := l.position[name]; ok {
+		return pos, true
+	}
+	for _, key := range l.keyColumns {
+		if name == key {
+			return 0, false
+		}
+	}
+	if l.wanted != nil && !l.wanted[name] {
+		return 0, false
+	}
+	pos := len(l.columns)
+	l.columns = append(l.columns, name)
+	l.position[name] = pos
+	return pos, true
+}
+
+// add adds a row given as a column lookup function; rows missing a key value are skipped.
+// A later row with the same key replaces an earlier one.
+func (l *lookupLoader) add(get func(column string) (string, bool), values map[int]string) error {
+	parts := make([]string, len(l.keyColumns))
+	for i, key := range l.keyColumns {
+		value, ok := get(key)
+		if !ok || value == "" {
+			return nil
+		}
+		parts[i] = value
+	}
+
+	width := 0
+	for pos := range values {
+		if pos+1 > width {
+			width = pos + 1
+		}
+	}
+	if len(l.data.cells)+width > math.MaxUint32 || len(l.data.values)+width > math.MaxUint32 {
+		return fmt.Errorf("table too large")
+	}
+	start := len(l.data.cells)
+	for i := 0; i < width; i++ {
+		l.data.cells = append(l.data.cells, 0)
+	}
+	for pos, value := range values {
+		l.data.cells[start+pos] = l.intern(value)
+	}
+
+	row := uint32(len(l.data.offsets) - 1)
+	l.data.offsets = append(l.data.offsets, uint32(len(l.data.cells)))
+	// With a single key column Join returns the field itself, which points into the line
+	l.data.index[strings.Clone(strings.Join(parts, lookupKeySeparator))] = row
+	return nil
+}
+
+// finish checks the requested columns exist and returns the table
+func (l *lookupLoader) finish() (*lookupData, error) {
+	for column := range l.wanted {
+		if _, ok := l.position[column]; !ok {
+			return nil, fmt.Errorf("column %q not found", column)
+		}
+	}
+	l.data.columns = l.columns
+	return l.data, nil
+}
+
+// loadCSV reads a CSV table
+func (l *lookupLoader) loadCSV(r io.Reader) error {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	header = append([]string(nil), header...)
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	keyPos := make(map[string]int, len(l.keyColumns))
+	valuePos := make(map[int]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		keyPos[name] = i
+		if pos, ok := l.column(name); ok {
+			valuePos[i] = pos
+		}
+	}
+	for _, key := range l.keyColumns {
+		if _, ok := keyPos[key]; !ok {
+			return fmt.Errorf("key column %q not found", key)
+		}
+	}
+
+	values := make(map[int]string, len(valuePos))
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		clear(values)
+		for i, pos := range valuePos {
+			if value := strings.TrimSpace(record[i]); value != "" {
+				values[pos] = value
+			}
+		}
+		get := func(column string) (string, bool) {
+			return strings.TrimSpace(record[keyPos[column]]), true
+		}
+		if err := l.add(get, values); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// lookupValueString renders a JSON value as a table value
+func lookupValueString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(encoded), true
+	}
+}
+
+// loadJSON reads a JSON array of objects or a stream of objects
+func (l *lookupLoader) loadJSON(r io.Reader) error {
+	buffered := bufio.NewReader(r)
+	array := false
+	for {
+		b, err := buffered.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			buffered.Discard(1)
+			continue
+		}
+		array = b[0] == '['
+		break
+	}
+
+	decoder := json.NewDecoder(buffered)
+	decoder.UseNumber()
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	values := make(map[int]string)
+	for row := 1; ; row++ {
+		if array && !decoder.More() {
+			return nil
+		}
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			if !array && errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+
+		clear(values)
+		for name, value := range object {
+			if pos, ok := l.column(name); ok {
+				if s, ok := lookupValueString(value); ok && s != "" {
+					values[pos] = s
+				}
+			}
+		}
+		get := func(column string) (string, bool) {
+			return lookupValueString(object[column])
+		}
+		if err := l.add(get, values); err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+	}
+}
+
+// LookupTable is a CSV or JSON file indexed on one or more key columns, reloaded when it
+// changes on disk. Values are kept as strings; repeated values share memory.
+type LookupTable struct {
+	path           string
+	format         string
+	keyColumns     []string
+	columns        []string
+	reloadInterval time.Duration
+
+	mu        sync.RWMutex
+	data      *lookupData
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// OpenLookupTable loads a table keyed on keyColumns. Columns limits the values kept
+// (all non-key columns when empty); format is csv or json, or taken from the extension when empty.
+func OpenLookupTable(path, format string, keyColumns, columns []string) (*LookupTable, error) {
+	if len(keyColumns) == 0 {
+		return nil, fmt.Errorf("lookup table %s needs at least one key column", path)
+	}
+	if format == "" {
+		var err error
+		if format, err = LookupFormat(path); err != nil {
+			return nil, err
+		}
+	}
+	if format != LookupFormatCSV && format != LookupFormatJSON {
+		return nil, fmt.Errorf("invalid lookup format %q (must be csv or json)", format)
+	}
+
+	t := &LookupTable{
+		path:           path,
+		format:         format,
+		keyColumns:     keyColumns,
+		columns:        columns,
+		reloadInterval: DefaultLookupReloadInterval,
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WithReloadInterval sets how often the file is checked for changes (0 disables reloading)
+func (t *LookupTable) WithReloadInterval(interval time.Duration) *LookupTable {
+	t.reloadInterval = interval
+	return t
+}
+
+// Path returns the table file path
+func (t *LookupTable) Path() string {
+	return t.path
+}
+
+// KeyColumns returns the columns the table is keyed on
+func (t *LookupTable) KeyColumns() []string {
+	return t.keyColumns
+}
+
+// Len returns the number of keys
+func (t *LookupTable) Len() int {
+	return len(t.snapshot().index)
+}
+
+// load reads the table file and swaps it in
+func (t *LookupTable) load() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat lookup table: %w", err)
+	}
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open lookup table: %w", err)
+	}
+	defer file.Close()
+
+	loader := newLookupLoader(t.keyColumns, t.columns)
+	if t.format == LookupFormatCSV {
+		err = loader.loadCSV(file)
+	} else {
+		err = loader.loadJSON(file)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid lookup table %s: %w", t.path, err)
+	}
+	data, err := loader.finish()
+	if err != nil {
+		return fmt.Errorf("invalid lookup table %s: %w", t.path, err)
+	}
+
+	t.mu.Lock()
+	t.data = data
+	t.modTime = info.ModTime()
+	t.size = info.Size()
+	t.lastCheck = time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+// Reload reloads the table if the file has changed since it was loaded
+func (t *LookupTable) Reload() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat lookup table: %w", err)
+	}
+
+	t.mu.Lock()
+	t.lastCheck = time.Now()
+	changed := !info.ModTime().Equal(t.modTime) || info.Size() != t.size
+	t.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return t.load()
+}
+
+// maybeReload reloads the table when the reload interval has passed. Only one caller
+// reloads at a time, and a file that fails to load keeps the previous table in use.
+func (t *LookupTable) maybeReload() {
+	if t.reloadInterval <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	due := time.Since(t.lastCheck) >= t.reloadInterval
+	if due {
+		// Claim the check so concurrent lookups keep using the current table
+		t.lastCheck = time.Now()
+	}
+	t.mu.Unlock()
+
+	if due {
+		_ = t.Reload()
+	}
+}
+
+// snapshot returns the current table version
+func (t *LookupTable) snapshot() *lookupData {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.data
+}
+
+// Lookup returns the values of the row with the given key values, in key column order
+func (t *LookupTable) Lookup(keys ...string) (map[string]string, bool) {
+	t.maybeReload()
+
+	data := t.snapshot()
+	row, ok := data.index[strings.Join(keys, lookupKeySeparator)]
+	if !ok {
+		return nil, false
+	}
+	values := make(map[string]string, len(data.columns))
+	for pos, cell := range data.row(row) {
+		if cell != 0 {
+			values[data.columns[pos]] = data.values[cell]
+		}
+	}
+	return values, true
+}
+
+// lookupKeyString renders an entry field as a table key
+func lookupKeyString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		// JSON numbers decode as float64; 1e+06 should still match 1000000
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// LookupTransformer adds the columns of a lookup table row to entries, joining entry
+// fields against the table key columns
+type LookupTransformer struct {
+	table        *LookupTable
+	fields       []string
+	prefix       string
+	defaultValue string
+	hasDefault   bool
+}
+
+// NewLookupTransformer creates a transformer joining the given entry fields, in key
+// column order, against a table; the key column names are used when no fields are given
+func NewLookupTransformer(table *LookupTable, fields ...string) (*LookupTransformer, error) {
+	if len(fields) == 0 {
+		fields = table.KeyColumns()
+	}
+	if len(fields) != len(table.KeyColumns()) {
+		return nil, fmt.Errorf("lookup table %s has %d key columns for %d fields", table.Path(), len(table.KeyColumns()), len(fields))
+	}
+	return &LookupTransformer{table: table, fields: fields}, nil
+}
+
+// Table returns the table joined against
+func (t *LookupTransformer) Table() *LookupTable {
+	return t.table
+}
+
+// WithPrefix sets a prefix for the added field names, e.g. "service_"
+func (t *LookupTransformer) WithPrefix(prefix string) *LookupTransformer {
+	t.prefix = prefix
+	return t
+}
+
+// WithDefault sets the value of every column for keys missing from the table
+func (t *LookupTransformer) WithDefault(value string) *LookupTransformer {
+	t.defaultValue = value
+	t.hasDefault = true
+	return t
+}
+
+// Transform implements the Transformer interface. Entries without the key fields are left alone.
+func (t *LookupTransformer) Transform(entry *models.LogEntry) {
+	keys := make([]string, len(t.fields))
+	for i, field := range t.fields {
+		value, ok := entry.GetField(field)
+		if !ok || value == nil {
+			return
+		}
+		keys[i] = lookupKeyString(value)
+	}
+
+	values, ok := t.table.Lookup(keys...)
+	if ok {
+		for column, value := range values {
+			entry.AddField(t.prefix+column, value)
+		}
+		return
+	}
+
+	if t.hasDefault {
+		for _, column := range t.table.snapshot().columns {
+			entry.AddField(t.prefix+column, t.defaultValue)
+		}
+	}
+}
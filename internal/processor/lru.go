@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is a fixed-size, concurrency-safe least-recently-used cache
+type lruCache[K comparable, V any] struct {
+	capacity int
+	items    map[K]*list.Element
+	order    *list.List
+	mu       sync.Mutex
+}
+
+// lruItem is a key-value pair stored in the cache list
+type lruItem[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache creates a cache holding up to capacity items (at least one)
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &lruCache[K, V]{
+		capacity: capacity,
+		items:    make(map[K]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the cached value for key, marking it as recently used
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*lruItem[K, V]).value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Add stores a value, evicting the least recently used item when full
+func (c *lruCache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruItem[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem[K, V]).key)
+	}
+}
+
+// Len returns the number of cached items
+func (c *lruCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Purge removes all items
+func (c *lruCache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[K]*list.Element, c.capacity)
+	c.order.Init()
+}
@@ -0,0 +1,238 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/plugin"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+// PluginErrorPolicy decides what happens to an entry a processing plugin fails on
+type PluginErrorPolicy string
+
+// Plugin error policies
+const (
+	// PluginErrorIgnore lets the entry go on through the pipeline
+	PluginErrorIgnore PluginErrorPolicy = "ignore"
+	// PluginErrorDrop drops the entry, counting it as filtered
+	PluginErrorDrop PluginErrorPolicy = "drop"
+	// PluginErrorFail stops the entry, counting it as errored
+	PluginErrorFail PluginErrorPolicy = "fail"
+)
+
+// ParsePluginErrorPolicy parses a plugin error policy name
+func ParsePluginErrorPolicy(name string) (PluginErrorPolicy, error) {
+	switch policy := PluginErrorPolicy(name); policy {
+	case PluginErrorIgnore, PluginErrorDrop, PluginErrorFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown plugin error policy %q (expected ignore, drop or fail)", name)
+	}
+}
+
+// Defaults for buffering entries for output plugins
+const (
+	DefaultOutputBatchSize     = 100
+	DefaultOutputBufferSize    = 10000
+	DefaultOutputFlushInterval = time.Second
+	DefaultOutputRetries       = 3
+	DefaultOutputRetryBackoff  = 100 * time.Millisecond
+)
+
+// ErrOutputFull is returned when an output's buffer is full
+var ErrOutputFull = errors.New("output buffer is full")
+
+// asyncBatches buffers entries and hands them to a batch processor from its own goroutine,
+// started with the first entry
+type asyncBatches struct {
+	batches    *worker.BatchProcessor[*models.LogEntry]
+	bufferSize int
+
+	start  sync.Once
+	mu     sync.RWMutex
+	queue  chan outputItem
+	closed bool
+	done   chan struct{}
+}
+
+// outputItem is a buffered entry, or a request to flush the entries buffered before it
+type outputItem struct {
+	entry   *models.LogEntry
+	ctx     context.Context
+	flushed chan error
+}
+
+// newAsyncBatches creates a buffer in front of a batch processor
+func newAsyncBatches(batches *worker.BatchProcessor[*models.LogEntry]) *asyncBatches {
+	return &asyncBatches{
+		batches:    batches,
+		bufferSize: DefaultOutputBufferSize,
+		done:       make(chan struct{}),
+	}
+}
+
+// add buffers an entry without waiting, returning ErrOutputFull when the buffer is full
+func (a *asyncBatches) add(entry *models.LogEntry) error {
+	a.run()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return worker.ErrBatchProcessorClosed
+	}
+	select {
+	case a.queue <- outputItem{entry: entry}:
+		return nil
+	default:
+		return ErrOutputFull
+	}
+}
+
+// flush hands the buffered entries over and waits until they were taken
+func (a *asyncBatches) flush(ctx context.Context) error {
+	a.run()
+	flushed := make(chan error, 1)
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return nil
+	}
+	select {
+	case a.queue <- outputItem{ctx: ctx, flushed: flushed}:
+		a.mu.RUnlock()
+	case <-ctx.Done():
+		a.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-flushed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close stops buffering entries and waits until the rest are handed over
+func (a *asyncBatches) close(ctx context.Context) error {
+	a.run()
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run starts the goroutine handing buffered entries over, once
+func (a *asyncBatches) run() {
+	a.start.Do(func() {
+		a.queue = make(chan outputItem, a.bufferSize)
+		go func() {
+			defer close(a.done)
+			ctx := context.Background()
+			for item := range a.queue {
+				if item.flushed != nil {
+					item.flushed <- a.batches.Flush(item.ctx)
+					continue
+				}
+				// Never closed, and refused batches go to the dead letter
+				_ = a.batches.Add(ctx, item.entry)
+			}
+			_ = a.batches.Close(ctx)
+		}()
+	})
+}
+
+// PluginOutput buffers processed entries for an output plugin and hands them over in
+// batches from its own goroutine, so a slow plugin never holds up the workers. Entries
+// arriving while the buffer is full are dropped, and so is a batch the plugin still refuses
+// after its retries; both are counted.
+type PluginOutput struct {
+	output  plugin.OutputPlugin
+	buffer  *asyncBatches
+	metrics *metrics.Metrics
+}
+
+// NewPluginOutput creates an output handing batches of up to size entries to a plugin, or
+// whatever has gathered once the first entry waited for the interval
+func NewPluginOutput(output plugin.OutputPlugin, size int, interval time.Duration) *PluginOutput {
+	o := &PluginOutput{
+		output:  output,
+		metrics: metrics.GetMetrics(),
+	}
+	// Batches are handed over by the output's goroutine, or by the interval's timer, in order
+	o.buffer = newAsyncBatches(worker.NewBatchProcessor(nil, size, interval, o.send).
+		WithRetry(DefaultOutputRetries, DefaultOutputRetryBackoff).
+		WithDeadLetter(o.drop))
+	return o
+}
+
+// WithRetry sets how many times a refused batch is handed over again, waiting backoff
+// before the first retry and twice as long before each next one
+func (o *PluginOutput) WithRetry(retries int, backoff time.Duration) *PluginOutput {
+	o.buffer.batches.WithRetry(retries, backoff)
+	return o
+}
+
+// WithBufferSize sets how many entries may wait for the plugin before new ones are dropped.
+// It must be called before the first entry is added.
+func (o *PluginOutput) WithBufferSize(size int) *PluginOutput {
+	if size > 0 {
+		o.buffer.bufferSize = size
+	}
+	return o
+}
+
+// Name returns the plugin's name
+func (o *PluginOutput) Name() string {
+	return o.output.Name()
+}
+
+// Add buffers an entry for the plugin without waiting, returning ErrOutputFull when the
+// buffer is full
+func (o *PluginOutput) Add(ctx context.Context, entry *models.LogEntry) error {
+	err := o.buffer.add(entry)
+	if errors.Is(err, ErrOutputFull) {
+		o.metrics.PluginOutputEntries.WithLabelValues(o.output.Name(), "overflow").Inc()
+	}
+	return err
+}
+
+// Flush hands the buffered entries to the plugin and waits until it took them
+func (o *PluginOutput) Flush(ctx context.Context) error {
+	return o.buffer.flush(ctx)
+}
+
+// Close stops buffering entries and waits until the rest are handed to the plugin
+func (o *PluginOutput) Close(ctx context.Context) error {
+	return o.buffer.close(ctx)
+}
+
+// send hands a batch to the plugin
+func (o *PluginOutput) send(ctx context.Context, entries []*models.LogEntry) error {
+	if err := o.output.Output(entries); err != nil {
+		o.metrics.PluginErrors.WithLabelValues(o.output.Name(), "output").Inc()
+		return err
+	}
+	o.metrics.PluginOutputEntries.WithLabelValues(o.output.Name(), "sent").Add(float64(len(entries)))
+	return nil
+}
+
+// drop counts a batch the plugin refused after its retries
+func (o *PluginOutput) drop(ctx context.Context, entries []*models.LogEntry, err error) {
+	o.metrics.PluginOutputEntries.WithLabelValues(o.output.Name(), "dropped").Add(float64(len(entries)))
+}
@@ -2,14 +2,17 @@ package processor
 
 import (
         "context"
+        "errors"
         "fmt"
         "sync"
+        "time"
 
         "github.com/mariasu11/logstreamApp/internal/metrics"
         "github.com/mariasu11/logstreamApp/internal/storage"
         "github.com/mariasu11/logstreamApp/pkg/models"
         "github.com/mariasu11/logstreamApp/pkg/parser"
         "github.com/mariasu11/logstreamApp/pkg/plugin"
+        "github.com/mariasu11/logstreamApp/pkg/queue"
         "github.com/mariasu11/logstreamApp/pkg/worker"
 )
 
@@ -25,6 +28,29 @@ type Processor interface {
         AddPlugin(p plugin.Plugin) Processor
 }
 
+// BackpressureError reports that the worker pool refused part of a batch. The first
+// Accepted entries were queued; the caller may slow down and retry the rest.
+type BackpressureError struct {
+        Accepted int
+        Err      error
+}
+
+// Error implements the error interface
+func (e *BackpressureError) Error() string {
+        return fmt.Sprintf("processor accepted %d entries: %v", e.Accepted, e.Err)
+}
+
+// Unwrap returns the pool's error
+func (e *BackpressureError) Unwrap() error {
+        return e.Err
+}
+
+// IsBackpressure reports whether an error means entries were refused for lack of capacity
+func IsBackpressure(err error) bool {
+        var backpressure *BackpressureError
+        return errors.As(err, &backpressure) && (errors.Is(err, worker.ErrQueueFull) || errors.Is(err, queue.ErrFull))
+}
+
 // LogProcessor implements the Processor interface
 type LogProcessor struct {
         storage     storage.Storage
@@ -32,18 +58,31 @@ type LogProcessor struct {
         filters     []Filter
         transformers []Transformer
         plugins     []plugin.Plugin
+        stages      []Stage
+        router      *Router
         parsers     []parser.Parser
+        timestamps  *parser.TimestampParser
+        jsonOptions parser.JSONOptions
+        levels      *models.LevelNormalizer
+        deadLetter  DeadLetterSink
+        keepDeadLetters bool
+        orderBy     string
+        batcher     *storeBatcher
+        outputs     []*PluginOutput
+        pluginErrors PluginErrorPolicy
         mu          sync.RWMutex
         metrics     *metrics.Metrics
 }
 
 // NewProcessor creates a new LogProcessor
 func NewProcessor(storage storage.Storage, workerPool *worker.Pool) Processor {
-        // Initialize with default parsers
-        parsers := []parser.Parser{
-                parser.NewJSONParser(),
-                parser.NewRegexParser(),
-        }
+        return NewLogProcessor(storage, workerPool)
+}
+
+// NewLogProcessor creates a new LogProcessor, returning the concrete type for further configuration
+func NewLogProcessor(storage storage.Storage, workerPool *worker.Pool) *LogProcessor {
+        // Initialize with default parsers, most specific first
+        parsers := parser.DefaultParsers()
 
         return &LogProcessor{
                 storage:     storage,
@@ -52,10 +91,124 @@ func NewProcessor(storage storage.Storage, workerPool *worker.Pool) Processor {
                 transformers: make([]Transformer, 0),
                 plugins:     make([]plugin.Plugin, 0),
                 parsers:     parsers,
+                levels:      models.NewLevelNormalizer(),
+                pluginErrors: PluginErrorIgnore,
                 metrics:     metrics.GetMetrics(),
         }
 }
 
+// WithLevelNormalizer sets the normalizer applied to levels after parsing (nil disables normalization)
+func (p *LogProcessor) WithLevelNormalizer(normalizer *models.LevelNormalizer) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.levels = normalizer
+        return p
+}
+
+// WithTimestampParser rebuilds the default parsers around a timestamp parser,
+// applying its timezone and clock-skew settings to every format
+func (p *LogProcessor) WithTimestampParser(timestamps *parser.TimestampParser) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.timestamps = timestamps
+        p.parsers = parser.NewDefaultParsers(timestamps, p.jsonOptions)
+        return p
+}
+
+// WithJSONOptions rebuilds the default parsers with field mapping and flattening options
+// for generic JSON logs
+func (p *LogProcessor) WithJSONOptions(options parser.JSONOptions) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        if p.timestamps == nil {
+                p.timestamps = parser.NewTimestampParser()
+        }
+        p.jsonOptions = options
+        p.parsers = parser.NewDefaultParsers(p.timestamps, options)
+        return p
+}
+
+// WithDeadLetter routes entries no parser could handle to a dead-letter sink.
+// When keep is true they are also stored as usual, otherwise they leave the pipeline.
+func (p *LogProcessor) WithDeadLetter(sink DeadLetterSink, keep bool) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.deadLetter = sink
+        p.keepDeadLetters = keep
+        return p
+}
+
+// WithRouter delivers processed entries through a router instead of straight to the storage.
+// The storage only receives entries when a route, usually the default one, targets it.
+func (p *LogProcessor) WithRouter(router *Router) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.router = router
+        return p
+}
+
+// WithOrderingKey keeps entries sharing a key in order by running them on the same worker.
+// The key is "source" or the name of a field, falling back to the source for entries without
+// the field; empty lets any worker take any entry.
+func (p *LogProcessor) WithOrderingKey(key string) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.orderBy = key
+        return p
+}
+
+// WithStoreBatching writes processed entries to the storage in batches of up to size entries
+// instead of one at a time; an entry waits at most the interval for its batch to fill. Call
+// Flush at shutdown to write the last batch. A size below 2 stores entries one at a time.
+// Routed entries are still delivered one at a time.
+func (p *LogProcessor) WithStoreBatching(size int, interval time.Duration) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        if size < 2 {
+                p.batcher = nil
+                return p
+        }
+        if interval <= 0 {
+                interval = DefaultStoreBatchInterval
+        }
+        p.batcher = newStoreBatcher(p.storage, size, interval)
+        return p
+}
+
+// WithPluginErrorPolicy sets what happens to an entry a processing plugin fails on; plugin
+// errors are counted whatever the policy. By default the entry goes on.
+func (p *LogProcessor) WithPluginErrorPolicy(policy PluginErrorPolicy) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.pluginErrors = policy
+        return p
+}
+
+// AddOutput also hands every processed entry to an output plugin, besides storing or routing it
+func (p *LogProcessor) AddOutput(output *PluginOutput) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.outputs = append(p.outputs, output)
+        return p
+}
+
+// AddStage appends a stage to the ordered pipeline. Stages run in order after level
+// normalization and before the filters, transformers and plugins added with AddFilter,
+// AddTransformer and AddPlugin.
+func (p *LogProcessor) AddStage(stage Stage) *LogProcessor {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.stages = append(p.stages, stage)
+        return p
+}
+
+// Stages returns the pipeline stages in order
+func (p *LogProcessor) Stages() []Stage {
+        p.mu.RLock()
+        defer p.mu.RUnlock()
+        return append([]Stage(nil), p.stages...)
+}
+
 // Process implements the Processor interface
 func (p *LogProcessor) Process(ctx context.Context, entries []*models.LogEntry) error {
         if len(entries) == 0 {
@@ -69,31 +222,135 @@ func (p *LogProcessor) Process(ctx context.Context, entries []*models.LogEntry)
         print("DEBUG: Processor received %d log entries\n", len(entries))
 
         p.metrics.LogBatchesReceived.Inc()
-        p.metrics.LogEntriesReceived.Add(float64(len(entries)))
 
-        // Submit each entry to the worker pool for processing
-        for _, entry := range entries {
+        // Submit each entry to the worker pool for processing, stopping at the first refusal
+        // so the caller can hold back and retry the rest
+        for i, entry := range entries {
                 entry := entry // capture for goroutine
                 
                 // Submit processing job to worker pool
-                p.workerPool.Submit(func() {
-                        p.processEntry(ctx, entry)
+                err := p.submit(ctx, entry, func() {
+                        p.processEntry(ctx, entry, nil)
                 })
+                if err != nil {
+                        // Refused entries are counted when they are submitted again
+                        p.metrics.LogEntriesReceived.Add(float64(i))
+                        return &BackpressureError{Accepted: i, Err: err}
+                }
         }
 
+        p.metrics.LogEntriesReceived.Add(float64(len(entries)))
         return nil
 }
 
-// processEntry handles processing of an individual log entry
-func (p *LogProcessor) processEntry(ctx context.Context, entry *models.LogEntry) {
+// submit hands the job processing an entry to the worker pool, on the lane of its ordering
+// key when one is set
+func (p *LogProcessor) submit(ctx context.Context, entry *models.LogEntry, job worker.Job) error {
+        p.mu.RLock()
+        orderBy := p.orderBy
+        p.mu.RUnlock()
+
+        if orderBy == "" {
+                return p.workerPool.Submit(ctx, job)
+        }
+        return p.workerPool.SubmitKeyed(ctx, orderingKey(entry, orderBy), job)
+}
+
+// orderingKey returns the value of an entry's ordering key
+func orderingKey(entry *models.LogEntry, key string) string {
+        if key != "source" {
+                if value, ok := entry.Fields[key]; ok && value != nil {
+                        return fmt.Sprint(value)
+                }
+        }
+        return entry.Source
+}
+
+// processEntry handles processing of an individual log entry. done, if not nil, is called
+// once with the outcome: an error only when the entry couldn't be stored or routed, nil once
+// it was or when the pipeline dropped it. With store batching, that is when its batch is written.
+func (p *LogProcessor) processEntry(ctx context.Context, entry *models.LogEntry, done func(error)) {
+        if entry.IngestedAt.IsZero() {
+                entry.IngestedAt = time.Now()
+        }
+        // Entries without an event time are flagged, so they don't pass for live data;
+        // parsing a timestamp from the raw line clears the flag
+        if entry.Timestamp.IsZero() {
+                entry.Timestamp = entry.IngestedAt
+                entry.AddField(models.FieldTimestampUnparsed, true)
+        }
+
         // Parse the raw log data if needed
         if entry.RawData != "" && (entry.Message == "" || len(entry.Fields) == 0) {
-                for _, parser := range p.parsers {
-                        if parser.CanParse(entry.RawData) {
-                                if err := parser.Parse(entry); err == nil {
-                                        break // Successfully parsed
+                p.mu.RLock()
+                parsers := p.parsers
+                p.mu.RUnlock()
+
+                matched, attempts := parser.ParseWith(parsers, entry)
+                for _, attempt := range attempts {
+                        result := "success"
+                        if attempt.Error != nil {
+                                result = "failure"
+                        }
+                        p.metrics.ParserResults.WithLabelValues(attempt.Parser, result).Inc()
+                }
+
+                if matched == "" {
+                        p.metrics.LogEntriesUnparsed.Inc()
+                        if !p.handleUnparsed(ctx, entry) {
+                                report(done, nil) // Routed to the dead-letter sink only
+                                return
+                        }
+                }
+        }
+
+        // Normalize the level so filters and stats see one spelling per severity
+        p.mu.RLock()
+        levels := p.levels
+        p.mu.RUnlock()
+
+        if levels != nil {
+                levels.NormalizeEntry(entry)
+        }
+
+        p.runPipeline(ctx, entry, 0, done)
+}
+
+// runPipeline takes an entry through the stages starting at the given index, then through
+// the filters, transformers and plugins, and finally stores or routes it
+func (p *LogProcessor) runPipeline(ctx context.Context, entry *models.LogEntry, from int, done func(error)) {
+        // Run the pipeline stages in order
+        p.mu.RLock()
+        stages := p.stages
+        p.mu.RUnlock()
+
+        for i := from; i < len(stages); i++ {
+                if stages[i].Plugin != nil {
+                        if stages[i].AppliesTo(entry.Source) && !p.runPlugin(stages[i].Plugin, entry) {
+                                report(done, nil)
+                                return
+                        }
+                        continue
+                }
+                if holder, ok := stages[i].Filter.(Holder); ok {
+                        if !stages[i].AppliesTo(entry.Source) {
+                                continue
+                        }
+                        // A held entry's outcome is reported when the stage releases it
+                        if pass, kept := holder.Hold(entry, done); !pass {
+                                if !kept {
+                                        report(done, nil)
                                 }
+                                return
+                        }
+                        continue
+                }
+                if !stages[i].Run(entry) {
+                        if _, holds := stages[i].Filter.(Flusher); !holds {
+                                p.metrics.LogEntriesFiltered.Inc()
                         }
+                        report(done, nil) // Entry filtered out or held back
+                        return
                 }
         }
 
@@ -105,7 +362,8 @@ func (p *LogProcessor) processEntry(ctx context.Context, entry *models.LogEntry)
         for _, filter := range filters {
                 if !filter.Apply(entry) {
                         p.metrics.LogEntriesFiltered.Inc()
-                        return // Entry filtered out
+                        report(done, nil) // Entry filtered out
+                        return
                 }
         }
 
@@ -124,16 +382,198 @@ func (p *LogProcessor) processEntry(ctx context.Context, entry *models.LogEntry)
         p.mu.RUnlock()
 
         for _, plugin := range plugins {
-                plugin.ProcessLogEntry(entry)
+                if !p.runPlugin(plugin, entry) {
+                        report(done, nil)
+                        return
+                }
         }
 
-        // Store the processed entry
-        if err := p.storage.Store(ctx, entry); err != nil {
+        p.deliver(ctx, entry, done)
+}
+
+// runPlugin hands an entry to a plugin, reporting whether the entry goes on
+func (p *LogProcessor) runPlugin(pl plugin.Plugin, entry *models.LogEntry) bool {
+        err := pl.ProcessLogEntry(entry)
+        if err == nil {
+                return true
+        }
+        p.metrics.PluginErrors.WithLabelValues(pl.Name(), "process").Inc()
+
+        p.mu.RLock()
+        policy := p.pluginErrors
+        p.mu.RUnlock()
+
+        switch policy {
+        case PluginErrorDrop:
+                p.metrics.LogEntriesFiltered.Inc()
+                return false
+        case PluginErrorFail:
                 p.metrics.LogEntriesErrored.Inc()
+                return false
+        }
+        return true
+}
+
+// deliver stores or routes a processed entry, reporting the outcome to done, and hands it
+// to the output plugins
+func (p *LogProcessor) deliver(ctx context.Context, entry *models.LogEntry, done func(error)) {
+        p.mu.RLock()
+        router := p.router
+        batcher := p.batcher
+        outputs := p.outputs
+        p.mu.RUnlock()
+
+        // Outputs hand entries over on their own goroutines and count the entries they drop,
+        // so they never hold the entry up
+        for _, output := range outputs {
+                _ = output.Add(ctx, entry)
+        }
+
+        var err error
+        switch {
+        case router != nil:
+                err = router.Route(ctx, entry)
+        case batcher != nil:
+                batcher.add(ctx, entry, done)
                 return
+        default:
+                err = p.storage.Store(ctx, entry)
+        }
+
+        if err != nil {
+                p.metrics.LogEntriesErrored.Inc()
+        } else {
+                p.metrics.LogEntriesProcessed.Inc()
+        }
+        report(done, err)
+}
+
+// report calls an outcome callback, if any
+func report(done func(error), err error) {
+        if done != nil {
+                done(err)
+        }
+}
+
+// Start releases entries held back by stages such as collapsing deduplication once they are due,
+// until the context is cancelled. Call Flush at shutdown to release the rest.
+func (p *LogProcessor) Start(ctx context.Context) {
+        go func() {
+                ticker := time.NewTicker(time.Second)
+                defer ticker.Stop()
+
+                for {
+                        select {
+                        case <-ctx.Done():
+                                return
+                        case now := <-ticker.C:
+                                p.flushStages(ctx, now, false)
+                        }
+                }
+        }()
+}
+
+// Flush releases every entry held back by a stage into the rest of the pipeline, and writes
+// the pending batch of stored entries
+func (p *LogProcessor) Flush(ctx context.Context) {
+        p.flushStages(ctx, time.Now(), true)
+
+        p.mu.RLock()
+        batcher := p.batcher
+        p.mu.RUnlock()
+
+        if batcher != nil {
+                batcher.flush(ctx)
+        }
+
+        // Hand the entries buffered for output plugins over
+        p.mu.RLock()
+        outputs := p.outputs
+        p.mu.RUnlock()
+
+        for _, output := range outputs {
+                _ = output.Flush(ctx)
+        }
+
+        // Deliver the entries buffered by routing targets such as webhooks
+        p.mu.RLock()
+        router := p.router
+        p.mu.RUnlock()
+
+        if router != nil {
+                _ = router.Flush(ctx)
+        }
+}
+
+// flushStages continues the entries released by held-back stages at the stage after them
+func (p *LogProcessor) flushStages(ctx context.Context, now time.Time, force bool) {
+        p.mu.RLock()
+        stages := p.stages
+        p.mu.RUnlock()
+
+        for i, stage := range stages {
+                if holder, ok := stage.Filter.(Holder); ok {
+                        for _, held := range holder.Release(now, force) {
+                                p.runPipeline(ctx, held.Entry, i+1, settleHeld(held))
+                        }
+                        continue
+                }
+                flusher, ok := stage.Filter.(Flusher)
+                if !ok {
+                        continue
+                }
+                for _, entry := range flusher.Flush(now, force) {
+                        p.runPipeline(ctx, entry, i+1, nil)
+                }
+        }
+}
+
+// settleHeld reports a released entry's outcome to its own callback. The entries folded into
+// it are settled once it is, as retrying them would store it again.
+func settleHeld(held HeldEntry) func(error) {
+        if held.Done == nil && len(held.Folded) == 0 {
+                return nil
+        }
+        return func(err error) {
+                report(held.Done, err)
+                for _, folded := range held.Folded {
+                        folded(nil)
+                }
+        }
+}
+
+// handleUnparsed writes an unparsed entry to the dead-letter sink, if any,
+// and reports whether the entry should continue through the pipeline
+func (p *LogProcessor) handleUnparsed(ctx context.Context, entry *models.LogEntry) bool {
+        p.mu.RLock()
+        sink := p.deadLetter
+        keep := p.keepDeadLetters
+        transformers := p.transformers
+        p.mu.RUnlock()
+
+        if sink == nil {
+                return true
+        }
+
+        // Dead-letter records keep the raw line, so redact it before it leaves the pipeline
+        record := entry
+        for _, transformer := range transformers {
+                if redactor, ok := transformer.(*RedactTransformer); ok {
+                        if record == entry {
+                                record = entry.Clone()
+                        }
+                        redactor.TransformRaw(record)
+                }
+        }
+
+        if err := sink.Write(ctx, record); err != nil {
+                // Keep the entry rather than lose it when the sink fails
+                p.metrics.DeadLetterErrors.Inc()
+                return true
         }
 
-        p.metrics.LogEntriesProcessed.Inc()
+        p.metrics.DeadLetterEntries.Inc()
+        return keep
 }
 
 // AddFilter adds a filter to the processing pipeline
@@ -0,0 +1,320 @@
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Redaction modes
+const (
+	// RedactModeMask replaces matches with the rule's replacement
+	RedactModeMask = "mask"
+	// RedactModeHash replaces matches with a keyed HMAC, so equal values can still be correlated
+	RedactModeHash = "hash"
+	// RedactModeDrop removes a field containing a match; a matching message is replaced as a whole
+	RedactModeDrop = "drop"
+)
+
+// Rule targets
+const (
+	// RedactTargetMessage applies a rule to the message
+	RedactTargetMessage = "message"
+	// RedactTargetAll applies a rule to the message and every string field
+	RedactTargetAll = "*"
+)
+
+// DefaultRedactReplacement replaces matches when a rule has no replacement of its own
+const DefaultRedactReplacement = "[REDACTED]"
+
+// hashedValueLength is the number of hex characters of the HMAC kept in hash mode
+const hashedValueLength = 32
+
+// Detector is a built-in pattern for a common kind of sensitive data
+type Detector struct {
+	Pattern *regexp.Regexp
+	// Valid filters out matches that only look like the data, e.g. card numbers failing the Luhn check
+	Valid func(match string) bool
+}
+
+// detectors are the built-in detectors by name
+var detectors = map[string]Detector{
+	"credit_card": {
+		Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Valid:   luhnValid,
+	},
+	"email": {
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	"jwt": {
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+	},
+	"aws_access_key": {
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AROA|AIDA)[0-9A-Z]{16}\b`),
+	},
+	"aws_secret_key": {
+		Pattern: regexp.MustCompile(`(?i)(aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?)([A-Za-z0-9/+=]{40})`),
+	},
+	"ipv4": {
+		Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		Valid:   validIPv4,
+	},
+	"ipv6": {
+		Pattern: regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}(?:[0-9a-f]{1,4}|(?:\d{1,3}\.){3}\d{1,3})?`),
+		Valid:   validIPv6,
+	},
+}
+
+// detectorReplacements keep the context the detector matched around the secret
+var detectorReplacements = map[string]string{
+	"aws_secret_key": "${1}" + DefaultRedactReplacement,
+}
+
+// DetectorNames lists the built-in detectors
+func DetectorNames() []string {
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// luhnValid reports whether the digits in a candidate card number pass the Luhn check
+func luhnValid(candidate string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(candidate) - 1; i >= 0; i-- {
+		c := candidate[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// validIPv4 rejects dotted numbers that are not addresses, such as version strings like 1.2.300.4
+func validIPv4(candidate string) bool {
+	addr, err := netip.ParseAddr(candidate)
+	return err == nil && addr.Is4()
+}
+
+// validIPv6 also requires two hex groups, so "::" in code such as "std::io" is left alone
+func validIPv6(candidate string) bool {
+	groups := 0
+	for _, group := range strings.Split(candidate, ":") {
+		if group != "" {
+			groups++
+		}
+	}
+	addr, err := netip.ParseAddr(candidate)
+	return err == nil && addr.Is6() && groups >= 2
+}
+
+// RedactRule describes what to look for, where, and what to do with it
+type RedactRule struct {
+	// Name labels the rule in metrics
+	Name string
+	// Field is the target: "message", "*", or a field name (optionally prefixed with "fields.")
+	Field string
+	// Pattern matches the sensitive data
+	Pattern *regexp.Regexp
+	// Replacement is used in mask mode and may reference capture groups ($1, ${name})
+	Replacement string
+	// Mode is mask, hash or drop
+	Mode string
+	// Valid optionally rejects matches that are not really sensitive
+	Valid func(match string) bool
+}
+
+// NewRedactRule creates a mask rule from a regular expression
+func NewRedactRule(name, field, pattern, replacement string) (*RedactRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+	}
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	return &RedactRule{
+		Name:        name,
+		Field:       field,
+		Pattern:     re,
+		Replacement: replacement,
+		Mode:        RedactModeMask,
+	}, nil
+}
+
+// NewDetectorRule creates a mask rule from a built-in detector
+func NewDetectorRule(detector, field string) (*RedactRule, error) {
+	d, ok := detectors[detector]
+	if !ok {
+		return nil, fmt.Errorf("unknown detector %q (available: %s)", detector, strings.Join(DetectorNames(), ", "))
+	}
+	replacement, ok := detectorReplacements[detector]
+	if !ok {
+		replacement = DefaultRedactReplacement
+	}
+	return &RedactRule{
+		Name:        detector,
+		Field:       field,
+		Pattern:     d.Pattern,
+		Replacement: replacement,
+		Mode:        RedactModeMask,
+		Valid:       d.Valid,
+	}, nil
+}
+
+// WithMode sets the redaction mode
+func (r *RedactRule) WithMode(mode string) (*RedactRule, error) {
+	switch mode {
+	case "":
+		mode = RedactModeMask
+	case RedactModeMask, RedactModeHash, RedactModeDrop:
+	default:
+		return nil, fmt.Errorf("invalid redaction mode %q (must be mask, hash or drop)", mode)
+	}
+	r.Mode = mode
+	return r, nil
+}
+
+// RedactTransformer masks, hashes or drops sensitive data in log entries
+type RedactTransformer struct {
+	rules   []*RedactRule
+	hashKey []byte
+	metrics *metrics.Metrics
+}
+
+// NewRedactTransformer creates a transformer applying the rules in order.
+// The hash key is required by rules in hash mode.
+func NewRedactTransformer(hashKey string, rules ...*RedactRule) (*RedactTransformer, error) {
+	for _, rule := range rules {
+		if rule.Mode == RedactModeHash && hashKey == "" {
+			return nil, fmt.Errorf("redaction rule %s uses hash mode but no hash key is set", rule.Name)
+		}
+	}
+	return &RedactTransformer{
+		rules:   rules,
+		hashKey: []byte(hashKey),
+		metrics: metrics.GetMetrics(),
+	}, nil
+}
+
+// Transform implements the Transformer interface
+func (t *RedactTransformer) Transform(entry *models.LogEntry) {
+	for _, rule := range t.rules {
+		switch target := strings.TrimPrefix(rule.Field, "fields."); target {
+		case "", RedactTargetMessage:
+			t.redactMessage(rule, entry)
+		case RedactTargetAll:
+			t.redactMessage(rule, entry)
+			for key := range entry.Fields {
+				t.redactField(rule, entry, key)
+			}
+		default:
+			t.redactField(rule, entry, target)
+		}
+	}
+}
+
+// TransformRaw is Transform, also redacting the raw line. Every rule applies to the raw line,
+// as it holds the values of all the fields. It is used for entries kept unparsed, such as
+// dead-letter records.
+func (t *RedactTransformer) TransformRaw(entry *models.LogEntry) {
+	t.Transform(entry)
+	for _, rule := range t.rules {
+		redacted, count := t.redact(rule, entry.RawData)
+		if count == 0 {
+			continue
+		}
+		entry.RawData = redacted
+		t.metrics.Redactions.WithLabelValues(rule.Name).Add(float64(count))
+	}
+}
+
+// redactMessage applies a rule to the message
+func (t *RedactTransformer) redactMessage(rule *RedactRule, entry *models.LogEntry) {
+	redacted, count := t.redact(rule, entry.Message)
+	if count == 0 {
+		return
+	}
+	if rule.Mode == RedactModeDrop {
+		redacted = DefaultRedactReplacement
+	}
+	entry.Message = redacted
+	t.metrics.Redactions.WithLabelValues(rule.Name).Add(float64(count))
+}
+
+// redactField applies a rule to a string field
+func (t *RedactTransformer) redactField(rule *RedactRule, entry *models.LogEntry, key string) {
+	value, ok := entry.Fields[key].(string)
+	if !ok {
+		return
+	}
+	redacted, count := t.redact(rule, value)
+	if count == 0 {
+		return
+	}
+	if rule.Mode == RedactModeDrop {
+		delete(entry.Fields, key)
+	} else {
+		entry.Fields[key] = redacted
+	}
+	t.metrics.Redactions.WithLabelValues(rule.Name).Add(float64(count))
+}
+
+// redact replaces every valid match in value, returning the result and the number of matches
+func (t *RedactTransformer) redact(rule *RedactRule, value string) (string, int) {
+	matches := rule.Pattern.FindAllStringSubmatchIndex(value, -1)
+	if matches == nil {
+		return value, 0
+	}
+
+	var b strings.Builder
+	count, last := 0, 0
+	for _, m := range matches {
+		match := value[m[0]:m[1]]
+		if rule.Valid != nil && !rule.Valid(match) {
+			continue
+		}
+		count++
+
+		b.WriteString(value[last:m[0]])
+		if rule.Mode == RedactModeHash {
+			b.WriteString(t.hash(match))
+		} else {
+			b.Write(rule.Pattern.ExpandString(nil, rule.Replacement, value, m))
+		}
+		last = m[1]
+	}
+	if count == 0 {
+		return value, 0
+	}
+	b.WriteString(value[last:])
+	return b.String(), count
+}
+
+// hash returns a keyed, truncated HMAC-SHA256 of a value
+func (t *RedactTransformer) hash(value string) string {
+	mac := hmac.New(sha256.New, t.hashKey)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:hashedValueLength]
+}
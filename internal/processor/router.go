@@ -0,0 +1,169 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/internal/storage"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// DefaultRouteName is the name of the route catching entries no route stopped
+const DefaultRouteName = "default"
+
+// Target receives routed log entries
+type Target interface {
+	// Name identifies the target in metrics and errors
+	Name() string
+	// Send delivers an entry
+	Send(ctx context.Context, entry *models.LogEntry) error
+}
+
+// FlushingTarget is a target that buffers entries, delivering them when flushed
+type FlushingTarget interface {
+	Target
+	// Flush delivers the buffered entries
+	Flush(ctx context.Context) error
+}
+
+// StorageTarget delivers entries to a storage backend
+type StorageTarget struct {
+	name    string
+	storage storage.Storage
+}
+
+// NewStorageTarget creates a target storing entries in a storage
+func NewStorageTarget(name string, storage storage.Storage) *StorageTarget {
+	return &StorageTarget{name: name, storage: storage}
+}
+
+// Name implements the Target interface
+func (t *StorageTarget) Name() string {
+	return t.name
+}
+
+// Send implements the Target interface
+func (t *StorageTarget) Send(ctx context.Context, entry *models.LogEntry) error {
+	return t.storage.Store(ctx, entry)
+}
+
+// Route sends the entries matching a filter to its targets
+type Route struct {
+	Name    string
+	Filter  Filter
+	Targets []Target
+	// Continue lets matching entries go on to later routes; otherwise routing stops at this route
+	Continue bool
+}
+
+// NewRoute creates a route that stops at the first match. A nil filter matches every entry.
+func NewRoute(name string, filter Filter, targets ...Target) *Route {
+	return &Route{
+		Name:    name,
+		Filter:  filter,
+		Targets: targets,
+	}
+}
+
+// WithContinue sets whether matching entries are also offered to later routes
+func (r *Route) WithContinue(cont bool) *Route {
+	r.Continue = cont
+	return r
+}
+
+// matches reports whether the route selects an entry
+func (r *Route) matches(entry *models.LogEntry) bool {
+	return r.Filter == nil || r.Filter.Apply(entry)
+}
+
+// Router delivers entries to targets according to ordered routes.
+// Routes are tried in order; an entry goes to the targets of every matching route until
+// one without Continue matches. Entries that reach the end of the list go to the default route.
+// An entry is sent to each target at most once.
+type Router struct {
+	routes   []*Route
+	fallback *Route
+	metrics  *metrics.Metrics
+}
+
+// NewRouter creates a router whose default route sends to the given targets
+func NewRouter(defaultTargets ...Target) *Router {
+	return &Router{
+		fallback: NewRoute(DefaultRouteName, nil, defaultTargets...),
+		metrics:  metrics.GetMetrics(),
+	}
+}
+
+// AddRoute appends a route
+func (r *Router) AddRoute(route *Route) *Router {
+	r.routes = append(r.routes, route)
+	return r
+}
+
+// Routes returns the routes in order, followed by the default route
+func (r *Router) Routes() []*Route {
+	return append(append([]*Route{}, r.routes...), r.fallback)
+}
+
+// Flush delivers the entries buffered by the targets of every route
+func (r *Router) Flush(ctx context.Context) error {
+	flushed := make(map[Target]bool)
+	var errs []error
+	for _, route := range r.Routes() {
+		for _, target := range route.Targets {
+			flusher, ok := target.(FlushingTarget)
+			if !ok || flushed[target] {
+				continue
+			}
+			flushed[target] = true
+			if err := flusher.Flush(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("target %s: %w", target.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Route delivers an entry, returning an error if any target failed
+func (r *Router) Route(ctx context.Context, entry *models.LogEntry) error {
+	sent := make(map[Target]bool)
+	var errs []error
+
+	stopped := false
+	for _, route := range r.routes {
+		if !route.matches(entry) {
+			continue
+		}
+		errs = append(errs, r.deliver(ctx, route, entry, sent)...)
+		if !route.Continue {
+			stopped = true
+			break
+		}
+	}
+	if !stopped {
+		errs = append(errs, r.deliver(ctx, r.fallback, entry, sent)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliver sends an entry to the route's targets that haven't received it yet
+func (r *Router) deliver(ctx context.Context, route *Route, entry *models.LogEntry, sent map[Target]bool) []error {
+	r.metrics.RouteEntries.WithLabelValues(route.Name).Inc()
+
+	var errs []error
+	for _, target := range route.Targets {
+		if sent[target] {
+			continue
+		}
+		sent[target] = true
+
+		if err := target.Send(ctx, entry); err != nil {
+			r.metrics.RouteErrors.WithLabelValues(route.Name, target.Name()).Inc()
+			errs = append(errs, fmt.Errorf("route %s: target %s: %w", route.Name, target.Name(), err))
+		}
+	}
+	return errs
+}
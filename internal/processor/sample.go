@@ -0,0 +1,347 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// DefaultThrottleMaxSources bounds the number of per-source token buckets when no limit is set
+const DefaultThrottleMaxSources = 10000
+
+// DefaultThrottleMaxLabels bounds the sources throttled entries are counted under when no limit is set
+const DefaultThrottleMaxLabels = 1000
+
+// throttleWindow is the period over which a throttled source's kept fraction is measured
+const throttleWindow = time.Second
+
+// sourceRate is a rate applying to the sources matching a pattern
+type sourceRate struct {
+	pattern string
+	rate    float64
+	burst   float64
+}
+
+// matchSource reports whether a source equals a pattern or matches it as a path.Match pattern
+func matchSource(pattern, source string) bool {
+	if pattern == source {
+		return true
+	}
+	matched, _ := path.Match(pattern, source)
+	return matched
+}
+
+// validateRate checks a sampling rate
+func validateRate(rate float64) error {
+	if rate <= 0 || rate > 1 || math.IsNaN(rate) {
+		return fmt.Errorf("sample rate must be greater than 0 and at most 1, got %v", rate)
+	}
+	return nil
+}
+
+// recordSampleRate multiplies the sample rate recorded on an entry by rate
+func recordSampleRate(entry *models.LogEntry, rate float64) {
+	if rate < 1 {
+		entry.AddField(models.FieldSampleRate, entry.SampleRate()*rate)
+	}
+}
+
+// Sampler is a filter keeping a fraction of entries. The rate of an entry is the first
+// matching source rate, else the rate of its level, else the default rate. Entries at or
+// above the keep level (error by default) are always kept. Kept entries record their
+// sample rate in Fields[models.FieldSampleRate] so counts can be re-weighted.
+// It is safe for concurrent use.
+type Sampler struct {
+	rate        float64
+	sourceRates []sourceRate
+	levelRates  map[models.Level]float64
+	keepLevel   models.Level
+	keyField    string
+
+	mu     sync.Mutex
+	random func() float64
+
+	metrics *metrics.Metrics
+}
+
+// NewSampler creates a sampler keeping entries at the given default rate (0 < rate <= 1)
+func NewSampler(rate float64) (*Sampler, error) {
+	if err := validateRate(rate); err != nil {
+		return nil, err
+	}
+	return &Sampler{
+		rate:       rate,
+		levelRates: make(map[models.Level]float64),
+		keepLevel:  models.LevelError,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+		metrics:    metrics.GetMetrics(),
+	}, nil
+}
+
+// WithSourceRate sets the rate of the sources matching a pattern (exact or path.Match)
+func (s *Sampler) WithSourceRate(source string, rate float64) (*Sampler, error) {
+	if err := validateRate(rate); err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(source, ""); err != nil {
+		return nil, fmt.Errorf("invalid source pattern %q: %w", source, err)
+	}
+	s.sourceRates = append(s.sourceRates, sourceRate{pattern: source, rate: rate})
+	return s, nil
+}
+
+// WithLevelRate sets the rate of a canonical level
+func (s *Sampler) WithLevelRate(level string, rate float64) (*Sampler, error) {
+	if err := validateRate(rate); err != nil {
+		return nil, err
+	}
+	parsed, err := models.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	s.levelRates[parsed] = rate
+	return s, nil
+}
+
+// WithKeepLevel sets the level from which entries are always kept; "none" samples every level
+func (s *Sampler) WithKeepLevel(level string) (*Sampler, error) {
+	if level == "none" {
+		s.keepLevel = models.LevelUnknown
+		return s, nil
+	}
+	parsed, err := models.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	s.keepLevel = parsed
+	return s, nil
+}
+
+// WithKeyField makes sampling deterministic on a field such as trace_id: entries sharing a
+// value are all kept or all dropped, across processes. Entries without the field are sampled randomly.
+func (s *Sampler) WithKeyField(field string) *Sampler {
+	s.keyField = field
+	return s
+}
+
+// WithRandom sets the source of random numbers in [0, 1), for tests
+func (s *Sampler) WithRandom(random func() float64) *Sampler {
+	s.random = random
+	return s
+}
+
+// rateOf returns the sample rate applying to an entry
+func (s *Sampler) rateOf(entry *models.LogEntry, level models.Level, known bool) float64 {
+	for _, sr := range s.sourceRates {
+		if matchSource(sr.pattern, entry.Source) {
+			return sr.rate
+		}
+	}
+	if known {
+		if rate, ok := s.levelRates[level]; ok {
+			return rate
+		}
+	}
+	return s.rate
+}
+
+// position maps an entry onto [0, 1), from its key field when it has one
+func (s *Sampler) position(entry *models.LogEntry) float64 {
+	if s.keyField != "" {
+		if value, ok := entry.GetStringField(s.keyField); ok && value != "" {
+			sum := sha256.Sum256([]byte(value))
+			// The top 53 bits fill a float64 mantissa exactly
+			return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.random()
+}
+
+// Apply implements the Filter interface
+func (s *Sampler) Apply(entry *models.LogEntry) bool {
+	level, known := models.NormalizeLevel(entry.Level)
+	if known && s.keepLevel != models.LevelUnknown && level >= s.keepLevel {
+		return true
+	}
+
+	rate := s.rateOf(entry, level, known)
+	if rate >= 1 {
+		return true
+	}
+	if s.position(entry) >= rate {
+		s.metrics.LogEntriesSampledOut.Inc()
+		return false
+	}
+	recordSampleRate(entry, rate)
+	return true
+}
+
+// tokenBucket tracks the budget of one source
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+
+	// windowStart, seen and kept measure the current window; keptRate is the fraction
+	// of the previous window that was kept
+	windowStart time.Time
+	seen        int
+	kept        int
+	keptRate    float64
+}
+
+// Throttler is a filter limiting each source to a rate with a token bucket. Entries beyond
+// the budget are dropped and counted per source. As the rate a throttled entry stands for
+// isn't known until its window ends, kept entries record the kept fraction of their source's
+// previous one-second window as their sample rate. Once as many sources as the label cap have
+// been counted, entries of other sources are counted under LogMetricOverflow. It is safe for
+// concurrent use.
+type Throttler struct {
+	rate      float64
+	burst     float64
+	overrides []sourceRate
+	clock     func() time.Time
+
+	mu      sync.Mutex
+	buckets *lruCache[string, *tokenBucket]
+
+	maxLabels int
+	labeled   map[string]struct{}
+	metrics   *metrics.Metrics
+}
+
+// bucketSize returns the burst of a limit, defaulting to one second's worth of entries
+func bucketSize(rate float64, burst int) float64 {
+	if burst > 0 {
+		return float64(burst)
+	}
+	return math.Max(1, math.Ceil(rate))
+}
+
+// NewThrottler creates a throttler letting each source through at rate entries per second,
+// with bursts of up to burst entries (one second's worth when burst is zero)
+func NewThrottler(rate float64, burst int) (*Throttler, error) {
+	if rate <= 0 || math.IsNaN(rate) {
+		return nil, fmt.Errorf("throttle rate must be positive")
+	}
+	if burst < 0 {
+		return nil, fmt.Errorf("throttle burst must not be negative")
+	}
+	return &Throttler{
+		rate:      rate,
+		burst:     bucketSize(rate, burst),
+		clock:     time.Now,
+		buckets:   newLRUCache[string, *tokenBucket](DefaultThrottleMaxSources),
+		maxLabels: DefaultThrottleMaxLabels,
+		labeled:   make(map[string]struct{}),
+		metrics:   metrics.GetMetrics(),
+	}, nil
+}
+
+// WithSourceLimit sets the limit of the sources matching a pattern (exact or path.Match)
+func (t *Throttler) WithSourceLimit(source string, rate float64, burst int) (*Throttler, error) {
+	if rate <= 0 || math.IsNaN(rate) {
+		return nil, fmt.Errorf("throttle rate of %s must be positive", source)
+	}
+	if burst < 0 {
+		return nil, fmt.Errorf("throttle burst of %s must not be negative", source)
+	}
+	if _, err := path.Match(source, ""); err != nil {
+		return nil, fmt.Errorf("invalid source pattern %q: %w", source, err)
+	}
+	t.overrides = append(t.overrides, sourceRate{pattern: source, rate: rate, burst: bucketSize(rate, burst)})
+	return t, nil
+}
+
+// WithMaxSources bounds the number of tracked sources; the least recently seen is forgotten beyond it
+func (t *Throttler) WithMaxSources(maxSources int) *Throttler {
+	if maxSources > 0 {
+		t.buckets = newLRUCache[string, *tokenBucket](maxSources)
+	}
+	return t
+}
+
+// WithMaxLabels bounds the sources throttled entries are counted under
+func (t *Throttler) WithMaxLabels(maxLabels int) *Throttler {
+	if maxLabels > 0 {
+		t.maxLabels = maxLabels
+	}
+	return t
+}
+
+// WithClock sets the time source, for tests
+func (t *Throttler) WithClock(clock func() time.Time) *Throttler {
+	t.clock = clock
+	return t
+}
+
+// limitOf returns the rate and burst applying to a source
+func (t *Throttler) limitOf(source string) (float64, float64) {
+	for _, override := range t.overrides {
+		if matchSource(override.pattern, source) {
+			return override.rate, override.burst
+		}
+	}
+	return t.rate, t.burst
+}
+
+// labelOf returns the label a source's throttled entries are counted under, with t.mu held
+func (t *Throttler) labelOf(source string) string {
+	if _, ok := t.labeled[source]; ok {
+		return source
+	}
+	if len(t.labeled) < t.maxLabels {
+		t.labeled[source] = struct{}{}
+		return source
+	}
+	return LogMetricOverflow
+}
+
+// Apply implements the Filter interface
+func (t *Throttler) Apply(entry *models.LogEntry) bool {
+	now := t.clock()
+	rate, burst := t.limitOf(entry.Source)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket, ok := t.buckets.Get(entry.Source)
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now, windowStart: now, keptRate: 1}
+		t.buckets.Add(entry.Source, bucket)
+	}
+
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed.Seconds()*rate)
+		bucket.last = now
+	}
+	if elapsed := now.Sub(bucket.windowStart); elapsed >= throttleWindow {
+		bucket.keptRate = 1
+		if bucket.seen > 0 && elapsed < 2*throttleWindow {
+			// A window where nothing was kept still stands for at least one entry
+			bucket.keptRate = math.Max(1, float64(bucket.kept)) / float64(bucket.seen)
+		}
+		bucket.windowStart = now
+		bucket.seen, bucket.kept = 0, 0
+	}
+
+	bucket.seen++
+	if bucket.tokens < 1 {
+		t.metrics.ThrottledEntries.WithLabelValues(t.labelOf(entry.Source)).Inc()
+		return false
+	}
+	bucket.tokens--
+	bucket.kept++
+	recordSampleRate(entry, bucket.keptRate)
+	return true
+}
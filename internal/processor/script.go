@@ -0,0 +1,390 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// DefaultScriptTimeout bounds each script call when no budget is set
+const DefaultScriptTimeout = 50 * time.Millisecond
+
+// ScriptFunction is the global function scripts define to process an entry
+const ScriptFunction = "process"
+
+// scriptUnsafeGlobals are base library functions removed from the sandbox
+var scriptUnsafeGlobals = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "print", "collectgarbage"}
+
+// scriptVM is an interpreter with the script loaded
+type scriptVM struct {
+	state   *lua.LState
+	process *lua.LFunction
+}
+
+// ScriptFilter runs a Lua script per entry. The script defines
+//
+//	function process(entry) ... end
+//
+// where entry is a table with timestamp (Unix seconds), source, level, message and fields.
+// Changes to the table are copied back to the entry, and returning false drops it.
+// Scripts run sandboxed (base, string, table and math libraries, plus json.encode and
+// json.decode) under a time budget per call. A call that fails or runs out of time leaves
+// the entry unchanged. Interpreters are pooled, so globals set by a script may or may not
+// be seen by later calls. It is safe for concurrent use.
+type ScriptFilter struct {
+	name    string
+	proto   *lua.FunctionProto
+	timeout time.Duration
+	pool    chan *scriptVM
+
+	metrics *metrics.Metrics
+}
+
+// NewScriptFilter compiles a Lua script; name labels it in errors and metrics
+func NewScriptFilter(name, source string) (*ScriptFilter, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script %s: %w", name, err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script %s: %w", name, err)
+	}
+
+	s := &ScriptFilter{
+		name:    name,
+		proto:   proto,
+		timeout: DefaultScriptTimeout,
+		pool:    make(chan *scriptVM, runtime.GOMAXPROCS(0)),
+		metrics: metrics.GetMetrics(),
+	}
+
+	// Load the script once to check it defines the process function
+	vm, err := s.newVM()
+	if err != nil {
+		return nil, err
+	}
+	s.release(vm)
+	return s, nil
+}
+
+// WithTimeout sets the time budget of each call
+func (s *ScriptFilter) WithTimeout(timeout time.Duration) *ScriptFilter {
+	if timeout > 0 {
+		s.timeout = timeout
+	}
+	return s
+}
+
+// WithPoolSize sets how many idle interpreters are kept, typically one per worker
+func (s *ScriptFilter) WithPoolSize(size int) *ScriptFilter {
+	if size < 1 {
+		return s
+	}
+	old := s.pool
+	s.pool = make(chan *scriptVM, size)
+	for {
+		select {
+		case vm := <-old:
+			s.release(vm)
+		default:
+			return s
+		}
+	}
+}
+
+// Name returns the script name
+func (s *ScriptFilter) Name() string {
+	return s.name
+}
+
+// newVM creates a sandboxed interpreter and runs the script in it
+func (s *ScriptFilter) newVM() (*scriptVM, error) {
+	state := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   256,
+		RegistrySize:    1024,
+		RegistryMaxSize: 1024 * 1024,
+	})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	for _, name := range scriptUnsafeGlobals {
+		state.SetGlobal(name, lua.LNil)
+	}
+	state.SetGlobal("json", state.SetFuncs(state.NewTable(), map[string]lua.LGFunction{
+		"encode": scriptJSONEncode,
+		"decode": scriptJSONDecode,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	state.SetContext(ctx)
+	state.Push(state.NewFunctionFromProto(s.proto))
+	err := state.PCall(0, 0, nil)
+	state.RemoveContext()
+	if err != nil {
+		state.Close()
+		return nil, fmt.Errorf("script %s failed to load: %w", s.name, err)
+	}
+
+	process, ok := state.GetGlobal(ScriptFunction).(*lua.LFunction)
+	if !ok {
+		state.Close()
+		return nil, fmt.Errorf("script %s doesn't define a %s function", s.name, ScriptFunction)
+	}
+	return &scriptVM{state: state, process: process}, nil
+}
+
+// acquire takes an idle interpreter or creates one
+func (s *ScriptFilter) acquire() (*scriptVM, error) {
+	select {
+	case vm := <-s.pool:
+		return vm, nil
+	default:
+		return s.newVM()
+	}
+}
+
+// release returns an interpreter to the pool, closing it when the pool is full
+func (s *ScriptFilter) release(vm *scriptVM) {
+	select {
+	case s.pool <- vm:
+	default:
+		vm.state.Close()
+	}
+}
+
+// Close releases the idle interpreters
+func (s *ScriptFilter) Close() {
+	for {
+		select {
+		case vm := <-s.pool:
+			vm.state.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Apply implements the Filter interface
+func (s *ScriptFilter) Apply(entry *models.LogEntry) bool {
+	vm, err := s.acquire()
+	if err != nil {
+		s.metrics.ScriptErrors.WithLabelValues(s.name).Inc()
+		return true
+	}
+
+	state := vm.state
+	table := entryToLua(state, entry)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	state.SetContext(ctx)
+	err = state.CallByParam(lua.P{Fn: vm.process, NRet: 1, Protect: true}, table)
+	state.RemoveContext()
+	cancel()
+	if err != nil {
+		// An interrupted interpreter may be left in any state, so it isn't reused
+		state.Close()
+		s.metrics.ScriptErrors.WithLabelValues(s.name).Inc()
+		return true
+	}
+	result := state.Get(-1)
+	state.Pop(1)
+	s.release(vm)
+
+	if result == lua.LFalse {
+		return false
+	}
+	entryFromLua(table, entry)
+	return true
+}
+
+// entryToLua builds the table scripts see for an entry
+func entryToLua(state *lua.LState, entry *models.LogEntry) *lua.LTable {
+	table := state.NewTable()
+	table.RawSetString("timestamp", lua.LNumber(unixSeconds(entry.Timestamp)))
+	table.RawSetString("source", lua.LString(entry.Source))
+	table.RawSetString("level", lua.LString(entry.Level))
+	table.RawSetString("message", lua.LString(entry.Message))
+
+	fields := state.NewTable()
+	for key, value := range entry.Fields {
+		fields.RawSetString(key, toLua(state, value))
+	}
+	table.RawSetString("fields", fields)
+	return table
+}
+
+// unixSeconds returns a time as fractional Unix seconds
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// entryFromLua copies a script's changes back to the entry
+func entryFromLua(table *lua.LTable, entry *models.LogEntry) {
+	switch ts := table.RawGetString("timestamp").(type) {
+	case lua.LNumber:
+		// Unchanged timestamps keep their nanoseconds, which a float can't hold
+		if float64(ts) != unixSeconds(entry.Timestamp) {
+			sec, frac := math.Modf(float64(ts))
+			entry.Timestamp = time.Unix(int64(sec), int64(frac*1e9)).UTC()
+		}
+	case lua.LString:
+		if t, err := time.Parse(time.RFC3339Nano, string(ts)); err == nil {
+			entry.Timestamp = t
+		}
+	}
+	if source, ok := table.RawGetString("source").(lua.LString); ok {
+		entry.Source = string(source)
+	}
+	if level, ok := table.RawGetString("level").(lua.LString); ok {
+		entry.Level = string(level)
+	}
+	if message, ok := table.RawGetString("message").(lua.LString); ok {
+		entry.Message = string(message)
+	}
+
+	fields, ok := table.RawGetString("fields").(*lua.LTable)
+	if !ok {
+		entry.Fields = make(map[string]interface{})
+		return
+	}
+	result := make(map[string]interface{})
+	fields.ForEach(func(key, value lua.LValue) {
+		// Untouched fields keep their value, so times and whole floats don't change type
+		if original, ok := entry.Fields[key.String()]; ok && unchangedInLua(original, value) {
+			result[key.String()] = original
+			return
+		}
+		if converted := fromLua(value); converted != nil {
+			result[key.String()] = converted
+		}
+	})
+	entry.Fields = result
+}
+
+// unchangedInLua reports whether a Lua value is still what a field was converted to.
+// Tables are never taken as unchanged, as scripts may have modified them in place.
+func unchangedInLua(original interface{}, value lua.LValue) bool {
+	if _, ok := value.(*lua.LTable); ok {
+		return false
+	}
+	switch normalizeValue(original).(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	// Values other than lists and objects are converted without the interpreter
+	return toLua(nil, original) == value
+}
+
+// toLua converts a Go value to a Lua value
+func toLua(state *lua.LState, value interface{}) lua.LValue {
+	switch v := normalizeValue(value).(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case time.Time:
+		return lua.LString(v.Format(time.RFC3339Nano))
+	case []interface{}:
+		table := state.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(toLua(state, item))
+		}
+		return table
+	case map[string]interface{}:
+		table := state.CreateTable(0, len(v))
+		for key, item := range v {
+			table.RawSetString(key, toLua(state, item))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua converts a Lua value to a Go value. Tables with keys 1..n become lists,
+// other tables objects; whole numbers become ints.
+func fromLua(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int(f)
+		}
+		return f
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && v.Len() == n {
+			count := 0
+			v.ForEach(func(lua.LValue, lua.LValue) { count++ })
+			if count == n {
+				list := make([]interface{}, 0, n)
+				for i := 1; i <= n; i++ {
+					list = append(list, fromLua(v.RawGetInt(i)))
+				}
+				return list
+			}
+		}
+		object := make(map[string]interface{})
+		v.ForEach(func(key, item lua.LValue) {
+			if converted := fromLua(item); converted != nil {
+				object[key.String()] = converted
+			}
+		})
+		return object
+	default:
+		return nil
+	}
+}
+
+// scriptJSONEncode implements json.encode(value)
+func scriptJSONEncode(state *lua.LState) int {
+	encoded, err := json.Marshal(fromLua(state.CheckAny(1)))
+	if err != nil {
+		state.RaiseError("json.encode: %v", err)
+		return 0
+	}
+	state.Push(lua.LString(encoded))
+	return 1
+}
+
+// scriptJSONDecode implements json.decode(string), returning nil and an error message on failure
+func scriptJSONDecode(state *lua.LState) int {
+	var value interface{}
+	if err := json.Unmarshal([]byte(state.CheckString(1)), &value); err != nil {
+		state.Push(lua.LNil)
+		state.Push(lua.LString(err.Error()))
+		return 2
+	}
+	state.Push(toLua(state, value))
+	return 1
+}
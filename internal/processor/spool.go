@@ -0,0 +1,236 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/plugin"
+	"github.com/mariasu11/logstreamApp/pkg/queue"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+// Delays between attempts to deliver a spooled entry, or to hand a batch to a full worker pool
+const (
+	spoolRetryMinDelay = 100 * time.Millisecond
+	spoolRetryMaxDelay = 5 * time.Second
+)
+
+// SpoolProcessor puts batches on a disk queue before they are processed, so bursts are
+// absorbed on disk and survive restarts. A batch is acknowledged once each of its entries
+// is stored or routed, or dropped by the pipeline; until then it is delivered again when
+// the process restarts, giving at-least-once delivery from collectors to storage. Entries
+// the storage refuses are retried until it accepts them or the processor stops. The worker
+// pool must block or reject when full: a dropped job would leave its batch unacknowledged.
+type SpoolProcessor struct {
+	processor *LogProcessor
+	queue     *queue.DiskQueue
+	wg        sync.WaitGroup
+	retrying  atomic.Int32
+	metrics   *metrics.Metrics
+}
+
+// spoolBatch tracks the entries of a queued batch still being processed
+type spoolBatch struct {
+	seq       uint64
+	remaining int32
+	failed    atomic.Bool
+}
+
+// NewSpoolProcessor creates a processor spooling batches to a queue before handing them to proc
+func NewSpoolProcessor(proc *LogProcessor, q *queue.DiskQueue) *SpoolProcessor {
+	s := &SpoolProcessor{
+		processor: proc,
+		queue:     q,
+		metrics:   metrics.GetMetrics(),
+	}
+	s.updateMetrics()
+	return s
+}
+
+// Process implements the Processor interface. It returns once the batch is queued; a full
+// queue refuses the whole batch with a BackpressureError.
+func (s *SpoolProcessor) Process(ctx context.Context, entries []*models.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.queue.Append(data); err != nil {
+		if errors.Is(err, queue.ErrFull) {
+			return &BackpressureError{Accepted: 0, Err: err}
+		}
+		return err
+	}
+	s.updateMetrics()
+	return nil
+}
+
+// Start hands queued batches, beginning with those left by a previous run, to the worker
+// pool until the context is cancelled. While the storage refuses entries, no more batches
+// are handed over, so they wait on disk rather than in memory.
+func (s *SpoolProcessor) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			if !s.waitRetries(ctx) {
+				return
+			}
+			record, err := s.queue.Read(ctx)
+			if err != nil {
+				return // Cancelled or closed
+			}
+			if !s.dispatch(ctx, record) {
+				return
+			}
+		}
+	}()
+}
+
+// dispatch submits the entries of a batch, reporting false when the processor is stopping
+func (s *SpoolProcessor) dispatch(ctx context.Context, record queue.Record) bool {
+	var entries []*models.LogEntry
+	if err := json.Unmarshal(record.Data, &entries); err != nil || len(entries) == 0 {
+		// An unreadable batch can never be delivered
+		s.metrics.LogEntriesErrored.Inc()
+		s.ack(record.Seq)
+		return true
+	}
+
+	s.metrics.LogBatchesReceived.Inc()
+	s.metrics.LogEntriesReceived.Add(float64(len(entries)))
+
+	batch := &spoolBatch{seq: record.Seq, remaining: int32(len(entries))}
+	for _, entry := range entries {
+		entry := entry // capture for goroutine
+		job := func() {
+			s.processor.processEntry(ctx, entry, func(err error) {
+				s.settle(ctx, batch, entry, err, spoolRetryMinDelay)
+			})
+		}
+
+		delay := spoolRetryMinDelay
+		for {
+			err := s.processor.submit(ctx, entry, job)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, worker.ErrQueueFull) {
+				return false // The batch is delivered again on the next start
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(delay):
+			}
+			delay = nextSpoolDelay(delay)
+		}
+	}
+	return true
+}
+
+// settle records the outcome of an entry's delivery. A failed delivery is tried again after
+// the delay, until it succeeds or the context is done; the batch is acknowledged once all
+// its entries are delivered.
+func (s *SpoolProcessor) settle(ctx context.Context, batch *spoolBatch, entry *models.LogEntry, err error, delay time.Duration) {
+	if err == nil {
+		s.finish(batch)
+		return
+	}
+
+	s.retrying.Add(1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.retrying.Add(-1)
+
+		select {
+		case <-ctx.Done():
+			// The batch is delivered again on the next start
+			batch.failed.Store(true)
+			s.finish(batch)
+		case <-time.After(delay):
+			s.metrics.SpoolRetries.Inc()
+			s.processor.deliver(ctx, entry, func(err error) {
+				s.settle(ctx, batch, entry, err, nextSpoolDelay(delay))
+			})
+		}
+	}()
+}
+
+// finish counts an entry of a batch as done, acknowledging the batch after its last entry
+// unless one of them failed
+func (s *SpoolProcessor) finish(batch *spoolBatch) {
+	if atomic.AddInt32(&batch.remaining, -1) == 0 && !batch.failed.Load() {
+		s.ack(batch.seq)
+	}
+}
+
+// waitRetries waits for entries being retried to be delivered, reporting false if the
+// context is done first
+func (s *SpoolProcessor) waitRetries(ctx context.Context) bool {
+	for s.retrying.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(spoolRetryMinDelay):
+		}
+	}
+	return true
+}
+
+// nextSpoolDelay doubles a retry delay up to the maximum
+func nextSpoolDelay(delay time.Duration) time.Duration {
+	if delay *= 2; delay > spoolRetryMaxDelay {
+		return spoolRetryMaxDelay
+	}
+	return delay
+}
+
+// ack acknowledges a batch
+func (s *SpoolProcessor) ack(seq uint64) {
+	if err := s.queue.Ack(seq); err != nil && !errors.Is(err, queue.ErrClosed) {
+		s.metrics.StorageErrors.WithLabelValues("spool_ack").Inc()
+	}
+	s.updateMetrics()
+}
+
+// updateMetrics publishes the queue's size
+func (s *SpoolProcessor) updateMetrics() {
+	s.metrics.SpoolBytes.Set(float64(s.queue.Size()))
+	s.metrics.SpoolBatches.Set(float64(s.queue.Len()))
+}
+
+// Close waits for the dispatcher and pending retries to stop and closes the queue. Cancel the
+// context given to Start, stop the worker pool and flush the processor, so running batches
+// are acknowledged, before calling it.
+func (s *SpoolProcessor) Close() error {
+	s.wg.Wait()
+	return s.queue.Close()
+}
+
+// AddFilter adds a filter to the processing pipeline
+func (s *SpoolProcessor) AddFilter(filter Filter) Processor {
+	s.processor.AddFilter(filter)
+	return s
+}
+
+// AddTransformer adds a transformer to the processing pipeline
+func (s *SpoolProcessor) AddTransformer(transformer Transformer) Processor {
+	s.processor.AddTransformer(transformer)
+	return s
+}
+
+// AddPlugin adds a plugin to the processing pipeline
+func (s *SpoolProcessor) AddPlugin(p plugin.Plugin) Processor {
+	s.processor.AddPlugin(p)
+	return s
+}
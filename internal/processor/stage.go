@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"path"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/plugin"
+)
+
+// Stage is one step of an ordered processing pipeline. Exactly one of Filter,
+// Transformer or Plugin is set.
+type Stage struct {
+	// Name identifies the stage in logs and errors
+	Name string
+	// Sources limits the stage to entries from matching sources (exact or path.Match patterns).
+	// Entries from other sources skip the stage. Empty means every source.
+	Sources []string
+
+	Filter      Filter
+	Transformer Transformer
+	Plugin      plugin.Plugin
+}
+
+// NewFilterStage creates a stage that drops entries the filter rejects
+func NewFilterStage(name string, filter Filter) Stage {
+	return Stage{Name: name, Filter: filter}
+}
+
+// NewTransformerStage creates a stage that modifies entries
+func NewTransformerStage(name string, transformer Transformer) Stage {
+	return Stage{Name: name, Transformer: transformer}
+}
+
+// NewPluginStage creates a stage that hands entries to a plugin
+func NewPluginStage(name string, p plugin.Plugin) Stage {
+	return Stage{Name: name, Plugin: p}
+}
+
+// ForSources limits the stage to the given sources
+func (s Stage) ForSources(sources ...string) Stage {
+	s.Sources = sources
+	return s
+}
+
+// AppliesTo reports whether the stage runs for entries from a source
+func (s Stage) AppliesTo(source string) bool {
+	if len(s.Sources) == 0 {
+		return true
+	}
+	for _, pattern := range s.Sources {
+		if pattern == source {
+			return true
+		}
+		if matched, err := path.Match(pattern, source); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Run applies the stage to an entry, returning false if the entry was filtered out
+func (s Stage) Run(entry *models.LogEntry) bool {
+	if !s.AppliesTo(entry.Source) {
+		return true
+	}
+
+	switch {
+	case s.Filter != nil:
+		return s.Filter.Apply(entry)
+	case s.Transformer != nil:
+		s.Transformer.Transform(entry)
+	case s.Plugin != nil:
+		// The processor runs plugin stages itself to apply its plugin error policy
+		_ = s.Plugin.ProcessLogEntry(entry)
+	}
+	return true
+}
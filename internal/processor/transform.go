@@ -141,46 +141,6 @@ func (t *TimestampFormatTransformer) Transform(entry *models.LogEntry) {
         entry.Fields["formatted_timestamp"] = entry.Timestamp.Format(t.Format)
 }
 
-// EnrichIPTransformer enriches IP addresses with location data
-type EnrichIPTransformer struct {
-        IPFieldName string
-}
-
-// NewEnrichIPTransformer creates a new transformer that enriches IP addresses
-func NewEnrichIPTransformer(fieldName string) *EnrichIPTransformer {
-        return &EnrichIPTransformer{
-                IPFieldName: fieldName,
-        }
-}
-
-// Transform implements the Transformer interface
-func (t *EnrichIPTransformer) Transform(entry *models.LogEntry) {
-        if entry.Fields == nil {
-                return
-        }
-
-        ipVal, exists := entry.Fields[t.IPFieldName]
-        if !exists {
-                return
-        }
-
-        // Check if the IP value is a string and return if not
-        if _, ok := ipVal.(string); !ok {
-                return
-        }
-
-        // In a real implementation, this would call a geolocation service with the IP string
-        // Here we just add placeholder data
-        if entry.Fields == nil {
-                entry.Fields = make(map[string]interface{})
-        }
-        
-        // Add geo fields with placeholder data (in a real implementation, this would be real data)
-        entry.Fields["ip_geo_country"] = "Unknown"
-        entry.Fields["ip_geo_city"] = "Unknown"
-        entry.Fields["ip_geo_coordinates"] = "0,0"
-}
-
 // MessageFormatTransformer formats the log message
 type MessageFormatTransformer struct {
         Template string
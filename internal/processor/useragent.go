@@ -0,0 +1,280 @@
+package processor
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// defaultUserAgentRegexes is the built-in user agent database in the uap-core format
+//
+//go:embed useragent_regexes.yaml
+var defaultUserAgentRegexes []byte
+
+// DefaultUserAgentCacheSize is the number of parsed user agents kept by default
+const DefaultUserAgentCacheSize = 4096
+
+// maxCachedUserAgentLength keeps unusually long user agents out of the cache
+const maxCachedUserAgentLength = 1024
+
+// uaSpiderDevice is the device family uap-core assigns to bots
+const uaSpiderDevice = "Spider"
+
+// UserAgent is the breakdown of a user agent string
+type UserAgent struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	Device         string
+	IsBot          bool
+}
+
+// uapDatabase is the uap-core regexes.yaml layout
+type uapDatabase struct {
+	UserAgentParsers []uapRule `yaml:"user_agent_parsers"`
+	OSParsers        []uapRule `yaml:"os_parsers"`
+	DeviceParsers    []uapRule `yaml:"device_parsers"`
+}
+
+// uapRule is a single uap-core parser entry
+type uapRule struct {
+	Regex             string `yaml:"regex"`
+	RegexFlag         string `yaml:"regex_flag"`
+	FamilyReplacement string `yaml:"family_replacement"`
+	V1Replacement     string `yaml:"v1_replacement"`
+	V2Replacement     string `yaml:"v2_replacement"`
+	V3Replacement     string `yaml:"v3_replacement"`
+	OSReplacement     string `yaml:"os_replacement"`
+	OSV1Replacement   string `yaml:"os_v1_replacement"`
+	OSV2Replacement   string `yaml:"os_v2_replacement"`
+	OSV3Replacement   string `yaml:"os_v3_replacement"`
+	DeviceReplacement string `yaml:"device_replacement"`
+}
+
+// uaMatcher is a compiled rule producing a family and up to three version parts.
+// Without a replacement the family comes from group 1 and the version parts from groups 2-4.
+type uaMatcher struct {
+	regex        *regexp.Regexp
+	replacements [4]string
+}
+
+// match applies the rule, returning the family and version parts
+func (m *uaMatcher) match(ua string) (string, [3]string, bool) {
+	groups := m.regex.FindStringSubmatch(ua)
+	if groups == nil {
+		return "", [3]string{}, false
+	}
+
+	var parts [4]string
+	for i := range parts {
+		if m.replacements[i] != "" {
+			parts[i] = expandUAReplacement(m.replacements[i], groups)
+		} else if i+1 < len(groups) {
+			parts[i] = groups[i+1]
+		}
+	}
+
+	return strings.TrimSpace(parts[0]), [3]string{parts[1], parts[2], parts[3]}, true
+}
+
+// expandUAReplacement substitutes $1..$9 with the matching capture groups
+func expandUAReplacement(replacement string, groups []string) string {
+	if !strings.Contains(replacement, "$") {
+		return replacement
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		if replacement[i] == '$' && i+1 < len(replacement) && replacement[i+1] >= '1' && replacement[i+1] <= '9' {
+			if idx, _ := strconv.Atoi(replacement[i+1 : i+2]); idx < len(groups) {
+				b.WriteString(groups[idx])
+			}
+			i++
+			continue
+		}
+		b.WriteByte(replacement[i])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// UserAgentParser classifies user agent strings using a uap-core style regex database
+type UserAgentParser struct {
+	browsers []*uaMatcher
+	oses     []*uaMatcher
+	devices  []*uaMatcher
+}
+
+// NewUserAgentParser compiles a uap-core style regexes.yaml database
+func NewUserAgentParser(data []byte) (*UserAgentParser, error) {
+	var db uapDatabase
+	if err := yaml.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("invalid user agent database: %w", err)
+	}
+
+	p := &UserAgentParser{}
+	var err error
+	if p.browsers, err = compileUARules(db.UserAgentParsers, func(r uapRule) [4]string {
+		return [4]string{r.FamilyReplacement, r.V1Replacement, r.V2Replacement, r.V3Replacement}
+	}); err != nil {
+		return nil, fmt.Errorf("invalid user agent parser: %w", err)
+	}
+	if p.oses, err = compileUARules(db.OSParsers, func(r uapRule) [4]string {
+		return [4]string{r.OSReplacement, r.OSV1Replacement, r.OSV2Replacement, r.OSV3Replacement}
+	}); err != nil {
+		return nil, fmt.Errorf("invalid OS parser: %w", err)
+	}
+	if p.devices, err = compileUARules(db.DeviceParsers, func(r uapRule) [4]string {
+		// Only the device family is used
+		return [4]string{r.DeviceReplacement}
+	}); err != nil {
+		return nil, fmt.Errorf("invalid device parser: %w", err)
+	}
+
+	return p, nil
+}
+
+// DefaultUserAgentParser returns a parser for the built-in database
+func DefaultUserAgentParser() (*UserAgentParser, error) {
+	return NewUserAgentParser(defaultUserAgentRegexes)
+}
+
+// compileUARules compiles rules, taking the replacements from the given accessor
+func compileUARules(rules []uapRule, replacements func(uapRule) [4]string) ([]*uaMatcher, error) {
+	matchers := make([]*uaMatcher, 0, len(rules))
+	for _, rule := range rules {
+		pattern := rule.Regex
+		if rule.RegexFlag == "i" {
+			pattern = "(?i)" + pattern
+		}
+
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regex %q: %w", rule.Regex, err)
+		}
+
+		matchers = append(matchers, &uaMatcher{
+			regex:        regex,
+			replacements: replacements(rule),
+		})
+	}
+	return matchers, nil
+}
+
+// Parse classifies a user agent string. Unknown parts are reported as "Other", as in uap-core.
+func (p *UserAgentParser) Parse(ua string) UserAgent {
+	result := UserAgent{
+		Browser: "Other",
+		OS:      "Other",
+		Device:  "Other",
+	}
+
+	if family, version, ok := firstUAMatch(p.browsers, ua); ok {
+		result.Browser = family
+		result.BrowserVersion = joinUAVersion(version)
+	}
+	if family, version, ok := firstUAMatch(p.oses, ua); ok {
+		result.OS = family
+		result.OSVersion = joinUAVersion(version)
+	}
+	if family, _, ok := firstUAMatch(p.devices, ua); ok {
+		result.Device = family
+	}
+
+	result.IsBot = result.Device == uaSpiderDevice
+	return result
+}
+
+// firstUAMatch returns the result of the first matching rule
+func firstUAMatch(matchers []*uaMatcher, ua string) (string, [3]string, bool) {
+	for _, m := range matchers {
+		if family, version, ok := m.match(ua); ok && family != "" {
+			return family, version, true
+		}
+	}
+	return "", [3]string{}, false
+}
+
+// joinUAVersion joins the non-empty leading version parts with dots
+func joinUAVersion(version [3]string) string {
+	parts := make([]string, 0, len(version))
+	for _, part := range version {
+		if part == "" {
+			break
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// UserAgentTransformer breaks a user agent field down into browser, OS and device fields
+type UserAgentTransformer struct {
+	Field  string
+	parser *UserAgentParser
+	cache  *lruCache[string, UserAgent]
+}
+
+// NewUserAgentTransformer creates a transformer reading the user agent from the given field
+// (default "user_agent") and classifying it with the built-in database
+func NewUserAgentTransformer(field string) (*UserAgentTransformer, error) {
+	parser, err := DefaultUserAgentParser()
+	if err != nil {
+		return nil, err
+	}
+
+	if field == "" {
+		field = "user_agent"
+	}
+
+	return &UserAgentTransformer{
+		Field:  field,
+		parser: parser,
+		cache:  newLRUCache[string, UserAgent](DefaultUserAgentCacheSize),
+	}, nil
+}
+
+// WithParser replaces the user agent database
+func (t *UserAgentTransformer) WithParser(parser *UserAgentParser) *UserAgentTransformer {
+	t.parser = parser
+	t.cache.Purge()
+	return t
+}
+
+// WithCacheSize sets how many parsed user agents are cached
+func (t *UserAgentTransformer) WithCacheSize(size int) *UserAgentTransformer {
+	t.cache = newLRUCache[string, UserAgent](size)
+	return t
+}
+
+// Transform implements the Transformer interface
+func (t *UserAgentTransformer) Transform(entry *models.LogEntry) {
+	value, ok := entry.GetField(t.Field)
+	if !ok {
+		return
+	}
+	ua, ok := value.(string)
+	if !ok || ua == "" || ua == "-" {
+		return
+	}
+
+	parsed, cached := t.cache.Get(ua)
+	if !cached {
+		parsed = t.parser.Parse(ua)
+		if len(ua) <= maxCachedUserAgentLength {
+			t.cache.Add(ua, parsed)
+		}
+	}
+
+	entry.AddField("ua.browser", parsed.Browser)
+	entry.AddField("ua.browser_version", parsed.BrowserVersion)
+	entry.AddField("ua.os", parsed.OS)
+	entry.AddField("ua.os_version", parsed.OSVersion)
+	entry.AddField("ua.device", parsed.Device)
+	entry.AddField("ua.is_bot", parsed.IsBot)
+}
@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/internal/metrics"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+// DefaultWebhookTimeout bounds each webhook request
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookTarget posts entries to an HTTP endpoint as JSON arrays. Entries are buffered and
+// posted in batches from the target's own goroutine, so a slow endpoint never holds up the
+// workers. Entries arriving while the buffer is full are refused, and a batch the endpoint
+// still rejects after its retries is dropped; both are counted.
+type WebhookTarget struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+	buffer  *asyncBatches
+	metrics *metrics.Metrics
+
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	retryBackoff  time.Duration
+}
+
+// NewWebhookTarget creates a target posting entries to a URL
+func NewWebhookTarget(name, url string) *WebhookTarget {
+	t := &WebhookTarget{
+		name:          name,
+		url:           url,
+		headers:       make(map[string]string),
+		client:        &http.Client{Timeout: DefaultWebhookTimeout},
+		metrics:       metrics.GetMetrics(),
+		batchSize:     DefaultOutputBatchSize,
+		flushInterval: DefaultOutputFlushInterval,
+		retries:       DefaultOutputRetries,
+		retryBackoff:  DefaultOutputRetryBackoff,
+	}
+	t.buffer = newAsyncBatches(t.newBatches())
+	return t
+}
+
+// newBatches creates the batch processor posting the buffered entries
+func (t *WebhookTarget) newBatches() *worker.BatchProcessor[*models.LogEntry] {
+	return worker.NewBatchProcessor(nil, t.batchSize, t.flushInterval, t.post).
+		WithRetry(t.retries, t.retryBackoff).
+		WithDeadLetter(t.drop)
+}
+
+// WithHeader adds a header to every request, e.g. for authentication
+func (t *WebhookTarget) WithHeader(key, value string) *WebhookTarget {
+	t.headers[key] = value
+	return t
+}
+
+// WithTimeout sets the request timeout
+func (t *WebhookTarget) WithTimeout(timeout time.Duration) *WebhookTarget {
+	t.client.Timeout = timeout
+	return t
+}
+
+// WithBatching sets the most entries posted at once and the longest an entry waits for its
+// batch to fill. It must be called before the first entry is sent.
+func (t *WebhookTarget) WithBatching(size int, interval time.Duration) *WebhookTarget {
+	t.batchSize, t.flushInterval = size, interval
+	t.buffer.batches = t.newBatches()
+	return t
+}
+
+// WithRetry sets how many times a rejected batch is posted again, waiting backoff before
+// the first retry and twice as long before each next one. It must be called before the
+// first entry is sent.
+func (t *WebhookTarget) WithRetry(retries int, backoff time.Duration) *WebhookTarget {
+	t.retries, t.retryBackoff = retries, backoff
+	t.buffer.batches = t.newBatches()
+	return t
+}
+
+// WithBufferSize sets how many entries may wait to be posted before new ones are refused.
+// It must be called before the first entry is sent.
+func (t *WebhookTarget) WithBufferSize(size int) *WebhookTarget {
+	if size > 0 {
+		t.buffer.bufferSize = size
+	}
+	return t
+}
+
+// Name implements the Target interface
+func (t *WebhookTarget) Name() string {
+	return t.name
+}
+
+// Send implements the Target interface. The entry is buffered without waiting, and
+// ErrOutputFull is returned when the buffer is full.
+func (t *WebhookTarget) Send(ctx context.Context, entry *models.LogEntry) error {
+	err := t.buffer.add(entry)
+	if errors.Is(err, ErrOutputFull) {
+		t.metrics.WebhookEntries.WithLabelValues(t.name, "overflow").Inc()
+	}
+	return err
+}
+
+// Flush implements the FlushingTarget interface, posting the buffered entries
+func (t *WebhookTarget) Flush(ctx context.Context) error {
+	return t.buffer.flush(ctx)
+}
+
+// Close stops buffering entries and waits until the rest are posted
+func (t *WebhookTarget) Close(ctx context.Context) error {
+	return t.buffer.close(ctx)
+}
+
+// post sends a batch of entries in one request
+func (t *WebhookTarget) post(ctx context.Context, entries []*models.LogEntry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode entries: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	t.metrics.WebhookEntries.WithLabelValues(t.name, "sent").Add(float64(len(entries)))
+	return nil
+}
+
+// drop counts a batch the endpoint rejected after its retries
+func (t *WebhookTarget) drop(ctx context.Context, entries []*models.LogEntry, err error) {
+	t.metrics.WebhookEntries.WithLabelValues(t.name, "dropped").Add(float64(len(entries)))
+}
@@ -32,7 +32,7 @@ func (p *LQLParser) Parse(queryStr string) (models.Query, error) {
 	}
 
 	// Extract tokens from the query string
-	tokens := p.tokenizer.FindAllString(queryStr, -1)
+	tokens := joinLevelComparisons(p.tokenizer.FindAllString(queryStr, -1))
 	if len(tokens) == 0 {
 		return query, nil
 	}
@@ -92,6 +92,12 @@ func (p *LQLParser) Parse(queryStr string) (models.Query, error) {
 			}
 		}
 
+		// Check for a severity comparison (level>=warn)
+		if minLevel, ok := parseMinLevel(token); ok {
+			query.MinLevel = minLevel
+			continue
+		}
+
 		// Check for field expressions (field=value)
 		if strings.Contains(token, "=") {
 			parts := strings.SplitN(token, "=", 2)
@@ -3,6 +3,7 @@ package query
 import (
         "context"
         "fmt"
+        "math"
         "regexp"
         "strconv"
         "strings"
@@ -50,6 +51,7 @@ func (e *Engine) Analyze(analysis models.Analysis) (*models.AnalysisResult, erro
                 TimeRange: analysis.TimeRange,
                 Sources:   analysis.Sources,
                 Levels:    analysis.Levels,
+                MinLevel:  analysis.MinLevel,
                 Filter:    analysis.Filter,
                 Limit:     0, // No limit for analysis
         }
@@ -66,27 +68,41 @@ func (e *Engine) Analyze(analysis models.Analysis) (*models.AnalysisResult, erro
                 TimeRange: analysis.TimeRange,
         }
         
+        // Sampled entries stand for 1/rate entries each
+        weights := make([]float64, len(entries))
+        for i, entry := range entries {
+                weights[i] = 1
+                if rate := entry.SampleRate(); rate < 1 && !analysis.Unweighted {
+                        weights[i] = 1 / rate
+                        result.Estimated = true
+                }
+        }
+        
         switch analysis.Type {
         case models.AnalysisTypeCount:
-                result.Count = int64(len(entries))
+                var count float64
+                for _, weight := range weights {
+                        count += weight
+                }
+                result.Count = int64(math.Round(count))
                 
         case models.AnalysisTypeFrequency:
                 if analysis.GroupBy == "" {
                         return nil, fmt.Errorf("frequency analysis requires a GroupBy field")
                 }
-                result.Frequency = e.calculateFrequency(entries, analysis.GroupBy)
+                result.Frequency = e.calculateFrequency(entries, weights, analysis.GroupBy)
                 
         case models.AnalysisTypeTimeSeries:
-                result.TimeSeries = e.calculateTimeSeries(entries, analysis.Interval)
+                result.TimeSeries = e.calculateTimeSeries(entries, weights, analysis.Interval)
                 
         case models.AnalysisTypePatterns:
-                result.Patterns = e.findPatterns(entries, analysis.PatternConfig)
+                result.Patterns = e.findPatterns(entries, weights, analysis.PatternConfig)
                 
         case models.AnalysisTypeCorrelation:
                 if len(analysis.CorrelationFields) < 2 {
                         return nil, fmt.Errorf("correlation analysis requires at least two fields")
                 }
-                result.Correlation = e.calculateCorrelation(entries, analysis.CorrelationFields)
+                result.Correlation = e.calculateCorrelation(entries, weights, analysis.CorrelationFields)
                 
         default:
                 return nil, fmt.Errorf("unsupported analysis type: %s", analysis.Type)
@@ -102,7 +118,7 @@ func (e *Engine) ParseQuery(queryString string) (models.Query, error) {
         }
         
         // Split the query string into tokens
-        tokens := strings.Fields(queryString)
+        tokens := joinLevelComparisons(strings.Fields(queryString))
         
         for i := 0; i < len(tokens); i++ {
                 token := tokens[i]
@@ -148,6 +164,12 @@ func (e *Engine) ParseQuery(queryString string) (models.Query, error) {
                         }
                         
                 default:
+                        // Check for a severity comparison (level>=warn)
+                        if minLevel, ok := parseMinLevel(token); ok {
+                                query.MinLevel = minLevel
+                                continue
+                        }
+                        
                         // Check if it's a field:value pair
                         if strings.Contains(token, ":") {
                                 parts := strings.SplitN(token, ":", 2)
@@ -170,11 +192,54 @@ func (e *Engine) ParseQuery(queryString string) (models.Query, error) {
         return query, nil
 }
 
+// joinLevelComparisons joins a severity comparison written with spaces, such as
+// "level >= warn" or "level>= warn", into a single "level>=warn" token
+func joinLevelComparisons(tokens []string) []string {
+        joined := make([]string, 0, len(tokens))
+        for i := 0; i < len(tokens); i++ {
+                token := tokens[i]
+                lower := strings.ToLower(token)
+                if lower == "level" && i+1 < len(tokens) && strings.HasPrefix(tokens[i+1], ">=") {
+                        i++
+                        token += tokens[i]
+                        lower = strings.ToLower(token)
+                }
+                if lower == "level>=" && i+1 < len(tokens) {
+                        i++
+                        token += tokens[i]
+                }
+                joined = append(joined, token)
+        }
+        return joined
+}
+
+// parseMinLevel parses a "level>=warn" comparison token
+func parseMinLevel(token string) (string, bool) {
+        lower := strings.ToLower(token)
+        if !strings.HasPrefix(lower, "level>=") {
+                return "", false
+        }
+        level, ok := models.NormalizeLevel(strings.TrimPrefix(lower, "level>="))
+        if !ok {
+                return "", false
+        }
+        return level.String(), true
+}
+
+// roundCounts rounds weighted counts to whole numbers
+func roundCounts(weighted map[string]float64) map[string]int64 {
+        counts := make(map[string]int64, len(weighted))
+        for key, count := range weighted {
+                counts[key] = int64(math.Round(count))
+        }
+        return counts
+}
+
 // calculateFrequency calculates frequency distribution
-func (e *Engine) calculateFrequency(entries []*models.LogEntry, groupBy string) map[string]int64 {
-        frequency := make(map[string]int64)
+func (e *Engine) calculateFrequency(entries []*models.LogEntry, weights []float64, groupBy string) map[string]int64 {
+        frequency := make(map[string]float64)
         
-        for _, entry := range entries {
+        for i, entry := range entries {
                 var value string
                 
                 switch strings.ToLower(groupBy) {
@@ -191,15 +256,15 @@ func (e *Engine) calculateFrequency(entries []*models.LogEntry, groupBy string)
                         }
                 }
                 
-                frequency[value]++
+                frequency[value] += weights[i]
         }
         
-        return frequency
+        return roundCounts(frequency)
 }
 
 // calculateTimeSeries creates a time series analysis
-func (e *Engine) calculateTimeSeries(entries []*models.LogEntry, interval string) map[string]int64 {
-        timeSeries := make(map[string]int64)
+func (e *Engine) calculateTimeSeries(entries []*models.LogEntry, weights []float64, interval string) map[string]int64 {
+        timeSeries := make(map[string]float64)
         
         // Determine format based on interval
         var format string
@@ -216,18 +281,18 @@ func (e *Engine) calculateTimeSeries(entries []*models.LogEntry, interval string
                 format = "2006-01-02" // Default to day
         }
         
-        for _, entry := range entries {
+        for i, entry := range entries {
                 timeKey := entry.Timestamp.Format(format)
-                timeSeries[timeKey]++
+                timeSeries[timeKey] += weights[i]
         }
         
-        return timeSeries
+        return roundCounts(timeSeries)
 }
 
 // findPatterns identifies common patterns in log messages
-func (e *Engine) findPatterns(entries []*models.LogEntry, config models.PatternConfig) []models.Pattern {
+func (e *Engine) findPatterns(entries []*models.LogEntry, weights []float64, config models.PatternConfig) []models.Pattern {
         // Map to track pattern frequencies
-        patternFrequency := make(map[string]int)
+        patternFrequency := make(map[string]float64)
         
         // Regex to replace numbers with placeholders
         numberRegex := regexp.MustCompile(`\b\d+\b`)
@@ -235,7 +300,7 @@ func (e *Engine) findPatterns(entries []*models.LogEntry, config models.PatternC
         // Track which original messages are associated with which pattern
         patternExamples := make(map[string][]string)
         
-        for _, entry := range entries {
+        for i, entry := range entries {
                 // Skip empty messages
                 if entry.Message == "" {
                         continue
@@ -253,7 +318,7 @@ func (e *Engine) findPatterns(entries []*models.LogEntry, config models.PatternC
                 // ...
                 
                 // Update frequency
-                patternFrequency[pattern]++
+                patternFrequency[pattern] += weights[i]
                 
                 // Store original message as an example (up to 3 examples per pattern)
                 if len(patternExamples[pattern]) < 3 {
@@ -266,7 +331,7 @@ func (e *Engine) findPatterns(entries []*models.LogEntry, config models.PatternC
         for pattern, count := range patternFrequency {
                 patterns = append(patterns, models.Pattern{
                         Pattern:  pattern,
-                        Count:    count,
+                        Count:    int(math.Round(count)),
                         Examples: patternExamples[pattern],
                 })
         }
@@ -286,16 +351,16 @@ func (e *Engine) findPatterns(entries []*models.LogEntry, config models.PatternC
 }
 
 // calculateCorrelation finds relationships between fields
-func (e *Engine) calculateCorrelation(entries []*models.LogEntry, fields []string) map[string]map[string]int64 {
-        correlation := make(map[string]map[string]int64)
+func (e *Engine) calculateCorrelation(entries []*models.LogEntry, weights []float64, fields []string) map[string]map[string]int64 {
+        correlation := make(map[string]map[string]float64)
         
         // Initialize correlation map
         for _, field1 := range fields {
-                correlation[field1] = make(map[string]int64)
+                correlation[field1] = make(map[string]float64)
         }
         
         // Count occurrences of each value combination
-        for _, entry := range entries {
+        for i, entry := range entries {
                 for _, field1 := range fields {
                         for _, field2 := range fields {
                                 if field1 == field2 {
@@ -319,12 +384,16 @@ func (e *Engine) calculateCorrelation(entries []*models.LogEntry, fields []strin
                                 }
                                 
                                 key := fmt.Sprintf("%s=%s", field2, value2)
-                                correlation[field1][key]++
+                                correlation[field1][key] += weights[i]
                         }
                 }
         }
         
-        return correlation
+        result := make(map[string]map[string]int64, len(correlation))
+        for field, counts := range correlation {
+                result[field] = roundCounts(counts)
+        }
+        return result
 }
 
 // Note: Using lint directives to mark intentionally unused code for future implementation
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -20,6 +21,7 @@ type DiskStorage struct {
 	basePath      string
 	currentFile   *os.File
 	currentDay    string
+	hasEntries    bool // Whether the current file's array has entries
 	mutex         sync.RWMutex
 	inMemoryCache []*models.LogEntry // Small cache for fast queries
 	maxCacheSize  int
@@ -46,81 +48,154 @@ func (d *DiskStorage) WithMaxCacheSize(size int) *DiskStorage {
 
 // Store implements the Storage interface
 func (d *DiskStorage) Store(ctx context.Context, entry *models.LogEntry) error {
+	jsonData, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize log entry: %w", err)
+	}
+
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	// Determine the current day for file naming
-	day := entry.Timestamp.Format("2006-01-02")
-
-	// If we're writing to a different day, close the current file
-	if d.currentFile != nil && d.currentDay != day {
-		d.currentFile.Close()
-		d.currentFile = nil
+	if err := d.openDay(entry.Timestamp.Format("2006-01-02")); err != nil {
+		return err
+	}
+	if err := d.writeEntries([][]byte{jsonData}); err != nil {
+		return err
 	}
 
-	// Open a file for the current day if needed
-	if d.currentFile == nil {
-		fileName := filepath.Join(d.basePath, fmt.Sprintf("logs-%s.json", day))
-		fileExists := fileExists(fileName)
+	// Update in-memory cache
+	d.updateCache(entry)
 
-		file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return nil
+}
+
+// StoreBatch implements the BatchStorage interface. Entries are written to each day's file
+// in one write, taking the lock and closing the JSON array once per file rather than once
+// per entry. Entries that can't be serialized are reported in a BatchError; a failed write
+// fails the entries of that day.
+func (d *DiskStorage) StoreBatch(ctx context.Context, entries []*models.LogEntry) error {
+	batchErr := &BatchError{Errors: make(map[int]error)}
+
+	// Serialize outside the lock, grouping entries by day in the order they came
+	var days []string
+	byDay := make(map[string][]int)
+	data := make([][]byte, len(entries))
+	for i, entry := range entries {
+		jsonData, err := json.Marshal(entry)
 		if err != nil {
-			return fmt.Errorf("failed to open log file: %w", err)
+			batchErr.Errors[i] = fmt.Errorf("failed to serialize log entry: %w", err)
+			continue
+		}
+		data[i] = jsonData
+		day := entry.Timestamp.Format("2006-01-02")
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
 		}
+		byDay[day] = append(byDay[day], i)
+	}
 
-		// If it's a new file, start a JSON array
-		if !fileExists {
-			if _, err := file.WriteString("[\n"); err != nil {
-				file.Close()
-				return fmt.Errorf("failed to write file header: %w", err)
-			}
-		} else {
-			// If the file exists, remove the closing bracket to continue the array
-			info, err := file.Stat()
-			if err != nil {
-				file.Close()
-				return fmt.Errorf("failed to get file info: %w", err)
-			}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-			if info.Size() > 2 { // Only try to truncate if file has content
-				if err := file.Truncate(info.Size() - 2); err != nil {
-					file.Close()
-					return fmt.Errorf("failed to truncate file: %w", err)
-				}
-				if _, err := file.Seek(info.Size()-2, io.SeekStart); err != nil {
-					file.Close()
-					return fmt.Errorf("failed to seek in file: %w", err)
-				}
-				if _, err := file.WriteString(",\n"); err != nil {
-					file.Close()
-					return fmt.Errorf("failed to write separator: %w", err)
-				}
+	for _, day := range days {
+		indexes := byDay[day]
+		chunk := make([][]byte, len(indexes))
+		for j, i := range indexes {
+			chunk[j] = data[i]
+		}
+
+		err := d.openDay(day)
+		if err == nil {
+			err = d.writeEntries(chunk)
+		}
+		for _, i := range indexes {
+			if err != nil {
+				batchErr.Errors[i] = err
+			} else {
+				d.updateCache(entries[i])
 			}
 		}
+	}
 
-		d.currentFile = file
-		d.currentDay = day
+	if len(batchErr.Errors) > 0 {
+		return batchErr
 	}
+	return nil
+}
 
-	// Serialize the entry to JSON
-	jsonData, err := json.Marshal(entry)
+// openDay makes the file of a day the current file, opening or creating it if needed.
+// Callers hold the mutex.
+func (d *DiskStorage) openDay(day string) error {
+	if d.currentFile != nil && d.currentDay == day {
+		return nil
+	}
+
+	// If we're writing to a different day, close the current file
+	if d.currentFile != nil {
+		d.currentFile.Close()
+		d.currentFile = nil
+	}
+
+	fileName := filepath.Join(d.basePath, fmt.Sprintf("logs-%s.json", day))
+	fileExists := fileExists(fileName)
+
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to serialize log entry: %w", err)
+		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
-	// Write the entry to the file
-	if _, err := d.currentFile.Write(jsonData); err != nil {
-		return fmt.Errorf("failed to write log entry: %w", err)
+	// If it's a new file, start a JSON array
+	hasEntries := false
+	if !fileExists {
+		if _, err := file.WriteString("[\n"); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write file header: %w", err)
+		}
+	} else {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to get file info: %w", err)
+		}
+		// A file with content ends with the closing bracket, replaced on the next write
+		hasEntries = info.Size() > 2
 	}
 
-	// End the array
-	if _, err := d.currentFile.WriteString("\n]"); err != nil {
-		return fmt.Errorf("failed to write file footer: %w", err)
+	d.currentFile = file
+	d.currentDay = day
+	d.hasEntries = hasEntries
+	return nil
+}
+
+// writeEntries appends serialized entries to the current file's JSON array and closes
+// the array again. Callers hold the mutex.
+func (d *DiskStorage) writeEntries(data [][]byte) error {
+	var buf bytes.Buffer
+	if d.hasEntries {
+		// Remove the closing bracket to continue the array
+		info, err := d.currentFile.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to get file info: %w", err)
+		}
+		if err := d.currentFile.Truncate(info.Size() - 2); err != nil {
+			return fmt.Errorf("failed to truncate file: %w", err)
+		}
+		buf.WriteString(",\n")
+	}
+	for i, jsonData := range data {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.Write(jsonData)
 	}
 
-	// Update in-memory cache
-	d.updateCache(entry)
+	// End the array
+	buf.WriteString("\n]")
 
+	if _, err := d.currentFile.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write log entries: %w", err)
+	}
+	d.hasEntries = true
 	return nil
 }
 
@@ -211,18 +286,9 @@ func (d *DiskStorage) queryCache(ctx context.Context, query models.Query) ([]*mo
 			}
 		}
 
-		// Apply level filter if set
-		if len(query.Levels) > 0 {
-			levelMatch := false
-			for _, level := range query.Levels {
-				if strings.EqualFold(entry.Level, level) {
-					levelMatch = true
-					break
-				}
-			}
-			if !levelMatch {
-				continue
-			}
+		// Apply level filters if set
+		if !matchesLevel(entry, query) {
+			continue
 		}
 
 		// Apply custom filter if set
@@ -313,18 +379,9 @@ func (d *DiskStorage) queryDisk(ctx context.Context, query models.Query) ([]*mod
 				}
 			}
 
-			// Apply level filter if set
-			if len(query.Levels) > 0 {
-				levelMatch := false
-				for _, level := range query.Levels {
-					if strings.EqualFold(entry.Level, level) {
-						levelMatch = true
-						break
-					}
-				}
-				if !levelMatch {
-					continue
-				}
+			// Apply level filters if set
+			if !matchesLevel(entry, query) {
+				continue
 			}
 
 			// Apply custom filter if set
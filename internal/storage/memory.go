@@ -48,6 +48,20 @@ func (m *MemoryStorage) Store(ctx context.Context, entry *models.LogEntry) error
         return nil
 }
 
+// StoreBatch implements the BatchStorage interface, taking the lock once for the batch
+func (m *MemoryStorage) StoreBatch(ctx context.Context, entries []*models.LogEntry) error {
+        m.mutex.Lock()
+        defer m.mutex.Unlock()
+
+        m.entries = append(m.entries, entries...)
+
+        // Remove the oldest entries beyond the capacity
+        if excess := len(m.entries) - m.capacity; excess > 0 {
+                m.entries = m.entries[excess:]
+        }
+        return nil
+}
+
 // Query implements the Storage interface
 func (m *MemoryStorage) Query(ctx context.Context, query models.Query) ([]*models.LogEntry, error) {
         m.mutex.RLock()
@@ -88,18 +102,9 @@ func (m *MemoryStorage) Query(ctx context.Context, query models.Query) ([]*model
                         }
                 }
 
-                // Apply level filter if set
-                if len(query.Levels) > 0 {
-                        levelMatch := false
-                        for _, level := range query.Levels {
-                                if strings.EqualFold(entry.Level, level) {
-                                        levelMatch = true
-                                        break
-                                }
-                        }
-                        if !levelMatch {
-                                continue
-                        }
+                // Apply level filters if set
+                if !matchesLevel(entry, query) {
+                        continue
                 }
 
                 // Apply custom filter if set
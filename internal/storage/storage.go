@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mariasu11/logstreamApp/pkg/models"
@@ -25,6 +27,57 @@ type Storage interface {
 	Close() error
 }
 
+// BatchStorage is implemented by backends that store several entries at once more cheaply
+// than one at a time
+type BatchStorage interface {
+	Storage
+
+	// StoreBatch saves log entries. An error that isn't a *BatchError means none were stored.
+	StoreBatch(ctx context.Context, entries []*models.LogEntry) error
+}
+
+// BatchError reports the entries of a batch that couldn't be stored; the others were stored
+type BatchError struct {
+	// Errors maps the index of each failed entry in the batch to its error
+	Errors map[int]error
+}
+
+// Error implements the error interface
+func (e *BatchError) Error() string {
+	for _, err := range e.Errors {
+		return fmt.Sprintf("failed to store %d entries of the batch: %v", len(e.Errors), err)
+	}
+	return "failed to store entries of the batch"
+}
+
+// Unwrap returns the errors of the failed entries
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// StoreBatch saves log entries with the storage's StoreBatch when it has one, and otherwise
+// stores them one at a time, reporting the entries that failed in a *BatchError
+func StoreBatch(ctx context.Context, storage Storage, entries []*models.LogEntry) error {
+	if batch, ok := storage.(BatchStorage); ok {
+		return batch.StoreBatch(ctx, entries)
+	}
+
+	batchErr := &BatchError{Errors: make(map[int]error)}
+	for i, entry := range entries {
+		if err := storage.Store(ctx, entry); err != nil {
+			batchErr.Errors[i] = err
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
 // StorageStats contains statistics about the stored logs
 type StorageStats struct {
 	TotalEntries     int64
@@ -36,6 +89,41 @@ type StorageStats struct {
 	CompressionRatio float64 // Compression ratio (if applicable)
 }
 
+// matchesLevel checks an entry against the level list and minimum level of a query.
+// Levels are compared by severity, so "WARNING" in a query matches a stored "warn".
+func matchesLevel(entry *models.LogEntry, query models.Query) bool {
+	if len(query.Levels) > 0 {
+		entryLevel, entryKnown := models.NormalizeLevel(entry.Level)
+		levelMatch := false
+		for _, level := range query.Levels {
+			if strings.EqualFold(entry.Level, level) {
+				levelMatch = true
+				break
+			}
+			if queryLevel, ok := models.NormalizeLevel(level); ok && entryKnown && queryLevel == entryLevel {
+				levelMatch = true
+				break
+			}
+		}
+		if !levelMatch {
+			return false
+		}
+	}
+
+	if query.MinLevel != "" {
+		minLevel, ok := models.NormalizeLevel(query.MinLevel)
+		if !ok {
+			return false
+		}
+		entryLevel, ok := models.NormalizeLevel(entry.Level)
+		if !ok || entryLevel < minLevel {
+			return false
+		}
+	}
+
+	return true
+}
+
 // MetricsByTimeRange contains metrics over a time range
 type MetricsByTimeRange struct {
 	StartTime time.Time
@@ -56,6 +144,9 @@ type Builder interface {
 	// WithLevels limits the query to specific log levels
 	WithLevels(levels ...string) Builder
 	
+	// WithMinLevel limits the query to a minimum severity level
+	WithMinLevel(level string) Builder
+	
 	// WithFilter adds a filter expression to the query
 	WithFilter(filter string) Builder
 	
@@ -100,6 +191,12 @@ func (b *QueryBuilder) WithLevels(levels ...string) Builder {
 	return b
 }
 
+// WithMinLevel implements the Builder interface
+func (b *QueryBuilder) WithMinLevel(level string) Builder {
+	b.query.MinLevel = level
+	return b
+}
+
 // WithFilter implements the Builder interface
 func (b *QueryBuilder) WithFilter(filter string) Builder {
 	b.query.Filter = filter
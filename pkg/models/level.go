@@ -0,0 +1,275 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Level is a canonical log severity.
+// The numeric values follow the OpenTelemetry severity number ranges, so levels can be compared with < and >=.
+type Level int
+
+// Canonical log levels
+const (
+	LevelUnknown Level = 0
+	LevelTrace   Level = 1
+	LevelDebug   Level = 5
+	LevelInfo    Level = 9
+	LevelWarn    Level = 13
+	LevelError   Level = 17
+	LevelFatal   Level = 21
+)
+
+// levelNames maps canonical levels to their names
+var levelNames = map[Level]string{
+	LevelTrace: "trace",
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelFatal: "fatal",
+}
+
+// defaultLevelAliases maps the level spellings seen in common log formats onto canonical levels
+var defaultLevelAliases = map[string]Level{
+	"trace":         LevelTrace,
+	"t":             LevelTrace,
+	"trc":           LevelTrace,
+	"verbose":       LevelTrace,
+	"finest":        LevelTrace,
+	"debug":         LevelDebug,
+	"d":             LevelDebug,
+	"dbg":           LevelDebug,
+	"fine":          LevelDebug,
+	"info":          LevelInfo,
+	"i":             LevelInfo,
+	"inf":           LevelInfo,
+	"information":   LevelInfo,
+	"informational": LevelInfo,
+	"notice":        LevelInfo,
+	"n":             LevelInfo,
+	"warn":          LevelWarn,
+	"w":             LevelWarn,
+	"wrn":           LevelWarn,
+	"warning":       LevelWarn,
+	"error":         LevelError,
+	"e":             LevelError,
+	"err":           LevelError,
+	"eror":          LevelError,
+	"severe":        LevelError,
+	"dpanic":        LevelError,
+	"fatal":         LevelFatal,
+	"f":             LevelFatal,
+	"ftl":           LevelFatal,
+	"crit":          LevelFatal,
+	"critical":      LevelFatal,
+	"c":             LevelFatal,
+	"alert":         LevelFatal,
+	"a":             LevelFatal,
+	"emerg":         LevelFatal,
+	"emergency":     LevelFatal,
+	"panic":         LevelFatal,
+}
+
+// String returns the canonical level name
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseLevel parses a canonical level name
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return LevelUnknown, fmt.Errorf("invalid level %q (must be trace, debug, info, warn, error or fatal)", name)
+}
+
+// Numeric level schemes understood by LevelNormalizer
+const (
+	// NumericSchemeAuto detects the scheme from the value: multiples of ten up to 60 are Bunyan,
+	// 0-7 are syslog severities and anything else up to 24 is an OpenTelemetry severity number
+	NumericSchemeAuto = "auto"
+	// NumericSchemeSyslog treats numbers as RFC 5424 severities (0 emergency .. 7 debug)
+	NumericSchemeSyslog = "syslog"
+	// NumericSchemeOTel treats numbers as OpenTelemetry severity numbers (1 .. 24)
+	NumericSchemeOTel = "otel"
+	// NumericSchemeBunyan treats numbers as Bunyan levels (10 trace .. 60 fatal)
+	NumericSchemeBunyan = "bunyan"
+)
+
+// LevelNormalizer maps raw level values onto canonical levels
+type LevelNormalizer struct {
+	aliases       map[string]Level
+	numericScheme string
+}
+
+// NewLevelNormalizer creates a normalizer with the default alias table
+func NewLevelNormalizer() *LevelNormalizer {
+	aliases := make(map[string]Level, len(defaultLevelAliases))
+	for alias, level := range defaultLevelAliases {
+		aliases[alias] = level
+	}
+
+	return &LevelNormalizer{
+		aliases:       aliases,
+		numericScheme: NumericSchemeAuto,
+	}
+}
+
+// WithAlias maps an additional raw level value (case-insensitive) onto a canonical level
+func (n *LevelNormalizer) WithAlias(alias string, level Level) *LevelNormalizer {
+	n.aliases[strings.ToLower(strings.TrimSpace(alias))] = level
+	return n
+}
+
+// WithAliases adds aliases from a raw-value to level-name table, as found in configuration
+func (n *LevelNormalizer) WithAliases(aliases map[string]string) (*LevelNormalizer, error) {
+	for alias, name := range aliases {
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alias %q: %w", alias, err)
+		}
+		n.WithAlias(alias, level)
+	}
+	return n, nil
+}
+
+// WithNumericScheme sets how numeric level values are interpreted
+func (n *LevelNormalizer) WithNumericScheme(scheme string) (*LevelNormalizer, error) {
+	switch strings.ToLower(scheme) {
+	case "", NumericSchemeAuto:
+		n.numericScheme = NumericSchemeAuto
+	case NumericSchemeSyslog, NumericSchemeOTel, NumericSchemeBunyan:
+		n.numericScheme = strings.ToLower(scheme)
+	default:
+		return nil, fmt.Errorf("invalid numeric level scheme %q (must be auto, syslog, otel or bunyan)", scheme)
+	}
+	return n, nil
+}
+
+// Normalize maps a raw level value onto a canonical level
+func (n *LevelNormalizer) Normalize(raw string) (Level, bool) {
+	key := strings.ToLower(strings.TrimSpace(raw))
+	if key == "" {
+		return LevelUnknown, false
+	}
+
+	if level, ok := n.aliases[key]; ok {
+		return level, true
+	}
+
+	if num, err := strconv.Atoi(key); err == nil {
+		return n.normalizeNumber(num)
+	}
+
+	return LevelUnknown, false
+}
+
+// normalizeNumber maps a numeric level according to the configured scheme
+func (n *LevelNormalizer) normalizeNumber(num int) (Level, bool) {
+	switch n.numericScheme {
+	case NumericSchemeSyslog:
+		return SyslogSeverityLevel(num)
+	case NumericSchemeOTel:
+		return OTelSeverityLevel(num)
+	case NumericSchemeBunyan:
+		return bunyanLevel(num)
+	}
+
+	if level, ok := bunyanLevel(num); ok {
+		return level, true
+	}
+	if num >= 0 && num <= 7 {
+		return SyslogSeverityLevel(num)
+	}
+	return OTelSeverityLevel(num)
+}
+
+// NormalizeEntry replaces the entry level with its canonical name.
+// The original value is kept in Fields["level_raw"] and the severity number in Fields["severity_number"].
+func (n *LevelNormalizer) NormalizeEntry(entry *LogEntry) {
+	// Fall back to an OpenTelemetry severity number when no level text was parsed
+	if entry.Level == "" {
+		if number, ok := entry.GetField("severity_number"); ok {
+			if num, ok := number.(float64); ok {
+				if level, ok := OTelSeverityLevel(int(num)); ok {
+					entry.Level = level.String()
+				}
+			}
+		}
+	}
+
+	level, ok := n.Normalize(entry.Level)
+	if !ok {
+		return
+	}
+
+	// Keep the value seen first if the entry is normalized more than once
+	if _, exists := entry.GetField("level_raw"); !exists {
+		entry.AddField("level_raw", entry.Level)
+	}
+	entry.AddField("severity_number", int(level))
+	entry.Level = level.String()
+}
+
+// SyslogSeverityLevel maps an RFC 5424 severity (0-7) onto a canonical level
+func SyslogSeverityLevel(severity int) (Level, bool) {
+	switch {
+	case severity >= 0 && severity <= 2:
+		return LevelFatal, true // emergency, alert, critical
+	case severity == 3:
+		return LevelError, true
+	case severity == 4:
+		return LevelWarn, true
+	case severity == 5 || severity == 6:
+		return LevelInfo, true // notice, informational
+	case severity == 7:
+		return LevelDebug, true
+	default:
+		return LevelUnknown, false
+	}
+}
+
+// OTelSeverityLevel maps an OpenTelemetry severity number (1-24) onto a canonical level
+func OTelSeverityLevel(number int) (Level, bool) {
+	if number < 1 || number > 24 {
+		return LevelUnknown, false
+	}
+	// Each level spans four numbers starting at its own value
+	return Level((number-1)/4*4 + 1), true
+}
+
+// bunyanLevel maps a Bunyan numeric level onto a canonical level
+func bunyanLevel(num int) (Level, bool) {
+	switch num {
+	case 10:
+		return LevelTrace, true
+	case 20:
+		return LevelDebug, true
+	case 30:
+		return LevelInfo, true
+	case 40:
+		return LevelWarn, true
+	case 50:
+		return LevelError, true
+	case 60:
+		return LevelFatal, true
+	default:
+		return LevelUnknown, false
+	}
+}
+
+// defaultNormalizer is used by NormalizeLevel
+var defaultNormalizer = NewLevelNormalizer()
+
+// NormalizeLevel maps a raw level value onto a canonical level using the default alias table
+func NormalizeLevel(raw string) (Level, bool) {
+	return defaultNormalizer.Normalize(raw)
+}
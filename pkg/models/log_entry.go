@@ -3,14 +3,20 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 )
 
 // LogEntry represents a single log message with associated metadata
 type LogEntry struct {
-	// Timestamp is the time when the log entry was created
+	// Timestamp is the time when the log entry was created.
+	// When no event time could be parsed it falls back to IngestedAt and
+	// Fields[FieldTimestampUnparsed] is set.
 	Timestamp time.Time `json:"timestamp"`
 	
+	// IngestedAt is the time when LogStream received the log entry
+	IngestedAt time.Time `json:"ingested_at"`
+	
 	// Source identifies where the log came from
 	Source string `json:"source"`
 	
@@ -27,24 +33,43 @@ type LogEntry struct {
 	RawData string `json:"-"`
 }
 
+// Fields describing how an entry was parsed
+const (
+	// FieldTimestampUnparsed is set to true when the event time could not be parsed
+	FieldTimestampUnparsed = "timestamp_unparsed"
+	
+	// FieldTimestampRaw holds the timestamp value that could not be parsed
+	FieldTimestampRaw = "timestamp_raw"
+	
+	// FieldParseError describes why no parser could handle the raw data
+	FieldParseError = "parse_error"
+	
+	// FieldSampleRate holds the fraction of similar entries sampling kept, e.g. 0.1 when
+	// the entry stands for ten
+	FieldSampleRate = "sample_rate"
+)
+
 // NewLogEntry creates a new log entry with the current timestamp
 func NewLogEntry(source, message string) *LogEntry {
+	now := time.Now()
 	return &LogEntry{
-		Timestamp: time.Now(),
-		Source:    source,
-		Message:   message,
-		Fields:    make(map[string]interface{}),
+		Timestamp:  now,
+		IngestedAt: now,
+		Source:     source,
+		Message:    message,
+		Fields:     make(map[string]interface{}),
 	}
 }
 
 // Clone creates a deep copy of the log entry
 func (e *LogEntry) Clone() *LogEntry {
 	clone := &LogEntry{
-		Timestamp: e.Timestamp,
-		Source:    e.Source,
-		Level:     e.Level,
-		Message:   e.Message,
-		RawData:   e.RawData,
+		Timestamp:  e.Timestamp,
+		IngestedAt: e.IngestedAt,
+		Source:     e.Source,
+		Level:      e.Level,
+		Message:    e.Message,
+		RawData:    e.RawData,
 	}
 	
 	// Copy fields map
@@ -67,6 +92,41 @@ func (e *LogEntry) AddField(key string, value interface{}) *LogEntry {
 	return e
 }
 
+// TimestampParsed reports whether the entry carries a parsed event time
+func (e *LogEntry) TimestampParsed() bool {
+	unparsed, _ := e.GetField(FieldTimestampUnparsed)
+	return unparsed != true
+}
+
+// SampleRate returns the rate the entry was sampled at, or 1 when it wasn't sampled
+func (e *LogEntry) SampleRate() float64 {
+	value, ok := e.GetField(FieldSampleRate)
+	if !ok {
+		return 1
+	}
+	var rate float64
+	switch v := value.(type) {
+	case float64:
+		rate = v
+	case float32:
+		rate = float64(v)
+	case int:
+		rate = float64(v)
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 1
+		}
+		rate = parsed
+	default:
+		return 1
+	}
+	if rate <= 0 || rate > 1 {
+		return 1
+	}
+	return rate
+}
+
 // GetField retrieves a field from the log entry, returning the value and whether it exists
 func (e *LogEntry) GetField(key string) (interface{}, bool) {
 	if e.Fields == nil {
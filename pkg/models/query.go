@@ -22,6 +22,9 @@ type Query struct {
         // Levels limits logs to specific severity levels
         Levels []string `json:"levels,omitempty"`
         
+        // MinLevel limits logs to a minimum severity (e.g. "warn" for warn, error and fatal)
+        MinLevel string `json:"min_level,omitempty"`
+        
         // Filter is a free-text filter expression
         Filter string `json:"filter,omitempty"`
         
@@ -67,6 +70,12 @@ func (q Query) WithLevels(levels ...string) Query {
         return q
 }
 
+// WithMinLevel sets the minimum severity level for the query
+func (q Query) WithMinLevel(level string) Query {
+        q.MinLevel = level
+        return q
+}
+
 // WithFilter sets the filter expression for the query
 func (q Query) WithFilter(filter string) Query {
         q.Filter = filter
@@ -109,6 +118,9 @@ type Analysis struct {
         // Levels limits logs to specific severity levels
         Levels []string `json:"levels,omitempty"`
         
+        // MinLevel limits logs to a minimum severity level
+        MinLevel string `json:"min_level,omitempty"`
+        
         // Filter is a free-text filter expression
         Filter string `json:"filter,omitempty"`
         
@@ -123,6 +135,9 @@ type Analysis struct {
         
         // CorrelationFields specifies fields to correlate
         CorrelationFields []string `json:"correlation_fields,omitempty"`
+        
+        // Unweighted counts sampled entries once instead of by the inverse of their sample rate
+        Unweighted bool `json:"unweighted,omitempty"`
 }
 
 // PatternConfig contains configuration for pattern analysis
@@ -155,6 +170,9 @@ type AnalysisResult struct {
         
         // Correlation contains correlation analysis results
         Correlation map[string]map[string]int64 `json:"correlation,omitempty"`
+        
+        // Estimated is set when counts were re-weighted for sampled entries
+        Estimated bool `json:"estimated,omitempty"`
 }
 
 // Pattern represents a message pattern found in logs
@@ -0,0 +1,260 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// cefKeyPattern matches a valid CEF extension key
+var cefKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\[\]-]+$`)
+
+// securityTimestampKeys lists the extension keys carrying the event time, in order of preference
+var securityTimestampKeys = []string{"rt", "start", "devTime"}
+
+// securityTimeFormats are the timestamp layouts allowed by the CEF and LEEF specifications
+var securityTimeFormats = []string{
+	"Jan 2 2006 15:04:05.000 MST",
+	"Jan 2 2006 15:04:05.000",
+	"Jan 2 2006 15:04:05 MST",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 15:04:05.000 MST",
+	"Jan 2 15:04:05.000",
+	"Jan 2 15:04:05 MST",
+	"Jan 2 15:04:05",
+	time.RFC3339Nano,
+	time.RFC3339,
+}
+
+// CEFParser parses ArcSight Common Event Format (CEF) security events
+type CEFParser struct {
+	timestamps *TimestampParser
+}
+
+// NewCEFParser creates a new CEF parser
+func NewCEFParser() *CEFParser {
+	return &CEFParser{
+		timestamps: NewTimestampParser(),
+	}
+}
+
+// WithTimestampParser replaces the parser used for the event time
+func (p *CEFParser) WithTimestampParser(timestamps *TimestampParser) *CEFParser {
+	p.timestamps = timestamps
+	return p
+}
+
+// Name returns the parser name
+func (p *CEFParser) Name() string {
+	return "cef"
+}
+
+// CanParse checks if the given log line contains a CEF record
+func (p *CEFParser) CanParse(raw string) bool {
+	return findSecurityPrefix(raw, "CEF:") >= 0
+}
+
+// Parse parses a CEF log entry
+func (p *CEFParser) Parse(entry *models.LogEntry) error {
+	start := findSecurityPrefix(entry.RawData, "CEF:")
+	if start < 0 {
+		return fmt.Errorf("not a CEF record")
+	}
+
+	// CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+	parts := splitEscaped(entry.RawData[start+len("CEF:"):], '|', 8)
+	if len(parts) < 7 {
+		return fmt.Errorf("incomplete CEF header: expected 7 fields, got %d", len(parts))
+	}
+
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]interface{})
+	}
+
+	// Keep any syslog header preceding the record
+	if prefix := strings.TrimSpace(entry.RawData[:start]); prefix != "" {
+		entry.Fields["syslog_header"] = prefix
+	}
+
+	entry.Fields["cef_version"] = unescapeCEFHeader(parts[0])
+	entry.Fields["device_vendor"] = unescapeCEFHeader(parts[1])
+	entry.Fields["device_product"] = unescapeCEFHeader(parts[2])
+	entry.Fields["device_version"] = unescapeCEFHeader(parts[3])
+	entry.Fields["signature_id"] = unescapeCEFHeader(parts[4])
+	entry.Fields["name"] = unescapeCEFHeader(parts[5])
+
+	severity := strings.TrimSpace(unescapeCEFHeader(parts[6]))
+	entry.Fields["severity"] = severity
+	if level := securitySeverityToLevel(severity); level != "" {
+		entry.Level = level
+	}
+
+	entry.Message = unescapeCEFHeader(parts[5])
+
+	// Parse the extension key=value pairs
+	if len(parts) == 8 {
+		extension := parseCEFExtension(parts[7])
+		for key, value := range extension {
+			entry.Fields[key] = value
+		}
+		applySecurityTimestamp(p.timestamps, entry, extension)
+	}
+
+	return nil
+}
+
+// findSecurityPrefix returns the index of the record prefix (e.g. "CEF:") in the raw line.
+// The prefix must start the line or follow a syslog header separated by a space.
+func findSecurityPrefix(raw, prefix string) int {
+	idx := strings.Index(raw, prefix)
+	if idx < 0 {
+		return -1
+	}
+	if idx > 0 && raw[idx-1] != ' ' {
+		return -1
+	}
+
+	// Require the version number right after the prefix
+	rest := raw[idx+len(prefix):]
+	if len(rest) == 0 || rest[0] < '0' || rest[0] > '9' {
+		return -1
+	}
+	return idx
+}
+
+// splitEscaped splits s on sep, ignoring separators escaped with a backslash.
+// At most n parts are returned; the last part holds the unsplit remainder.
+func splitEscaped(s string, sep byte, n int) []string {
+	parts := make([]string, 0, n)
+	last := 0
+	for i := 0; i < len(s) && len(parts) < n-1; i++ {
+		switch s[i] {
+		case '\\':
+			i++ // Skip the escaped character
+		case sep:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// unescapeCEFHeader resolves the escape sequences allowed in CEF header fields
+func unescapeCEFHeader(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	return strings.NewReplacer(`\|`, "|", `\\`, `\`).Replace(s)
+}
+
+// unescapeCEFValue resolves the escape sequences allowed in CEF extension values
+func unescapeCEFValue(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	return strings.NewReplacer(`\=`, "=", `\\`, `\`, `\n`, "\n", `\r`, "\r", `\|`, "|").Replace(s)
+}
+
+// parseCEFExtension parses the space-separated key=value pairs of a CEF extension.
+// Values may contain spaces, so a value runs until the space preceding the next key.
+func parseCEFExtension(ext string) map[string]string {
+	result := make(map[string]string)
+
+	// Locate every unescaped '=' that is preceded by a valid key
+	type keyPos struct {
+		keyStart int
+		eq       int
+	}
+	var keys []keyPos
+	for i := 0; i < len(ext); i++ {
+		if ext[i] == '\\' {
+			i++
+			continue
+		}
+		if ext[i] != '=' {
+			continue
+		}
+
+		keyStart := strings.LastIndexByte(ext[:i], ' ') + 1
+		if cefKeyPattern.MatchString(ext[keyStart:i]) {
+			keys = append(keys, keyPos{keyStart: keyStart, eq: i})
+		}
+	}
+
+	for i, k := range keys {
+		valueEnd := len(ext)
+		if i+1 < len(keys) {
+			valueEnd = keys[i+1].keyStart
+		}
+		if valueEnd < k.eq+1 {
+			valueEnd = k.eq + 1
+		}
+
+		key := ext[k.keyStart:k.eq]
+		value := strings.TrimRight(ext[k.eq+1:valueEnd], " ")
+		result[key] = unescapeCEFValue(value)
+	}
+
+	return result
+}
+
+// securitySeverityToLevel maps a CEF or LEEF severity onto a log level.
+// Numeric severities follow the ArcSight 0-10 scale.
+func securitySeverityToLevel(severity string) string {
+	if n, err := strconv.Atoi(severity); err == nil {
+		switch {
+		case n <= 3:
+			return "info"
+		case n <= 6:
+			return "warn"
+		case n <= 8:
+			return "error"
+		default:
+			return "fatal"
+		}
+	}
+
+	switch strings.ToLower(severity) {
+	case "low":
+		return "info"
+	case "medium":
+		return "warn"
+	case "high":
+		return "error"
+	case "very-high", "very high":
+		return "fatal"
+	default:
+		return ""
+	}
+}
+
+// applySecurityTimestamp sets the entry timestamp from the first known timestamp key that parses.
+// Extra layouts (e.g. from LEEF devTimeFormat) are tried before the standard formats.
+func applySecurityTimestamp(timestamps *TimestampParser, entry *models.LogEntry, extension map[string]string, layouts ...string) {
+	layouts = append(layouts, securityTimeFormats...)
+
+	var unparsed interface{}
+	for _, key := range securityTimestampKeys {
+		value, ok := extension[key]
+		if !ok || value == "" {
+			continue
+		}
+		// Epoch values are milliseconds, which the timestamp parser detects by magnitude
+		if t, err := timestamps.Parse(value, entry.Source, layouts...); err == nil {
+			entry.Timestamp = t
+			return
+		}
+		if unparsed == nil {
+			unparsed = value
+		}
+	}
+
+	// Flag the entry when a timestamp was present but none could be parsed
+	if unparsed != nil {
+		timestamps.Apply(entry, unparsed, layouts...)
+	}
+}
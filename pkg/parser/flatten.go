@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ArrayMode controls how arrays are handled when flattening nested JSON
+type ArrayMode string
+
+const (
+	// ArrayModeIndex flattens array elements into indexed keys ("tags.0", "tags.1")
+	ArrayModeIndex ArrayMode = "index"
+	// ArrayModeJoin joins array elements into a single comma-separated string
+	ArrayModeJoin ArrayMode = "join"
+	// ArrayModeKeep keeps arrays unchanged
+	ArrayModeKeep ArrayMode = "keep"
+)
+
+// ParseArrayMode validates an array mode name
+func ParseArrayMode(mode string) (ArrayMode, error) {
+	switch ArrayMode(strings.ToLower(mode)) {
+	case ArrayModeIndex:
+		return ArrayModeIndex, nil
+	case ArrayModeJoin:
+		return ArrayModeJoin, nil
+	case ArrayModeKeep, "":
+		return ArrayModeKeep, nil
+	default:
+		return "", fmt.Errorf("invalid array mode %q (must be index, join or keep)", mode)
+	}
+}
+
+// FlattenFields flattens nested objects in fields into dotted keys
+func FlattenFields(fields map[string]interface{}, maxDepth int, arrayMode ArrayMode) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	flattenInto(result, "", fields, 1, maxDepth, arrayMode)
+	return result
+}
+
+// flattenInto writes the values of data into dst under dotted keys.
+// depth is the nesting level of data; objects nested deeper than maxDepth are kept whole.
+func flattenInto(dst map[string]interface{}, prefix string, data map[string]interface{}, depth, maxDepth int, arrayMode ArrayMode) {
+	for key, value := range data {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenValue(dst, key, value, depth, maxDepth, arrayMode)
+	}
+}
+
+// flattenValue writes a single value into dst, descending into objects and arrays
+func flattenValue(dst map[string]interface{}, key string, value interface{}, depth, maxDepth int, arrayMode ArrayMode) {
+	canDescend := maxDepth <= 0 || depth <= maxDepth
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if !canDescend || len(v) == 0 {
+			dst[key] = v
+			return
+		}
+		flattenInto(dst, key, v, depth+1, maxDepth, arrayMode)
+	case []interface{}:
+		switch arrayMode {
+		case ArrayModeIndex:
+			if !canDescend || len(v) == 0 {
+				dst[key] = v
+				return
+			}
+			for i, elem := range v {
+				flattenValue(dst, key+"."+strconv.Itoa(i), elem, depth+1, maxDepth, arrayMode)
+			}
+		case ArrayModeJoin:
+			parts := make([]string, len(v))
+			for i, elem := range v {
+				parts[i] = scalarString(elem)
+			}
+			dst[key] = strings.Join(parts, ",")
+		default:
+			dst[key] = v
+		}
+	default:
+		dst[key] = v
+	}
+}
+
+// scalarString renders a JSON value as a string, encoding objects and arrays as JSON
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		bytes, _ := json.Marshal(v)
+		return string(bytes)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// lookupPath resolves a dotted path in a decoded JSON object.
+// Keys are matched exactly first, then case-insensitively.
+func lookupPath(data map[string]interface{}, path string) (interface{}, bool) {
+	// A literal key containing dots takes precedence over nested lookup
+	if value, ok := lookupKey(data, path); ok {
+		return value, true
+	}
+
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		return nil, false
+	}
+	child, ok := lookupKey(data, head)
+	if !ok {
+		return nil, false
+	}
+	childMap, ok := child.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(childMap, rest)
+}
+
+// lookupKey finds a key in data, falling back to a case-insensitive match
+func lookupKey(data map[string]interface{}, key string) (interface{}, bool) {
+	if k, ok := matchKey(data, key); ok {
+		return data[k], true
+	}
+	return nil, false
+}
+
+// matchKey returns the actual key in data matching key, preferring an exact match
+func matchKey(data map[string]interface{}, key string) (string, bool) {
+	if _, ok := data[key]; ok {
+		return key, true
+	}
+	for k := range data {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// takePath returns the value of the first path present in data and removes it.
+// Parent objects left empty by the removal are removed as well.
+func takePath(data map[string]interface{}, paths []string) (interface{}, bool) {
+	for _, path := range paths {
+		if value, ok := lookupPath(data, path); ok {
+			deletePath(data, path)
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// deletePath removes the value at path from data, pruning empty parents
+func deletePath(data map[string]interface{}, path string) {
+	if k, ok := matchKey(data, path); ok {
+		delete(data, k)
+		return
+	}
+
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		return
+	}
+	k, ok := matchKey(data, head)
+	if !ok {
+		return
+	}
+	if childMap, ok := data[k].(map[string]interface{}); ok {
+		deletePath(childMap, rest)
+		if len(childMap) == 0 {
+			delete(data, k)
+		}
+	}
+}
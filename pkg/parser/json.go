@@ -2,18 +2,101 @@ package parser
 
 import (
         "encoding/json"
+        "fmt"
+        "regexp"
+        "strconv"
         "strings"
-        "time"
 
         "github.com/mariasu11/logstreamApp/pkg/models"
 )
 
+// JSONFieldMapping maps JSON paths onto the core LogEntry fields.
+// Each field lists dotted paths (e.g. "log.level") tried in order; the first present value wins.
+type JSONFieldMapping struct {
+        Timestamp []string
+        Level     []string
+        Message   []string
+        Source    []string
+}
+
+// DefaultJSONFieldMapping returns the keys recognised by the JSON parser out of the box
+func DefaultJSONFieldMapping() JSONFieldMapping {
+        return JSONFieldMapping{
+                Timestamp: []string{"timestamp", "time", "@timestamp", "date"},
+                Level:     []string{"level", "severity", "loglevel"},
+                Message:   []string{"message", "msg"},
+                Source:    []string{"source", "logger", "origin"},
+        }
+}
+
 // JSONParser is a parser for JSON-formatted logs
-type JSONParser struct{}
+type JSONParser struct {
+        mapping    JSONFieldMapping
+        flatten    bool
+        maxDepth   int
+        arrayMode  ArrayMode
+        timestamps *TimestampParser
+}
 
 // NewJSONParser creates a new JSON parser
 func NewJSONParser() *JSONParser {
-        return &JSONParser{}
+        return &JSONParser{
+                mapping:    DefaultJSONFieldMapping(),
+                arrayMode:  ArrayModeKeep,
+                timestamps: NewTimestampParser(),
+        }
+}
+
+// WithTimestampParser replaces the parser used for the event time
+func (p *JSONParser) WithTimestampParser(timestamps *TimestampParser) *JSONParser {
+        p.timestamps = timestamps
+        return p
+}
+
+// WithFieldMapping replaces the paths used to populate timestamp, level, message and source.
+// Empty path lists keep their defaults.
+func (p *JSONParser) WithFieldMapping(mapping JSONFieldMapping) *JSONParser {
+        if len(mapping.Timestamp) > 0 {
+                p.mapping.Timestamp = mapping.Timestamp
+        }
+        if len(mapping.Level) > 0 {
+                p.mapping.Level = mapping.Level
+        }
+        if len(mapping.Message) > 0 {
+                p.mapping.Message = mapping.Message
+        }
+        if len(mapping.Source) > 0 {
+                p.mapping.Source = mapping.Source
+        }
+        return p
+}
+
+// WithFlatten enables flattening of nested objects into dotted keys (e.g. "http.request.method").
+// maxDepth limits how many levels of nesting are flattened (0 means unlimited); deeper objects are kept as-is.
+func (p *JSONParser) WithFlatten(maxDepth int, arrayMode ArrayMode) *JSONParser {
+        p.flatten = true
+        p.maxDepth = maxDepth
+        p.arrayMode = arrayMode
+        return p
+}
+
+// JSONOptions configures the JSON parser built by NewDefaultParsers
+type JSONOptions struct {
+        // Mapping replaces the paths of the core fields; empty path lists keep their defaults
+        Mapping JSONFieldMapping
+        // Flatten turns nested objects into dotted keys, down to MaxDepth levels (0 means unlimited)
+        Flatten   bool
+        MaxDepth  int
+        ArrayMode ArrayMode
+}
+
+// WithOptions applies the field mapping and flattening options
+func (p *JSONParser) WithOptions(options JSONOptions) *JSONParser {
+        p.WithFieldMapping(options.Mapping)
+        if options.Flatten {
+                p.WithFlatten(options.MaxDepth, options.ArrayMode)
+        }
+        return p
 }
 
 // Name returns the parser name
@@ -25,7 +108,7 @@ func (p *JSONParser) Name() string {
 func (p *JSONParser) CanParse(raw string) bool {
         trimmed := strings.TrimSpace(raw)
         if len(trimmed) == 0 {
-            return false
+                return false
         }
         return trimmed[0] == '{'
 }
@@ -37,98 +120,135 @@ func (p *JSONParser) Parse(entry *models.LogEntry) error {
         if err := json.Unmarshal([]byte(entry.RawData), &jsonData); err != nil {
                 return err
         }
-        
+
         // Extract common fields
         if entry.Fields == nil {
                 entry.Fields = make(map[string]interface{})
         }
-        
-        // Process each field
-        for key, value := range jsonData {
-                switch strings.ToLower(key) {
-                case "timestamp", "time", "@timestamp", "date":
-                        p.parseTimestamp(entry, value)
-                case "message", "msg":
-                        if strVal, ok := value.(string); ok {
-                                entry.Message = strVal
-                        }
-                case "level", "severity", "loglevel":
-                        if strVal, ok := value.(string); ok {
-                                entry.Level = strVal
-                        }
-                case "source", "logger", "origin":
-                        if strVal, ok := value.(string); ok {
-                                entry.Source = strVal
-                        }
-                default:
-                        // Add all other fields to the Fields map
+
+        // Keep the original document for the fallback message before mapped paths are removed
+        var original []byte
+        if entry.Message == "" {
+                original, _ = json.Marshal(jsonData)
+        }
+
+        // Extract the mapped core fields, removing them from the remaining data
+        if value, ok := takePath(jsonData, p.mapping.Timestamp); ok {
+                p.timestamps.Apply(entry, value)
+        }
+        if value, ok := takePath(jsonData, p.mapping.Message); ok {
+                if strVal, ok := value.(string); ok {
+                        entry.Message = strVal
+                }
+        }
+        if value, ok := takePath(jsonData, p.mapping.Level); ok {
+                switch v := value.(type) {
+                case string:
+                        entry.Level = v
+                case float64:
+                        entry.Level = strconv.FormatFloat(v, 'f', -1, 64)
+                }
+        }
+        if value, ok := takePath(jsonData, p.mapping.Source); ok {
+                if strVal, ok := value.(string); ok {
+                        entry.Source = strVal
+                }
+        }
+
+        // Add all other fields to the Fields map
+        if p.flatten {
+                flattenInto(entry.Fields, "", jsonData, 1, p.maxDepth, p.arrayMode)
+        } else {
+                for key, value := range jsonData {
                         entry.Fields[key] = value
                 }
         }
-        
+
         // If no message was found, create one from the JSON
         if entry.Message == "" {
-                bytes, _ := json.Marshal(jsonData)
-                entry.Message = string(bytes)
+                entry.Message = string(original)
         }
-        
+
         return nil
 }
 
-// parseTimestamp attempts to parse a timestamp value
-func (p *JSONParser) parseTimestamp(entry *models.LogEntry, value interface{}) {
-        switch v := value.(type) {
-        case string:
-                // Try common time formats
-                formats := []string{
-                        time.RFC3339,
-                        time.RFC3339Nano,
-                        "2006-01-02T15:04:05",
-                        "2006-01-02 15:04:05",
-                        "2006/01/02 15:04:05",
-                        time.UnixDate,
-                        time.RubyDate,
-                }
-                
-                for _, format := range formats {
-                        if t, err := time.Parse(format, v); err == nil {
-                                entry.Timestamp = t
-                                return
-                        }
-                }
-        case float64:
-                // Assume Unix timestamp in seconds or milliseconds
-                if v > 1e12 {
-                        // Milliseconds
-                        entry.Timestamp = time.Unix(0, int64(v)*int64(time.Millisecond))
-                } else {
-                        // Seconds
-                        entry.Timestamp = time.Unix(int64(v), 0)
-                }
-        case int64:
-                // Assume Unix timestamp in seconds or milliseconds
-                if v > 1e12 {
-                        // Milliseconds
-                        entry.Timestamp = time.Unix(0, v*int64(time.Millisecond))
-                } else {
-                        // Seconds
-                        entry.Timestamp = time.Unix(v, 0)
-                }
-        }
+// Structured JSON log formats understood by JSONStructuredParser
+const (
+        JSONFormatHCLog  = "hclog"
+        JSONFormatBunyan = "bunyan"
+        JSONFormatZap    = "zap"
+        JSONFormatSlog   = "slog"
+        JSONFormatLogrus = "logrus"
+)
+
+// StructuredJSONFormats lists the structured formats from most to least specific.
+// Detection relies on format-specific keys, so more specific formats must be tried first.
+var StructuredJSONFormats = []string{
+        JSONFormatHCLog,
+        JSONFormatBunyan,
+        JSONFormatZap,
+        JSONFormatSlog,
+        JSONFormatLogrus,
 }
 
+// bunyanLevels maps Bunyan's numeric levels onto level names
+var bunyanLevels = map[int]string{
+        10: "trace",
+        20: "debug",
+        30: "info",
+        40: "warn",
+        50: "error",
+        60: "fatal",
+}
+
+// slogLevelPattern matches the upper-case level names written by log/slog (e.g. "INFO", "WARN+2")
+var slogLevelPattern = regexp.MustCompile(`"level"\s*:\s*"(DEBUG|INFO|WARN|ERROR)([+-]\d+)?"`)
+
+// bunyanLevelPattern matches Bunyan's numeric level field
+var bunyanLevelPattern = regexp.MustCompile(`"level"\s*:\s*\d`)
+
 // JSONStructuredParser parses specific JSON log formats like logrus, zap, etc.
 type JSONStructuredParser struct {
-        format string // Format identifier: "logrus", "zap", etc.
+        format     string // Format identifier: "logrus", "zap", etc.
+        timestamps *TimestampParser
+        options    JSONOptions
 }
 
 // NewJSONStructuredParser creates a new structured JSON parser
 func NewJSONStructuredParser(format string) *JSONStructuredParser {
         return &JSONStructuredParser{
-                format: format,
+                format:     format,
+                timestamps: NewTimestampParser(),
         }
 }
 
+// WithTimestampParser replaces the parser used for the event time
+func (p *JSONStructuredParser) WithTimestampParser(timestamps *TimestampParser) *JSONStructuredParser {
+        p.timestamps = timestamps
+        return p
+}
+
+// WithOptions applies the field mapping and flattening options. Mapped paths take
+// precedence over the format's own keys; empty path lists leave them alone.
+func (p *JSONStructuredParser) WithOptions(options JSONOptions) *JSONStructuredParser {
+        p.options = options
+        return p
+}
+
+// NewStructuredJSONParsers creates a parser for every structured format, most specific first
+func NewStructuredJSONParsers() []Parser {
+        return newStructuredJSONParsers(NewTimestampParser(), JSONOptions{})
+}
+
+// newStructuredJSONParsers creates the structured format parsers sharing one timestamp parser
+func newStructuredJSONParsers(timestamps *TimestampParser, options JSONOptions) []Parser {
+        parsers := make([]Parser, 0, len(StructuredJSONFormats))
+        for _, format := range StructuredJSONFormats {
+                parsers = append(parsers, NewJSONStructuredParser(format).WithTimestampParser(timestamps).WithOptions(options))
+        }
+        return parsers
+}
+
 // Name returns the parser name
 func (p *JSONStructuredParser) Name() string {
         return "json_" + p.format
@@ -140,15 +260,20 @@ func (p *JSONStructuredParser) CanParse(raw string) bool {
         if len(trimmed) == 0 || trimmed[0] != '{' {
                 return false
         }
-        
+
         // For specific format detection, look for format-specific fields
         switch p.format {
-        case "logrus":
-                return strings.Contains(raw, "\"level\"") && strings.Contains(raw, "\"msg\"")
-        case "zap":
-                return strings.Contains(raw, "\"level\"") && strings.Contains(raw, "\"msg\"")
-        case "hclog":
-                return strings.Contains(raw, "\"@level\"") && strings.Contains(raw, "\"@message\"")
+        case JSONFormatHCLog:
+                return jsonHasKey(trimmed, "@level") && jsonHasKey(trimmed, "@message")
+        case JSONFormatBunyan:
+                return jsonHasKey(trimmed, "msg") && jsonHasKey(trimmed, "hostname") &&
+                        jsonHasKey(trimmed, "pid") && bunyanLevelPattern.MatchString(trimmed)
+        case JSONFormatZap:
+                return jsonHasKey(trimmed, "level") && jsonHasKey(trimmed, "msg") && jsonHasKey(trimmed, "ts")
+        case JSONFormatSlog:
+                return jsonHasKey(trimmed, "time") && jsonHasKey(trimmed, "msg") && slogLevelPattern.MatchString(trimmed)
+        case JSONFormatLogrus:
+                return jsonHasKey(trimmed, "level") && jsonHasKey(trimmed, "msg") && jsonHasKey(trimmed, "time")
         default:
                 return false
         }
@@ -161,112 +286,219 @@ func (p *JSONStructuredParser) Parse(entry *models.LogEntry) error {
         if err := json.Unmarshal([]byte(entry.RawData), &jsonData); err != nil {
                 return err
         }
-        
+
         // Initialize fields if necessary
         if entry.Fields == nil {
                 entry.Fields = make(map[string]interface{})
         }
-        
+
         // Process based on the format
         switch p.format {
-        case "logrus":
+        case JSONFormatLogrus:
                 return p.parseLogrus(entry, jsonData)
-        case "zap":
+        case JSONFormatZap:
                 return p.parseZap(entry, jsonData)
-        case "hclog":
+        case JSONFormatHCLog:
                 return p.parseHCLog(entry, jsonData)
+        case JSONFormatSlog:
+                return p.parseSlog(entry, jsonData)
+        case JSONFormatBunyan:
+                return p.parseBunyan(entry, jsonData)
         default:
                 // Fall back to generic JSON parsing
-                return NewJSONParser().Parse(entry)
+                return NewJSONParser().WithTimestampParser(p.timestamps).WithOptions(p.options).Parse(entry)
         }
 }
 
-// parseLogrus parses a logrus-formatted JSON log
-func (p *JSONStructuredParser) parseLogrus(entry *models.LogEntry, data map[string]interface{}) error {
-        // Extract standard logrus fields
-        if msg, ok := data["msg"].(string); ok {
-                entry.Message = msg
-                delete(data, "msg")
+// addRemaining applies the configured mapping to what the format left in data, and adds
+// the rest to the entry's fields, flattened when configured
+func (p *JSONStructuredParser) addRemaining(entry *models.LogEntry, data map[string]interface{}) error {
+        mapping := p.options.Mapping
+        if value, ok := takePath(data, mapping.Timestamp); ok {
+                p.timestamps.Apply(entry, value)
         }
-        
-        if level, ok := data["level"].(string); ok {
-                entry.Level = level
-                delete(data, "level")
+        if value, ok := takePath(data, mapping.Message); ok {
+                if strVal, ok := value.(string); ok {
+                        entry.Message = strVal
+                }
         }
-        
-        if timeStr, ok := data["time"].(string); ok {
-                if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
-                        entry.Timestamp = t
+        if value, ok := takePath(data, mapping.Level); ok {
+                switch v := value.(type) {
+                case string:
+                        entry.Level = v
+                case float64:
+                        entry.Level = strconv.FormatFloat(v, 'f', -1, 64)
                 }
-                delete(data, "time")
         }
-        
-        // Add remaining fields
+        if value, ok := takePath(data, mapping.Source); ok {
+                if strVal, ok := value.(string); ok {
+                        entry.Source = strVal
+                }
+        }
+
+        if p.options.Flatten {
+                flattenInto(entry.Fields, "", data, 1, p.options.MaxDepth, p.options.ArrayMode)
+                return nil
+        }
         for k, v := range data {
                 entry.Fields[k] = v
         }
-        
         return nil
 }
 
+// parseLogrus parses a logrus-formatted JSON log
+func (p *JSONStructuredParser) parseLogrus(entry *models.LogEntry, data map[string]interface{}) error {
+        // Extract standard logrus fields
+        takeString(data, "msg", &entry.Message)
+        takeString(data, "level", &entry.Level)
+
+        if value, ok := data["time"]; ok {
+                p.timestamps.Apply(entry, value)
+                delete(data, "time")
+        }
+
+        // Add remaining fields
+        return p.addRemaining(entry, data)
+}
+
 // parseZap parses a zap-formatted JSON log
 func (p *JSONStructuredParser) parseZap(entry *models.LogEntry, data map[string]interface{}) error {
         // Extract standard zap fields
-        if msg, ok := data["msg"].(string); ok {
-                entry.Message = msg
-                delete(data, "msg")
+        takeString(data, "msg", &entry.Message)
+        takeString(data, "level", &entry.Level)
+        takeString(data, "logger", &entry.Source)
+
+        // Epoch encoders write seconds with a fractional part or whole millis/nanos,
+        // ISO8601 and RFC3339 encoders write strings
+        if value, ok := data["ts"]; ok {
+                p.timestamps.Apply(entry, value, "2006-01-02T15:04:05.000Z0700")
+                delete(data, "ts")
         }
-        
-        if level, ok := data["level"].(string); ok {
-                entry.Level = level
-                delete(data, "level")
+
+        // Split the caller ("path/file.go:42") into file and line
+        if caller, ok := data["caller"].(string); ok {
+                if idx := strings.LastIndexByte(caller, ':'); idx > 0 {
+                        entry.Fields["caller_file"] = caller[:idx]
+                        if line, err := strconv.Atoi(caller[idx+1:]); err == nil {
+                                entry.Fields["caller_line"] = line
+                        }
+                }
         }
-        
-        if ts, ok := data["ts"].(float64); ok {
-                // Zap timestamps are often Unix seconds with fractional part
-                secs := int64(ts)
-                nsecs := int64((ts - float64(secs)) * 1e9)
-                entry.Timestamp = time.Unix(secs, nsecs)
-                delete(data, "ts")
+
+        // Keep stack traces as a single string field
+        if stack, ok := data["stacktrace"].(string); ok {
+                entry.Fields["stacktrace"] = strings.TrimSpace(stack)
+                delete(data, "stacktrace")
         }
-        
+
         // Add remaining fields
-        for k, v := range data {
-                entry.Fields[k] = v
-        }
-        
-        return nil
+        return p.addRemaining(entry, data)
 }
 
 // parseHCLog parses a HashiCorp HCLog-formatted JSON log
 func (p *JSONStructuredParser) parseHCLog(entry *models.LogEntry, data map[string]interface{}) error {
         // Extract standard hclog fields
-        if msg, ok := data["@message"].(string); ok {
-                entry.Message = msg
-                delete(data, "@message")
-        }
-        
-        if level, ok := data["@level"].(string); ok {
-                entry.Level = level
-                delete(data, "@level")
-        }
-        
-        if timestamp, ok := data["@timestamp"].(string); ok {
-                if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
-                        entry.Timestamp = t
-                }
+        takeString(data, "@message", &entry.Message)
+        takeString(data, "@level", &entry.Level)
+        takeString(data, "@module", &entry.Source)
+
+        if value, ok := data["@timestamp"]; ok {
+                p.timestamps.Apply(entry, value)
                 delete(data, "@timestamp")
         }
-        
-        if module, ok := data["@module"].(string); ok {
-                entry.Source = module
-                delete(data, "@module")
+
+        if caller, ok := data["@caller"].(string); ok {
+                entry.Fields["caller"] = caller
+                delete(data, "@caller")
         }
-        
+
         // Add remaining fields
-        for k, v := range data {
-                entry.Fields[k] = v
+        return p.addRemaining(entry, data)
+}
+
+// parseSlog parses a log/slog JSONHandler-formatted log
+func (p *JSONStructuredParser) parseSlog(entry *models.LogEntry, data map[string]interface{}) error {
+        takeString(data, "msg", &entry.Message)
+
+        // slog levels are upper case and may carry an offset ("INFO+2")
+        if level, ok := data["level"].(string); ok {
+                if idx := strings.IndexAny(level, "+-"); idx > 0 {
+                        entry.Fields["level_offset"] = level[idx:]
+                        level = level[:idx]
+                }
+                entry.Level = strings.ToLower(level)
+                delete(data, "level")
+        }
+
+        if value, ok := data["time"]; ok {
+                p.timestamps.Apply(entry, value)
+                delete(data, "time")
+        }
+
+        // HandlerOptions.AddSource writes {"function", "file", "line"}
+        if source, ok := data["source"].(map[string]interface{}); ok {
+                file, _ := source["file"].(string)
+                if line, ok := source["line"].(float64); ok {
+                        entry.Fields["caller"] = fmt.Sprintf("%s:%d", file, int(line))
+                } else if file != "" {
+                        entry.Fields["caller"] = file
+                }
+                if function, ok := source["function"].(string); ok {
+                        entry.Fields["function"] = function
+                }
+                delete(data, "source")
+        }
+
+        // Add remaining fields
+        return p.addRemaining(entry, data)
+}
+
+// parseBunyan parses a node-bunyan formatted JSON log
+func (p *JSONStructuredParser) parseBunyan(entry *models.LogEntry, data map[string]interface{}) error {
+        takeString(data, "msg", &entry.Message)
+        takeString(data, "name", &entry.Source)
+
+        if level, ok := data["level"].(float64); ok {
+                if name, ok := bunyanLevels[int(level)]; ok {
+                        entry.Level = name
+                } else {
+                        entry.Level = strconv.Itoa(int(level))
+                }
+                delete(data, "level")
+        }
+
+        if value, ok := data["time"]; ok {
+                p.timestamps.Apply(entry, value)
+                delete(data, "time")
+        }
+
+        // "v" is the bunyan log format version, not event data
+        delete(data, "v")
+
+        // Add remaining fields (hostname, pid, ...)
+        return p.addRemaining(entry, data)
+}
+
+// takeString moves a string value out of data into dst
+func takeString(data map[string]interface{}, key string, dst *string) {
+        if value, ok := data[key].(string); ok {
+                *dst = value
+                delete(data, key)
+        }
+}
+
+// jsonHasKey reports whether the raw JSON object contains the given key
+func jsonHasKey(raw, key string) bool {
+        quoted := `"` + key + `"`
+        for offset := 0; ; {
+                idx := strings.Index(raw[offset:], quoted)
+                if idx < 0 {
+                        return false
+                }
+                rest := strings.TrimLeft(raw[offset+idx+len(quoted):], " \t")
+                if strings.HasPrefix(rest, ":") {
+                        return true
+                }
+                offset += idx + len(quoted)
         }
-        
-        return nil
 }
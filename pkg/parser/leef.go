@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// LEEFParser parses IBM Log Event Extended Format (LEEF) security events
+type LEEFParser struct {
+	timestamps *TimestampParser
+}
+
+// NewLEEFParser creates a new LEEF parser
+func NewLEEFParser() *LEEFParser {
+	return &LEEFParser{
+		timestamps: NewTimestampParser(),
+	}
+}
+
+// WithTimestampParser replaces the parser used for the event time
+func (p *LEEFParser) WithTimestampParser(timestamps *TimestampParser) *LEEFParser {
+	p.timestamps = timestamps
+	return p
+}
+
+// Name returns the parser name
+func (p *LEEFParser) Name() string {
+	return "leef"
+}
+
+// CanParse checks if the given log line contains a LEEF record
+func (p *LEEFParser) CanParse(raw string) bool {
+	return findSecurityPrefix(raw, "LEEF:") >= 0
+}
+
+// Parse parses a LEEF log entry
+func (p *LEEFParser) Parse(entry *models.LogEntry) error {
+	start := findSecurityPrefix(entry.RawData, "LEEF:")
+	if start < 0 {
+		return fmt.Errorf("not a LEEF record")
+	}
+
+	// LEEF:Version|Vendor|Product|Version|EventID|[DelimiterChar|]Attributes
+	parts := strings.SplitN(entry.RawData[start+len("LEEF:"):], "|", 6)
+	if len(parts) < 5 {
+		return fmt.Errorf("incomplete LEEF header: expected 5 fields, got %d", len(parts))
+	}
+
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]interface{})
+	}
+
+	// Keep any syslog header preceding the record
+	if prefix := strings.TrimSpace(entry.RawData[:start]); prefix != "" {
+		entry.Fields["syslog_header"] = prefix
+	}
+
+	version := parts[0]
+	entry.Fields["leef_version"] = version
+	entry.Fields["device_vendor"] = parts[1]
+	entry.Fields["device_product"] = parts[2]
+	entry.Fields["device_version"] = parts[3]
+	entry.Fields["event_id"] = parts[4]
+
+	attributes := make(map[string]string)
+	if len(parts) == 6 {
+		body := parts[5]
+		delimiter := "\t"
+
+		// LEEF 2.0 may declare a custom attribute delimiter in its own header field
+		if strings.HasPrefix(version, "2") {
+			if idx := strings.IndexByte(body, '|'); idx >= 0 && !strings.Contains(body[:idx], "=") {
+				if d := parseLEEFDelimiter(body[:idx]); d != "" {
+					delimiter = d
+				}
+				body = body[idx+1:]
+			}
+		}
+
+		for _, attr := range strings.Split(body, delimiter) {
+			key, value, found := strings.Cut(attr, "=")
+			key = strings.TrimSpace(key)
+			if !found || key == "" {
+				continue
+			}
+			attributes[key] = strings.TrimSpace(value)
+		}
+	}
+
+	for key, value := range attributes {
+		entry.Fields[key] = value
+	}
+
+	if sev, ok := attributes["sev"]; ok {
+		if level := securitySeverityToLevel(sev); level != "" {
+			entry.Level = level
+		}
+	}
+
+	if msg, ok := attributes["msg"]; ok && msg != "" {
+		entry.Message = msg
+	} else {
+		entry.Message = parts[4]
+	}
+
+	applySecurityTimestamp(p.timestamps, entry, attributes, javaTimeLayout(attributes["devTimeFormat"]))
+
+	return nil
+}
+
+// parseLEEFDelimiter decodes a LEEF 2.0 delimiter, given either literally or as hex (x09, 0x09)
+func parseLEEFDelimiter(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) == 1 {
+		return s
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0"), "x")
+	if code, err := strconv.ParseUint(hex, 16, 8); err == nil && hex != "" {
+		return string(rune(code))
+	}
+
+	return ""
+}
+
+// javaTimeLayout converts a Java SimpleDateFormat pattern (as used by devTimeFormat) into a Go layout
+func javaTimeLayout(pattern string) string {
+	if pattern == "" {
+		return ""
+	}
+
+	tokens := map[string]string{
+		"yyyy": "2006",
+		"yy":   "06",
+		"MMMM": "January",
+		"MMM":  "Jan",
+		"MM":   "01",
+		"M":    "1",
+		"dd":   "02",
+		"d":    "2",
+		"HH":   "15",
+		"hh":   "03",
+		"h":    "3",
+		"mm":   "04",
+		"ss":   "05",
+		"SSS":  "000",
+		"a":    "PM",
+		"z":    "MST",
+		"zzz":  "MST",
+		"Z":    "-0700",
+		"XXX":  "Z07:00",
+	}
+
+	var layout strings.Builder
+	for i := 0; i < len(pattern); {
+		// Quoted literal text
+		if pattern[i] == '\'' {
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				layout.WriteString(pattern[i+1:])
+				break
+			}
+			layout.WriteString(pattern[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+
+		// Consume a run of the same pattern letter
+		j := i
+		for j < len(pattern) && pattern[j] == pattern[i] {
+			j++
+		}
+		run := pattern[i:j]
+		if goToken, ok := tokens[run]; ok {
+			layout.WriteString(goToken)
+		} else {
+			layout.WriteString(run)
+		}
+		i = j
+	}
+
+	return layout.String()
+}
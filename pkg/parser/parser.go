@@ -21,14 +21,31 @@ type ParserRegistry struct {
 	parsers []Parser
 }
 
+// DefaultParsers returns the built-in parsers ordered from most to least specific,
+// so that format-specific parsers claim a line before the generic ones
+func DefaultParsers() []Parser {
+	return NewDefaultParsers(NewTimestampParser(), JSONOptions{})
+}
+
+// NewDefaultParsers returns the built-in parsers sharing one timestamp parser,
+// so timezone and clock-skew settings apply to every format. The JSON options
+// apply to the generic and structured JSON parsers.
+func NewDefaultParsers(timestamps *TimestampParser, json JSONOptions) []Parser {
+	parsers := []Parser{
+		NewCEFParser().WithTimestampParser(timestamps),
+		NewLEEFParser().WithTimestampParser(timestamps),
+	}
+	parsers = append(parsers, newStructuredJSONParsers(timestamps, json)...)
+	return append(parsers,
+		NewJSONParser().WithTimestampParser(timestamps).WithOptions(json),
+		NewRegexParser().WithTimestampParser(timestamps),
+	)
+}
+
 // NewParserRegistry creates a new parser registry with default parsers
 func NewParserRegistry() *ParserRegistry {
 	return &ParserRegistry{
-		parsers: []Parser{
-			NewJSONParser(),
-			NewRegexParser(),
-			// Add other default parsers here
-		},
+		parsers: DefaultParsers(),
 	}
 }
 
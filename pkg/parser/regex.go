@@ -11,7 +11,8 @@ import (
 
 // RegexParser is a parser that uses regular expressions to parse log entries
 type RegexParser struct {
-	patterns []*regexPattern
+	patterns   []*regexPattern
+	timestamps *TimestampParser
 }
 
 // regexPattern defines a regex pattern with named capture groups
@@ -28,15 +29,16 @@ type regexPattern struct {
 // NewRegexParser creates a new regex parser with default patterns
 func NewRegexParser() *RegexParser {
 	parser := &RegexParser{
-		patterns: make([]*regexPattern, 0),
+		patterns:   make([]*regexPattern, 0),
+		timestamps: NewTimestampParser(),
 	}
 	
 	// Add common log formats
 	
-	// Apache/Nginx access log format
+	// Apache/Nginx access log format, with the referer and user agent of the combined format when present
 	parser.AddPattern(
 		"apache",
-		`^(?P<ip>\S+) \S+ \S+ \[(?P<timestamp>[^\]]+)\] "(?P<method>\S+) (?P<path>\S+) (?P<protocol>\S+)" (?P<status>\d+) (?P<bytes>\d+)`,
+		`^(?P<ip>\S+) \S+ \S+ \[(?P<timestamp>[^\]]+)\] "(?P<method>\S+) (?P<path>\S+) (?P<protocol>\S+)" (?P<status>\d+) (?P<bytes>\d+)(?: "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)")?`,
 		[]string{"02/Jan/2006:15:04:05 -0700"},
 		"timestamp",
 		"",
@@ -85,6 +87,13 @@ func (p *RegexParser) Name() string {
 	return "regex"
 }
 
+// WithTimestampParser replaces the parser used for the event time.
+// Pattern time formats are tried first; formats without a year or zone are completed by the timestamp parser.
+func (p *RegexParser) WithTimestampParser(timestamps *TimestampParser) *RegexParser {
+	p.timestamps = timestamps
+	return p
+}
+
 // AddPattern adds a new regex pattern to the parser
 func (p *RegexParser) AddPattern(name, pattern string, timeFormats []string, timeField, msgField, levelField, sourceField string) error {
 	regex, err := regexp.Compile(pattern)
@@ -137,12 +146,7 @@ func (p *RegexParser) Parse(entry *models.LogEntry) error {
 		// Process timestamp
 		if pattern.timeField != "" {
 			if timeStr, ok := fields[pattern.timeField]; ok {
-				for _, format := range pattern.timeFormats {
-					if t, err := time.Parse(format, timeStr); err == nil {
-						entry.Timestamp = t
-						break
-					}
-				}
+				p.timestamps.Apply(entry, timeStr, pattern.timeFormats...)
 			}
 		}
 		
@@ -199,6 +203,19 @@ func (p *RegexParser) Parse(entry *models.LogEntry) error {
 	return nil
 }
 
+// ForPattern returns a parser restricted to the named pattern
+func (p *RegexParser) ForPattern(name string) (*RegexParser, bool) {
+	for _, pattern := range p.patterns {
+		if pattern.name == name {
+			return &RegexParser{
+				patterns:   []*regexPattern{pattern},
+				timestamps: p.timestamps,
+			}, true
+		}
+	}
+	return nil, false
+}
+
 // PatternNames returns the names of all registered patterns
 func (p *RegexParser) PatternNames() []string {
 	names := make([]string, len(p.patterns))
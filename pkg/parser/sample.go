@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Attempt records how a parser that claimed a line via CanParse handled it
+type Attempt struct {
+	Parser string
+	Error  error
+}
+
+// ParseWith runs an entry through parsers in order: the first parser that claims the raw line
+// via CanParse and parses it without error wins. It returns the name of that parser (empty if
+// none succeeded) and every attempt made. Entries no parser handled are tagged with
+// models.FieldParseError, and entries whose timestamp is unchanged by parsing are flagged
+// with models.FieldTimestampUnparsed.
+func ParseWith(parsers []Parser, entry *models.LogEntry) (string, []Attempt) {
+	received := entry.Timestamp
+
+	var attempts []Attempt
+	matched := ""
+	for _, p := range parsers {
+		if !p.CanParse(entry.RawData) {
+			continue
+		}
+		err := p.Parse(entry)
+		attempts = append(attempts, Attempt{Parser: p.Name(), Error: err})
+		if err == nil {
+			matched = p.Name()
+			break
+		}
+	}
+
+	if matched == "" {
+		entry.AddField(models.FieldParseError, describeFailure(attempts))
+	}
+
+	// Flag entries whose timestamp is still the time they were received
+	if entry.Timestamp.Equal(received) {
+		entry.AddField(models.FieldTimestampUnparsed, true)
+	}
+
+	return matched, attempts
+}
+
+// describeFailure summarizes why no parser handled a line
+func describeFailure(attempts []Attempt) string {
+	if len(attempts) == 0 {
+		return "no parser matched"
+	}
+
+	failures := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		failures = append(failures, attempt.Parser+": "+attempt.Error.Error())
+	}
+	return strings.Join(failures, "; ")
+}
+
+// SelectParsers narrows parsers down to the one with the given name.
+// A regex rule name (e.g. "apache") selects the regex parser restricted to that rule.
+// An empty name returns all parsers.
+func SelectParsers(parsers []Parser, name string) ([]Parser, error) {
+	if name == "" {
+		return parsers, nil
+	}
+
+	for _, p := range parsers {
+		if p.Name() == name {
+			return []Parser{p}, nil
+		}
+	}
+
+	for _, p := range parsers {
+		if regex, ok := p.(*RegexParser); ok {
+			if rule, ok := regex.ForPattern(name); ok {
+				return []Parser{rule}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unknown parser or rule %q", name)
+}
+
+// SampleAttempt is the serializable form of an Attempt
+type SampleAttempt struct {
+	Parser string `json:"parser"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SampleResult describes how a sample line was parsed
+type SampleResult struct {
+	Line     string           `json:"line"`
+	Parser   string           `json:"parser,omitempty"`
+	Attempts []SampleAttempt  `json:"attempts"`
+	Entry    *models.LogEntry `json:"entry"`
+}
+
+// ParseSample parses a sample line the way the processor would, recording which parsers claimed it
+func ParseSample(parsers []Parser, source, line string) *SampleResult {
+	now := time.Now()
+	entry := &models.LogEntry{
+		Timestamp:  now,
+		IngestedAt: now,
+		Source:     source,
+		RawData:    line,
+		Fields:     make(map[string]interface{}),
+	}
+
+	matched, attempts := ParseWith(parsers, entry)
+
+	// Lines no parser handles keep the raw line as their message
+	if entry.Message == "" {
+		entry.Message = line
+	}
+
+	result := &SampleResult{
+		Line:     line,
+		Parser:   matched,
+		Attempts: make([]SampleAttempt, 0, len(attempts)),
+		Entry:    entry,
+	}
+	for _, attempt := range attempts {
+		sample := SampleAttempt{Parser: attempt.Parser}
+		if attempt.Error != nil {
+			sample.Error = attempt.Error.Error()
+		}
+		result.Attempts = append(result.Attempts, sample)
+	}
+
+	return result
+}
+
+// UnparsedSample is the summary key for lines no parser handled
+const UnparsedSample = "unparsed"
+
+// SampleMatch counts the sample lines handled by one parser
+type SampleMatch struct {
+	Parser string `json:"parser"`
+	Lines  int    `json:"lines"`
+}
+
+// SummarizeSamples counts the lines handled by each parser, most used first
+func SummarizeSamples(results []*SampleResult) []SampleMatch {
+	counts := make(map[string]int)
+	for _, result := range results {
+		name := result.Parser
+		if name == "" {
+			name = UnparsedSample
+		}
+		counts[name]++
+	}
+
+	summary := make([]SampleMatch, 0, len(counts))
+	for name, lines := range counts {
+		summary = append(summary, SampleMatch{Parser: name, Lines: lines})
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Lines != summary[j].Lines {
+			return summary[i].Lines > summary[j].Lines
+		}
+		return summary[i].Parser < summary[j].Parser
+	})
+
+	return summary
+}
@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mariasu11/logstreamApp/pkg/models"
+)
+
+// Default clock-skew limits applied by TimestampParser
+const (
+	// DefaultMaxTimestampAhead rejects event times further in the future than this
+	DefaultMaxTimestampAhead = 24 * time.Hour
+	// DefaultMaxTimestampAge rejects event times older than this (about ten years)
+	DefaultMaxTimestampAge = 10 * 365 * 24 * time.Hour
+)
+
+var (
+	// ErrUnknownTimestampFormat is returned when no layout matches a timestamp value
+	ErrUnknownTimestampFormat = errors.New("unknown timestamp format")
+	// ErrTimestampOutOfRange is returned when a timestamp falls outside the clock-skew limits
+	ErrTimestampOutOfRange = errors.New("timestamp outside allowed clock skew")
+)
+
+// DefaultTimestampLayouts are the layouts tried by TimestampParser, most specific first.
+// Layouts without a zone are read in the source's default timezone,
+// and layouts without a year (syslog) get the most recent year that does not put them in the future.
+var DefaultTimestampLayouts = []string{
+	// ISO 8601 / RFC 3339 and their common variants
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02",
+
+	// Apache access and error logs
+	"02/Jan/2006:15:04:05 -0700",
+	time.ANSIC,
+
+	// RFC 3164 syslog (no year)
+	"Jan _2 15:04:05",
+	"Jan _2 2006 15:04:05",
+
+	// Go and Unix date formats
+	time.UnixDate,
+	time.RubyDate,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	"02 Jan 06 15:04 MST",
+	"01/02/2006 15:04:05",
+}
+
+// TimestampParser detects and parses event timestamps in the formats seen across log sources.
+// It is safe for concurrent use once configured.
+type TimestampParser struct {
+	layouts         []string
+	location        *time.Location
+	sourceLocations map[string]*time.Location
+	maxAhead        time.Duration
+	maxAge          time.Duration
+	now             func() time.Time
+}
+
+// NewTimestampParser creates a timestamp parser with the default layouts, UTC as the default timezone
+// and the default clock-skew limits
+func NewTimestampParser() *TimestampParser {
+	return &TimestampParser{
+		layouts:         DefaultTimestampLayouts,
+		location:        time.UTC,
+		sourceLocations: make(map[string]*time.Location),
+		maxAhead:        DefaultMaxTimestampAhead,
+		maxAge:          DefaultMaxTimestampAge,
+		now:             time.Now,
+	}
+}
+
+// WithLocation sets the timezone used for timestamps that carry no zone
+func (p *TimestampParser) WithLocation(loc *time.Location) *TimestampParser {
+	if loc != nil {
+		p.location = loc
+	}
+	return p
+}
+
+// WithSourceLocation sets the timezone used for zone-less timestamps from one source
+func (p *TimestampParser) WithSourceLocation(source string, loc *time.Location) *TimestampParser {
+	if loc != nil {
+		p.sourceLocations[source] = loc
+	}
+	return p
+}
+
+// WithLayouts adds layouts that are tried before the default ones
+func (p *TimestampParser) WithLayouts(layouts ...string) *TimestampParser {
+	p.layouts = append(append([]string{}, layouts...), p.layouts...)
+	return p
+}
+
+// WithSkewLimits sets how far in the past and future an event time may be, relative to now.
+// A zero limit disables that check.
+func (p *TimestampParser) WithSkewLimits(maxAge, maxAhead time.Duration) *TimestampParser {
+	p.maxAge = maxAge
+	p.maxAhead = maxAhead
+	return p
+}
+
+// WithClock replaces the clock used for year inference and skew checks
+func (p *TimestampParser) WithClock(now func() time.Time) *TimestampParser {
+	p.now = now
+	return p
+}
+
+// Location returns the default timezone for a source
+func (p *TimestampParser) Location(source string) *time.Location {
+	if loc, ok := p.sourceLocations[source]; ok {
+		return loc
+	}
+	return p.location
+}
+
+// Parse parses a timestamp value read from a log line.
+// Strings are matched against the extra layouts first, then the default ones; numbers and
+// numeric strings are read as epoch seconds, milliseconds, microseconds or nanoseconds by magnitude.
+func (p *TimestampParser) Parse(value interface{}, source string, layouts ...string) (time.Time, error) {
+	var (
+		t   time.Time
+		err error
+	)
+
+	switch v := value.(type) {
+	case string:
+		t, err = p.parseString(strings.TrimSpace(v), source, layouts)
+	case float64:
+		t, err = epochTime(v)
+	case int64:
+		t, err = epochIntTime(v)
+	case int:
+		t, err = epochIntTime(int64(v))
+	case json.Number:
+		var f float64
+		if f, err = v.Float64(); err == nil {
+			t, err = epochTime(f)
+		}
+	case time.Time:
+		t = v
+	default:
+		err = fmt.Errorf("%w: unsupported type %T", ErrUnknownTimestampFormat, value)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := p.checkSkew(t); err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+// Apply parses value and sets it as the entry timestamp.
+// On failure the timestamp is left untouched and the entry is flagged with
+// models.FieldTimestampUnparsed, keeping the raw value in models.FieldTimestampRaw.
+func (p *TimestampParser) Apply(entry *models.LogEntry, value interface{}, layouts ...string) bool {
+	t, err := p.Parse(value, entry.Source, layouts...)
+	if err != nil {
+		entry.AddField(models.FieldTimestampUnparsed, true)
+		entry.AddField(models.FieldTimestampRaw, value)
+		return false
+	}
+
+	entry.Timestamp = t
+	delete(entry.Fields, models.FieldTimestampUnparsed)
+	return true
+}
+
+// parseString parses a formatted or numeric timestamp string
+func (p *TimestampParser) parseString(value, source string, layouts []string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: empty value", ErrUnknownTimestampFormat)
+	}
+
+	if isEpochString(value) {
+		// Whole numbers keep full nanosecond precision
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return epochIntTime(n)
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return epochTime(f)
+		}
+	}
+
+	loc := p.Location(source)
+	for _, candidates := range [][]string{layouts, p.layouts} {
+		for _, layout := range candidates {
+			if layout == "" {
+				continue
+			}
+			t, err := time.ParseInLocation(layout, value, loc)
+			if err != nil {
+				continue
+			}
+			if t.Year() == 0 {
+				t = p.inferYear(t, loc)
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: %q", ErrUnknownTimestampFormat, value)
+}
+
+// inferYear places a year-less timestamp in the current year, or the previous one
+// if that would put it more than a day in the future (e.g. December logs read in January)
+func (p *TimestampParser) inferYear(t time.Time, loc *time.Location) time.Time {
+	now := p.now().In(loc)
+	withYear := t.AddDate(now.Year(), 0, 0)
+	if withYear.After(now.Add(24 * time.Hour)) {
+		withYear = t.AddDate(now.Year()-1, 0, 0)
+	}
+	return withYear
+}
+
+// checkSkew rejects timestamps outside the configured clock-skew limits
+func (p *TimestampParser) checkSkew(t time.Time) error {
+	now := p.now()
+	if p.maxAhead > 0 && t.After(now.Add(p.maxAhead)) {
+		return fmt.Errorf("%w: %s is more than %s ahead", ErrTimestampOutOfRange, t.Format(time.RFC3339), p.maxAhead)
+	}
+	if p.maxAge > 0 && t.Before(now.Add(-p.maxAge)) {
+		return fmt.Errorf("%w: %s is more than %s old", ErrTimestampOutOfRange, t.Format(time.RFC3339), p.maxAge)
+	}
+	return nil
+}
+
+// isEpochString reports whether s is an unsigned decimal number, optionally with a fraction
+func isEpochString(s string) bool {
+	digits, fraction, _ := strings.Cut(s, ".")
+	if digits == "" {
+		return false
+	}
+	for _, part := range []string{digits, fraction} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// epochTime converts an epoch timestamp, choosing seconds, milliseconds, microseconds
+// or nanoseconds by its magnitude
+func epochTime(v float64) (time.Time, error) {
+	if v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return time.Time{}, fmt.Errorf("%w: invalid epoch value %v", ErrUnknownTimestampFormat, v)
+	}
+
+	switch {
+	case v > 1e17:
+		return time.Unix(0, int64(v)), nil
+	case v > 1e14:
+		return time.Unix(0, int64(v*float64(time.Microsecond))), nil
+	case v > 1e11:
+		return time.Unix(0, int64(v*float64(time.Millisecond))), nil
+	default:
+		secs := int64(v)
+		nsecs := int64(math.Round((v - float64(secs)) * 1e9))
+		return time.Unix(secs, nsecs), nil
+	}
+}
+
+// epochIntTime converts a whole epoch timestamp without losing precision
+func epochIntTime(v int64) (time.Time, error) {
+	switch {
+	case v <= 0:
+		return time.Time{}, fmt.Errorf("%w: invalid epoch value %d", ErrUnknownTimestampFormat, v)
+	case v > 1e17:
+		return time.Unix(0, v), nil
+	case v > 1e14:
+		return time.Unix(0, v*int64(time.Microsecond)), nil
+	case v > 1e11:
+		return time.UnixMilli(v), nil
+	default:
+		return time.Unix(v, 0), nil
+	}
+}
+
+// defaultTimestampParser is used by ParseTimestamp
+var defaultTimestampParser = NewTimestampParser()
+
+// ParseTimestamp parses a timestamp value with the default layouts, timezone and skew limits
+func ParseTimestamp(value interface{}) (time.Time, error) {
+	return defaultTimestampParser.Parse(value, "")
+}
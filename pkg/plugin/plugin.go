@@ -111,3 +111,15 @@ type InputPlugin interface {
 	// Stop stops collecting logs
 	Stop() error
 }
+
+// EmitFunc hands entries collected by an input plugin to the processing pipeline. It
+// returns once they are accepted, waiting while the pipeline is busy.
+type EmitFunc func(entries []*models.LogEntry) error
+
+// EmittingInputPlugin is an input plugin that hands the entries it collects to the pipeline.
+// SetEmitter is called before Start.
+type EmittingInputPlugin interface {
+	InputPlugin
+	// SetEmitter sets the function entries are handed to
+	SetEmitter(emit EmitFunc)
+}
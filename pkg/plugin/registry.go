@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"plugin"
+	"sort"
 	"sync"
 
 	"github.com/hashicorp/go-hclog"
@@ -139,6 +140,44 @@ func (r *Registry) ListPlugins() []PluginInfo {
 	return plugins
 }
 
+// OutputPlugins returns the registered plugins that output log entries, sorted by name
+func (r *Registry) OutputPlugins() []OutputPlugin {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var outputs []OutputPlugin
+	for _, name := range r.names() {
+		if output, ok := r.plugins[name].(OutputPlugin); ok {
+			outputs = append(outputs, output)
+		}
+	}
+	return outputs
+}
+
+// InputPlugins returns the registered plugins that collect log entries, sorted by name
+func (r *Registry) InputPlugins() []InputPlugin {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var inputs []InputPlugin
+	for _, name := range r.names() {
+		if input, ok := r.plugins[name].(InputPlugin); ok {
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// names returns the names of the registered plugins in order; callers hold the mutex
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.plugins))
+	for name := range r.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ClosePlugins closes all plugins
 func (r *Registry) ClosePlugins() {
 	r.mutex.Lock()
@@ -0,0 +1,630 @@
+// Package queue provides a persistent FIFO queue backed by segment files on local disk.
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decides when appended records are flushed to stable storage
+type SyncPolicy string
+
+// Sync policies
+const (
+	// SyncAlways fsyncs every append and acknowledgement before it returns
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs in the background every sync interval
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+// ParseSyncPolicy parses a sync policy name
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(name); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown sync policy %q (expected always, interval or never)", name)
+	}
+}
+
+const (
+	// DefaultSegmentSize is the size at which a new segment file is started
+	DefaultSegmentSize = 64 << 20
+	// DefaultSyncInterval is how often the interval policy syncs
+	DefaultSyncInterval = time.Second
+
+	// recordHeaderSize covers the length, checksum and sequence number of a record
+	recordHeaderSize = 16
+	segmentExt       = ".seg"
+	ackFileName      = "ack"
+)
+
+var (
+	// ErrFull is returned by Append when the record would take the queue over its size cap
+	ErrFull = errors.New("disk queue is full")
+	// ErrClosed is returned once the queue is closed
+	ErrClosed = errors.New("disk queue is closed")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Record is a queued payload with its sequence number
+type Record struct {
+	Seq  uint64
+	Data []byte
+}
+
+// segment is a file holding the consecutive records first..last
+type segment struct {
+	first uint64
+	last  uint64
+	size  int64
+	path  string
+}
+
+// empty reports whether the segment holds no records
+func (s *segment) empty() bool {
+	return s.last < s.first
+}
+
+// DiskQueue is a FIFO of records stored in segment files, read in order and acknowledged
+// individually. Records stay on disk until they and every record before them are
+// acknowledged, so the unacknowledged ones are delivered again after a restart: delivery
+// is at least once. A segment file is deleted once all its records are acknowledged.
+// It is safe for concurrent use.
+type DiskQueue struct {
+	dir          string
+	maxSize      int64
+	segmentSize  int64
+	policy       SyncPolicy
+	syncInterval time.Duration
+
+	mu       sync.Mutex
+	segments []*segment
+	writer   *os.File
+	nextSeq  uint64
+	size     int64
+	dirty    bool
+	// notify is closed and replaced when a record is appended, waking readers
+	notify chan struct{}
+
+	reader     *bufio.Reader
+	readerFile *os.File
+	readerSeg  *segment
+	readerSeq  uint64
+	readSeq    uint64
+
+	ackedThrough uint64
+	acked        map[uint64]bool
+	ackDirty     bool
+	// gaps maps the first sequence number of each run of records lost to corruption to its last
+	gaps map[uint64]uint64
+
+	ticker *time.Ticker
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// OpenDiskQueue opens or creates a queue in a directory, holding at most maxSize bytes
+// (unbounded when zero). Records left unacknowledged by a previous run are read first; a
+// record torn by a crash ends its segment and is discarded.
+func OpenDiskQueue(dir string, maxSize int64) (*DiskQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &DiskQueue{
+		dir:          dir,
+		maxSize:      maxSize,
+		segmentSize:  DefaultSegmentSize,
+		policy:       SyncInterval,
+		syncInterval: DefaultSyncInterval,
+		notify:       make(chan struct{}),
+		acked:        make(map[uint64]bool),
+		gaps:         make(map[uint64]uint64),
+		done:         make(chan struct{}),
+	}
+	if err := q.recover(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+
+	q.ticker = time.NewTicker(q.syncInterval)
+	q.wg.Add(1)
+	go q.syncLoop()
+	return q, nil
+}
+
+// WithSegmentSize sets the size at which a new segment file is started
+func (q *DiskQueue) WithSegmentSize(size int64) *DiskQueue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if size > 0 {
+		q.segmentSize = size
+	}
+	return q
+}
+
+// WithSyncPolicy sets when records and acknowledgements are flushed to disk; the interval
+// applies to the interval policy (DefaultSyncInterval when zero)
+func (q *DiskQueue) WithSyncPolicy(policy SyncPolicy, interval time.Duration) *DiskQueue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policy = policy
+	if interval > 0 {
+		q.syncInterval = interval
+		q.ticker.Reset(interval)
+	}
+	return q
+}
+
+// recover loads the acknowledgement cursor and the segments left on disk
+func (q *DiskQueue) recover() error {
+	data, err := os.ReadFile(filepath.Join(q.dir, ackFileName))
+	switch {
+	case err == nil && len(data) == 8:
+		q.ackedThrough = binary.BigEndian.Uint64(data)
+	case err == nil:
+		return fmt.Errorf("invalid acknowledgement file in %s", q.dir)
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read acknowledgement file: %w", err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(q.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	var segments []*segment
+	for _, name := range names {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil || first == 0 {
+			continue
+		}
+		segments = append(segments, &segment{first: first, path: name})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].first < segments[j].first })
+
+	q.nextSeq = q.ackedThrough + 1
+	for _, seg := range segments {
+		if err := scanSegment(seg); err != nil {
+			return err
+		}
+		if seg.empty() || seg.last <= q.ackedThrough {
+			// Nothing left to deliver
+			if err := os.Remove(seg.path); err != nil {
+				return fmt.Errorf("failed to remove segment: %w", err)
+			}
+			continue
+		}
+		if len(q.segments) > 0 {
+			switch {
+			case seg.first < q.nextSeq:
+				return fmt.Errorf("segment %s overlaps the previous one", seg.path)
+			case seg.first > q.nextSeq:
+				// Records lost to corruption are treated as acknowledged
+				q.gaps[q.nextSeq] = seg.first - 1
+			}
+		}
+		q.segments = append(q.segments, seg)
+		q.size += seg.size
+		q.nextSeq = seg.last + 1
+	}
+
+	if len(q.segments) > 0 && q.segments[0].first > q.ackedThrough+1 {
+		q.ackedThrough = q.segments[0].first - 1
+		q.ackDirty = true
+	}
+	q.readSeq = q.ackedThrough + 1
+
+	// New records go to a new segment, leaving the recovered ones as they are
+	return q.rotate()
+}
+
+// scanSegment validates the records of a segment, truncating it at the first torn or
+// corrupt one, and records its sequence range and size
+func scanSegment(seg *segment) error {
+	file, err := os.OpenFile(seg.path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	seg.last = seg.first - 1
+	var offset int64
+	for {
+		seq, data, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || seq != seg.last+1 {
+			// A torn write at the end of the segment, or corruption: keep what precedes it
+			if err := file.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to truncate segment: %w", err)
+			}
+			break
+		}
+		seg.last = seq
+		offset += int64(recordHeaderSize + len(data))
+	}
+	seg.size = offset
+	return nil
+}
+
+// readRecord reads the next record, returning io.EOF at a clean end
+func readRecord(reader *bufio.Reader) (uint64, []byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, fmt.Errorf("truncated record header")
+		}
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	seq := binary.BigEndian.Uint64(header[8:16])
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return 0, nil, fmt.Errorf("truncated record")
+	}
+	if crc32.Checksum(data, crcTable) != checksum {
+		return 0, nil, fmt.Errorf("record %d is corrupt", seq)
+	}
+	return seq, data, nil
+}
+
+// rotate starts a new segment at the next sequence number
+func (q *DiskQueue) rotate() error {
+	if q.writer != nil {
+		if err := q.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync segment: %w", err)
+		}
+		q.writer.Close()
+		q.writer = nil
+	}
+
+	seg := &segment{
+		first: q.nextSeq,
+		last:  q.nextSeq - 1,
+		path:  filepath.Join(q.dir, fmt.Sprintf("%020d%s", q.nextSeq, segmentExt)),
+	}
+	writer, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	q.writer = writer
+	q.segments = append(q.segments, seg)
+	return nil
+}
+
+// Append adds a record, returning its sequence number, or ErrFull when it would take the
+// queue over its size cap
+func (q *DiskQueue) Append(data []byte) (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrClosed
+	}
+	recordSize := int64(recordHeaderSize + len(data))
+	current := q.segments[len(q.segments)-1]
+	if q.maxSize > 0 && q.size+recordSize > q.maxSize {
+		// The segment being written is only deleted once another one is started, so start
+		// one when it is all acknowledged instead of staying full
+		if current.empty() || current.last > q.ackedThrough {
+			return 0, ErrFull
+		}
+		if err := q.rotate(); err != nil {
+			return 0, err
+		}
+		if err := q.removeAcked(); err != nil {
+			return 0, err
+		}
+		current = q.segments[len(q.segments)-1]
+		if q.size+recordSize > q.maxSize {
+			return 0, ErrFull
+		}
+	}
+
+	if !current.empty() && current.size+recordSize > q.segmentSize {
+		if err := q.rotate(); err != nil {
+			return 0, err
+		}
+		current = q.segments[len(q.segments)-1]
+	}
+
+	seq := q.nextSeq
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(data, crcTable))
+	binary.BigEndian.PutUint64(record[8:16], seq)
+	copy(record[recordHeaderSize:], data)
+	if _, err := q.writer.Write(record); err != nil {
+		// Drop whatever part of the record was written, so the segment stays readable
+		q.writer.Truncate(current.size)
+		return 0, fmt.Errorf("failed to write record: %w", err)
+	}
+	if q.policy == SyncAlways {
+		if err := q.writer.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync segment: %w", err)
+		}
+	} else {
+		q.dirty = true
+	}
+
+	current.last = seq
+	current.size += recordSize
+	q.size += recordSize
+	q.nextSeq++
+
+	close(q.notify)
+	q.notify = make(chan struct{})
+	return seq, nil
+}
+
+// Read returns the next record, waiting until one is appended, the context is done or the
+// queue is closed. Each record is read once per run; acknowledge it with Ack.
+func (q *DiskQueue) Read(ctx context.Context) (Record, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return Record{}, ErrClosed
+		}
+		if q.readSeq < q.nextSeq {
+			record, err := q.readLocked()
+			q.mu.Unlock()
+			return record, err
+		}
+		notify := q.notify
+		q.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		case <-q.done:
+			return Record{}, ErrClosed
+		}
+	}
+}
+
+// readLocked reads the record at readSeq, moving the reader to its segment if needed
+func (q *DiskQueue) readLocked() (Record, error) {
+	if end, ok := q.gaps[q.readSeq]; ok {
+		q.readSeq = end + 1
+	}
+	seg := q.segmentOf(q.readSeq)
+	if seg == nil {
+		return Record{}, fmt.Errorf("record %d is missing", q.readSeq)
+	}
+	if q.readerSeg != seg || q.readerSeq > q.readSeq {
+		q.closeReader()
+		file, err := os.Open(seg.path)
+		if err != nil {
+			return Record{}, fmt.Errorf("failed to open segment: %w", err)
+		}
+		q.readerFile, q.reader, q.readerSeg, q.readerSeq = file, bufio.NewReader(file), seg, seg.first
+	}
+
+	for {
+		seq, data, err := readRecord(q.reader)
+		if err != nil {
+			q.closeReader()
+			return Record{}, fmt.Errorf("failed to read record %d: %w", q.readSeq, err)
+		}
+		q.readerSeq = seq + 1
+		if seq == q.readSeq {
+			q.readSeq++
+			return Record{Seq: seq, Data: data}, nil
+		}
+	}
+}
+
+// segmentOf returns the segment holding a sequence number
+func (q *DiskQueue) segmentOf(seq uint64) *segment {
+	for _, seg := range q.segments {
+		if seq >= seg.first && seq <= seg.last {
+			return seg
+		}
+	}
+	return nil
+}
+
+// closeReader closes the read handle
+func (q *DiskQueue) closeReader() {
+	if q.readerFile != nil {
+		q.readerFile.Close()
+	}
+	q.readerFile, q.reader, q.readerSeg = nil, nil, nil
+}
+
+// Ack acknowledges a record. Segments whose records are all acknowledged, along with every
+// record before them, are deleted.
+func (q *DiskQueue) Ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if seq <= q.ackedThrough || seq >= q.nextSeq {
+		return nil
+	}
+	q.acked[seq] = true
+	if seq != q.ackedThrough+1 {
+		return nil
+	}
+	for {
+		next := q.ackedThrough + 1
+		if end, ok := q.gaps[next]; ok {
+			delete(q.gaps, next)
+			q.ackedThrough = end
+			continue
+		}
+		if !q.acked[next] {
+			break
+		}
+		delete(q.acked, next)
+		q.ackedThrough = next
+	}
+	q.ackDirty = true
+
+	if q.policy == SyncAlways {
+		if err := q.writeAck(true); err != nil {
+			return err
+		}
+	}
+	return q.removeAcked()
+}
+
+// writeAck persists the acknowledgement cursor, replacing the file atomically
+func (q *DiskQueue) writeAck(sync bool) error {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], q.ackedThrough)
+
+	tmp := filepath.Join(q.dir, ackFileName+".tmp")
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write acknowledgements: %w", err)
+	}
+	_, err = file.Write(data[:])
+	if err == nil && sync {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(q.dir, ackFileName))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write acknowledgements: %w", err)
+	}
+	q.ackDirty = false
+	return nil
+}
+
+// removeAcked deletes the acknowledged segments before the one being written
+func (q *DiskQueue) removeAcked() error {
+	removable := 0
+	for removable < len(q.segments)-1 && q.segments[removable].last <= q.ackedThrough {
+		removable++
+	}
+	if removable == 0 {
+		return nil
+	}
+	// The cursor is persisted first, so a crash can't leave it before deleted records
+	if q.ackDirty {
+		if err := q.writeAck(q.policy != SyncNever); err != nil {
+			return err
+		}
+	}
+
+	for _, seg := range q.segments[:removable] {
+		if q.readerSeg == seg {
+			q.closeReader()
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove segment: %w", err)
+		}
+		q.size -= seg.size
+	}
+	q.segments = append(q.segments[:0], q.segments[removable:]...)
+	return nil
+}
+
+// syncLoop flushes appended records and acknowledgements in the background
+func (q *DiskQueue) syncLoop() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.ticker.C:
+			q.mu.Lock()
+			q.flushLocked()
+			q.mu.Unlock()
+		}
+	}
+}
+
+// flushLocked syncs pending writes as the policy requires and persists the cursor
+func (q *DiskQueue) flushLocked() {
+	if q.dirty && q.policy == SyncInterval {
+		if err := q.writer.Sync(); err == nil {
+			q.dirty = false
+		}
+	}
+	if q.ackDirty {
+		// A cursor that fails to persist is retried on the next tick
+		_ = q.writeAck(q.policy != SyncNever)
+	}
+}
+
+// Len returns the number of records not yet acknowledged
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(q.nextSeq-1-q.ackedThrough) - len(q.acked)
+}
+
+// Size returns the bytes held in segment files
+func (q *DiskQueue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close flushes the queue and closes its files. Unacknowledged records are delivered
+// again when the queue is next opened.
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.done)
+	q.ticker.Stop()
+
+	var err error
+	if q.dirty && q.policy != SyncNever {
+		err = q.writer.Sync()
+	}
+	if q.ackDirty {
+		if ackErr := q.writeAck(q.policy != SyncNever); err == nil {
+			err = ackErr
+		}
+	}
+	q.closeFiles()
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	return err
+}
+
+// closeFiles closes the read and write handles
+func (q *DiskQueue) closeFiles() {
+	q.closeReader()
+	if q.writer != nil {
+		q.writer.Close()
+		q.writer = nil
+	}
+}
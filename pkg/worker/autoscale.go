@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// Autoscaling defaults
+const (
+	// DefaultScaleInterval is how often the autoscaler checks the load
+	DefaultScaleInterval = time.Second
+	// DefaultScaleCooldown is the least time between resizes
+	DefaultScaleCooldown = 30 * time.Second
+)
+
+// Queue fill ratios above which workers are added and below which they are removed. The
+// gap between them keeps the pool from resizing back and forth around a single threshold.
+const (
+	scaleUpFill   = 0.5
+	scaleDownFill = 0.1
+)
+
+// WithAutoscale lets the pool grow from min to max workers while jobs queue up, and shrink
+// back once they don't. Call it before Start; a max not above min disables autoscaling.
+func (p *Pool) WithAutoscale(min, max int) *Pool {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	p.workers = min
+	p.minWorkers = min
+	p.maxWorkers = max
+	return p
+}
+
+// WithScaleInterval sets how often the autoscaler checks the load, and the cooldown: the
+// least time between resizes, for which the load must also stay low before workers are
+// removed
+func (p *Pool) WithScaleInterval(interval, cooldown time.Duration) *Pool {
+	if interval > 0 {
+		p.scaleInterval = interval
+	}
+	if cooldown >= 0 {
+		p.scaleCooldown = cooldown
+	}
+	return p
+}
+
+// WithTargetLatency also adds workers while jobs wait and take longer than the target on
+// average, and keeps workers until the average falls below half of it; zero disables it
+func (p *Pool) WithTargetLatency(latency time.Duration) *Pool {
+	p.targetLatency = latency
+	return p
+}
+
+// autoscale resizes the pool with the load until the context is cancelled or the pool stops
+func (p *Pool) autoscale(ctx context.Context) {
+	ticker := time.NewTicker(p.scaleInterval)
+	defer ticker.Stop()
+
+	var lastResize, calmSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stopping:
+			return
+		case now := <-ticker.C:
+			busy, calm := p.load()
+			if !calm {
+				calmSince = time.Time{}
+			} else if calmSince.IsZero() {
+				calmSince = now
+			}
+			if now.Sub(lastResize) < p.scaleCooldown {
+				continue
+			}
+
+			p.scaleMu.Lock()
+			workers := p.workers
+			p.scaleMu.Unlock()
+
+			switch {
+			case busy && workers < p.maxWorkers:
+				// Grow by half, to catch up with a burst in a few steps
+				step := workers / 2
+				if step < 1 {
+					step = 1
+				}
+				if p.resize(ctx, workers+step) {
+					lastResize = now
+				}
+			case calm && workers > p.minWorkers && now.Sub(calmSince) >= p.scaleCooldown:
+				// Shrink one worker at a time
+				if p.resize(ctx, workers-1) {
+					lastResize = now
+					calmSince = now
+				}
+			}
+		}
+	}
+}
+
+// load reports whether the pool needs more workers or could do with fewer, from the depth
+// of the shared queue and the average time of the jobs run since the last check
+func (p *Pool) load() (busy, calm bool) {
+	// Only the shared queue counts: added workers can't take jobs from the lanes
+	queued := len(p.jobs)
+	fill := float64(queued) / float64(cap(p.jobs))
+
+	var latency time.Duration
+	if done := p.done.Swap(0); done > 0 {
+		latency = time.Duration(p.busy.Swap(0) / done)
+	}
+
+	busy = fill >= scaleUpFill
+	calm = fill <= scaleDownFill
+	if p.targetLatency > 0 {
+		busy = busy || (queued > 0 && latency > p.targetLatency)
+		calm = calm && latency <= p.targetLatency/2
+	}
+	return busy, calm
+}
+
+// resize adds or retires workers to reach n, between the minimum and maximum. Workers added
+// by autoscaling are retired last in, first out, each finishing its current job. It reports
+// false once Stop has begun, when the pool is left as it is.
+func (p *Pool) resize(ctx context.Context, n int) bool {
+	if n > p.maxWorkers {
+		n = p.maxWorkers
+	}
+	if n < p.minWorkers {
+		n = p.minWorkers
+	}
+
+	p.scaleMu.Lock()
+	defer p.scaleMu.Unlock()
+
+	if p.stopped {
+		return false
+	}
+	for p.workers < n {
+		quit := make(chan struct{})
+		p.retire = append(p.retire, quit)
+		p.startWorker(ctx, p.workers, quit)
+		p.workers++
+	}
+	for p.workers > n && len(p.retire) > 0 {
+		last := len(p.retire) - 1
+		close(p.retire[last])
+		p.retire = p.retire[:last]
+		p.workers--
+	}
+	return true
+}
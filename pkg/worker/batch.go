@@ -0,0 +1,236 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBatchProcessorClosed is returned by Add once the batch processor is closed
+var ErrBatchProcessorClosed = errors.New("batch processor is closed")
+
+// BatchProcessor groups items into batches and processes each batch in one call. A batch is
+// processed once it holds the maximum number of items or bytes, or once its first item has
+// waited for the interval. Batches failing after their retries go to the dead-letter hook;
+// without one, their errors are returned by the next Flush or Close.
+type BatchProcessor[T any] struct {
+	pool     *Pool
+	maxItems int
+	maxBytes int
+	sizeOf   func(T) int
+	interval time.Duration
+	process  func(ctx context.Context, batch []T) error
+
+	retries    int
+	backoff    time.Duration
+	deadLetter func(ctx context.Context, batch []T, err error)
+
+	mu     sync.Mutex
+	items  []T
+	bytes  int
+	batch  uint64 // counts the batches taken, so a timer doesn't take a later batch early
+	closed bool
+	errs   []error
+
+	// pending counts the batches handed over and not yet processed; drained is closed
+	// whenever it falls to zero
+	pending int
+	drained chan struct{}
+
+	// Batches run on the caller's goroutine take a ticket under mu, then wait under runMu
+	// for their turn, so they are processed in order. mu is never held while waiting for
+	// runMu, as a running batch takes mu when it is done.
+	runMu   sync.Mutex
+	turn    *sync.Cond
+	tickets uint64 // counts the tickets handed out
+	serving uint64 // the ticket whose batch runs next
+}
+
+// NewBatchProcessor creates a batch processor handing batches of up to maxItems items to
+// process, on the pool's workers or, when pool is nil, on the goroutine that completes the
+// batch. Only the latter keeps batches in order. The pool must block or reject when full, as
+// a dropped batch is never processed, and a job of the pool must not add to a batch processor
+// running on the same pool, as it could wait for itself.
+func NewBatchProcessor[T any](pool *Pool, maxItems int, interval time.Duration, process func(ctx context.Context, batch []T) error) *BatchProcessor[T] {
+	if maxItems < 1 {
+		maxItems = 1
+	}
+	b := &BatchProcessor[T]{
+		pool:     pool,
+		maxItems: maxItems,
+		interval: interval,
+		process:  process,
+		items:    make([]T, 0, maxItems),
+		drained:  make(chan struct{}),
+	}
+	b.turn = sync.NewCond(&b.runMu)
+	return b
+}
+
+// WithMaxBytes also completes a batch once the sizes of its items add up to maxBytes
+func (b *BatchProcessor[T]) WithMaxBytes(maxBytes int, sizeOf func(T) int) *BatchProcessor[T] {
+	b.maxBytes = maxBytes
+	b.sizeOf = sizeOf
+	return b
+}
+
+// WithRetry processes a failed batch again up to retries times, waiting backoff before the
+// first retry and twice as long before each next one
+func (b *BatchProcessor[T]) WithRetry(retries int, backoff time.Duration) *BatchProcessor[T] {
+	b.retries = retries
+	b.backoff = backoff
+	return b
+}
+
+// WithDeadLetter hands batches that still fail after their retries, or that the pool
+// refused, to a hook instead of reporting their errors from Flush and Close
+func (b *BatchProcessor[T]) WithDeadLetter(deadLetter func(ctx context.Context, batch []T, err error)) *BatchProcessor[T] {
+	b.deadLetter = deadLetter
+	return b
+}
+
+// Add adds an item to the current batch, processing the batch if it is complete
+func (b *BatchProcessor[T]) Add(ctx context.Context, item T) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatchProcessorClosed
+	}
+
+	b.items = append(b.items, item)
+	if b.sizeOf != nil {
+		b.bytes += b.sizeOf(item)
+	}
+	if len(b.items) == 1 && b.interval > 0 {
+		// Bound how long the batch's first item waits
+		batch := b.batch
+		time.AfterFunc(b.interval, func() { b.expire(batch) })
+	}
+
+	if len(b.items) < b.maxItems && (b.maxBytes <= 0 || b.bytes < b.maxBytes) {
+		b.mu.Unlock()
+		return nil
+	}
+	b.dispatchLocked(ctx)
+	return nil
+}
+
+// Flush processes the current batch and waits until every batch handed over so far is
+// processed, or the context is done. It returns the errors of the batches that failed
+// without a dead-letter hook since the last Flush.
+func (b *BatchProcessor[T]) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	if len(b.items) > 0 {
+		b.dispatchLocked(ctx)
+		b.mu.Lock()
+	}
+	for b.pending > 0 {
+		drained := b.drained
+		b.mu.Unlock()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.mu.Lock()
+	}
+	defer b.mu.Unlock()
+	err := errors.Join(b.errs...)
+	b.errs = nil
+	return err
+}
+
+// Close stops accepting items, then flushes as Flush does
+func (b *BatchProcessor[T]) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return b.Flush(ctx)
+}
+
+// expire processes a batch whose interval is over, unless it was already taken
+func (b *BatchProcessor[T]) expire(batch uint64) {
+	b.mu.Lock()
+	if b.batch != batch || len(b.items) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.dispatchLocked(context.Background())
+}
+
+// dispatchLocked takes the current batch and runs it, or submits it to the pool. It is
+// called with mu held and releases it.
+func (b *BatchProcessor[T]) dispatchLocked(ctx context.Context) {
+	items := b.items
+	b.items = make([]T, 0, b.maxItems)
+	b.bytes = 0
+	b.batch++
+	b.pending++
+
+	if b.pool == nil {
+		ticket := b.tickets
+		b.tickets++
+		b.mu.Unlock()
+
+		b.runMu.Lock()
+		defer b.runMu.Unlock()
+		for b.serving != ticket {
+			b.turn.Wait()
+		}
+		b.run(ctx, items)
+		b.serving++
+		b.turn.Broadcast()
+		return
+	}
+
+	b.mu.Unlock()
+	err := b.pool.Submit(ctx, func() { b.run(ctx, items) })
+	if err != nil {
+		b.fail(ctx, items, err)
+		b.done()
+	}
+}
+
+// run processes a batch, retrying it as configured
+func (b *BatchProcessor[T]) run(ctx context.Context, items []T) {
+	defer b.done()
+
+	err := b.process(ctx, items)
+	delay := b.backoff
+	for attempt := 0; err != nil && attempt < b.retries; attempt++ {
+		select {
+		case <-ctx.Done():
+			b.fail(ctx, items, err)
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		err = b.process(ctx, items)
+	}
+	if err != nil {
+		b.fail(ctx, items, err)
+	}
+}
+
+// fail hands a failed batch to the dead-letter hook, or keeps its error for Flush
+func (b *BatchProcessor[T]) fail(ctx context.Context, items []T, err error) {
+	if b.deadLetter != nil {
+		b.deadLetter(ctx, items, err)
+		return
+	}
+	b.mu.Lock()
+	b.errs = append(b.errs, err)
+	b.mu.Unlock()
+}
+
+// done counts a batch as processed
+func (b *BatchProcessor[T]) done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending--; b.pending == 0 {
+		close(b.drained)
+		b.drained = make(chan struct{})
+	}
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lane is the queue of keyed jobs run by a single worker, in the order they were submitted.
+// Only the minimum workers have lanes, so autoscaling never moves a key to another worker.
+type lane struct {
+	jobs  chan Job
+	depth prometheus.Gauge
+}
+
+// keyQuota bounds the jobs of one key queued or running in its lane. refs counts the
+// submitters and jobs holding it, so it is forgotten once the key goes quiet.
+type keyQuota struct {
+	slots chan struct{}
+	refs  int
+}
+
+// WithKeyQuota sets how many jobs of one key may wait in or run from its lane at once, so a
+// hot key can't fill the lane and starve the other keys sharing it. Defaults to half the lane
+// capacity; call it before Start.
+func (p *Pool) WithKeyQuota(quota int) *Pool {
+	if quota > 0 {
+		p.keyQuota = quota
+	}
+	return p
+}
+
+// SubmitKeyed adds a job to the lane its key hashes to. Jobs with the same key run one at a
+// time in the order they were submitted, while different keys run in parallel on other
+// workers. When the lane is full, or the key has used up its quota, the overflow policy
+// decides as for Submit. Order is only kept for jobs submitted one after another: concurrent
+// submitters of the same key race as usual.
+func (p *Pool) SubmitKeyed(ctx context.Context, key string, job Job) error {
+	p.initLanes()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	quota := p.acquireQuota(key)
+	if len(quota.slots) == cap(quota.slots) {
+		p.metrics.WorkItemsKeyLimited.Inc()
+	}
+	acquired, err := offer(p, ctx, quota.slots, struct{}{})
+	if !acquired {
+		p.releaseQuota(key, quota, false)
+		return err
+	}
+
+	lane := p.lanes[p.laneFor(key)]
+	queued, err := offer(p, ctx, lane.jobs, Job(func() {
+		defer p.releaseQuota(key, quota, true)
+		job()
+	}))
+	if !queued {
+		p.releaseQuota(key, quota, true)
+		return err
+	}
+	lane.depth.Inc()
+	return nil
+}
+
+// initLanes creates a lane for each of the minimum workers, which always run, splitting
+// the queue capacity between them
+func (p *Pool) initLanes() {
+	p.lanesOnce.Do(func() {
+		p.laneSize = cap(p.jobs) / p.minWorkers
+		if p.laneSize < 1 {
+			p.laneSize = 1
+		}
+		if p.keyQuota == 0 {
+			p.keyQuota = p.laneSize / 2
+		}
+		if p.keyQuota < 1 {
+			p.keyQuota = 1
+		}
+		p.quotas = make(map[string]*keyQuota)
+
+		p.lanes = make([]*lane, p.minWorkers)
+		for i := range p.lanes {
+			p.lanes[i] = &lane{
+				jobs:  make(chan Job, p.laneSize),
+				depth: p.metrics.WorkLaneQueueSize.WithLabelValues(strconv.Itoa(i)),
+			}
+		}
+	})
+}
+
+// laneFor hashes a key to a lane
+func (p *Pool) laneFor(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.lanes)))
+}
+
+// acquireQuota returns the quota of a key, creating it on first use
+func (p *Pool) acquireQuota(key string) *keyQuota {
+	p.quotaMu.Lock()
+	defer p.quotaMu.Unlock()
+
+	quota, ok := p.quotas[key]
+	if !ok {
+		quota = &keyQuota{slots: make(chan struct{}, p.keyQuota)}
+		p.quotas[key] = quota
+	}
+	quota.refs++
+	return quota
+}
+
+// releaseQuota gives back a reference to a key's quota, and its slot if one was taken
+func (p *Pool) releaseQuota(key string, quota *keyQuota, slot bool) {
+	if slot {
+		<-quota.slots
+	}
+
+	p.quotaMu.Lock()
+	defer p.quotaMu.Unlock()
+
+	if quota.refs--; quota.refs == 0 {
+		delete(p.quotas, key)
+	}
+}
+
+// laneSizes returns the number of jobs waiting in each lane
+func (p *Pool) laneSizes() []int {
+	p.initLanes()
+
+	sizes := make([]int, len(p.lanes))
+	for i, lane := range p.lanes {
+		sizes[i] = len(lane.jobs)
+	}
+	return sizes
+}
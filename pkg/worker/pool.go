@@ -2,19 +2,83 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mariasu11/logstreamApp/internal/metrics"
 )
 
+// OverflowPolicy decides what Submit does when the job queue is full
+type OverflowPolicy string
+
+// Overflow policies
+const (
+	// OverflowBlock waits for room in the queue, until the submit context is done
+	// or the block timeout passes
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowReject refuses the job with ErrQueueFull
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDrop discards the job and reports success, counting it as dropped
+	OverflowDrop OverflowPolicy = "drop"
+)
+
+// ParseOverflowPolicy parses an overflow policy name
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(name); policy {
+	case OverflowBlock, OverflowReject, OverflowDrop:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q (expected block, reject or drop)", name)
+	}
+}
+
+var (
+	// ErrQueueFull is returned by Submit when the queue is full and the job was not accepted
+	ErrQueueFull = errors.New("worker pool queue is full")
+	// ErrPoolStopped is returned by Submit once the pool is stopped
+	ErrPoolStopped = errors.New("worker pool is stopped")
+)
+
 // Pool represents a worker pool that processes jobs concurrently
 type Pool struct {
-	workers  int
-	jobs     chan Job
-	wg       sync.WaitGroup
-	metrics  *metrics.Metrics
-	stopOnce sync.Once
+	workers      int
+	minWorkers   int
+	maxWorkers   int
+	jobs         chan Job
+	wg           sync.WaitGroup
+	metrics      *metrics.Metrics
+	stopOnce     sync.Once
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+
+	// lanes are the per-worker queues of keyed jobs, created on first use
+	lanes     []*lane
+	laneSize  int
+	keyQuota  int
+	lanesOnce sync.Once
+	quotaMu   sync.Mutex
+	quotas    map[string]*keyQuota
+
+	// autoscaling settings, and the time and number of jobs run since the last check
+	scaleInterval time.Duration
+	scaleCooldown time.Duration
+	targetLatency time.Duration
+	busy          atomic.Int64
+	done          atomic.Int64
+
+	// scaleMu guards workers, the quit channels of the workers added by autoscaling
+	// and stopped, which keeps workers from being added once Stop begins
+	scaleMu sync.Mutex
+	retire  []chan struct{}
+	stopped bool
+
+	// stopping is closed when Stop begins, releasing blocked submitters; mu keeps
+	// jobs from being closed while a submitter sends on it
+	stopping chan struct{}
+	mu       sync.RWMutex
 }
 
 // Job is a function that should be executed by a worker
@@ -28,39 +92,99 @@ func NewPool(workers int) *Pool {
 	}
 	
 	return &Pool{
-		workers: workers,
-		jobs:    make(chan Job, workers*100), // Buffer size is 100x workers
-		metrics: metrics.GetMetrics(),
+		workers:       workers,
+		minWorkers:    workers,
+		maxWorkers:    workers,
+		jobs:          make(chan Job, workers*100), // Buffer size is 100x workers
+		metrics:       metrics.GetMetrics(),
+		policy:        OverflowBlock,
+		scaleInterval: DefaultScaleInterval,
+		scaleCooldown: DefaultScaleCooldown,
+		stopping:      make(chan struct{}),
+	}
+}
+
+// WithOverflowPolicy sets what Submit does when the queue is full (block by default)
+func (p *Pool) WithOverflowPolicy(policy OverflowPolicy) *Pool {
+	p.policy = policy
+	return p
+}
+
+// WithBlockTimeout bounds how long a blocking Submit waits before refusing the job with
+// ErrQueueFull; zero waits until the submit context is done
+func (p *Pool) WithBlockTimeout(timeout time.Duration) *Pool {
+	p.blockTimeout = timeout
+	return p
+}
+
+// WithQueueSize sets the capacity of the job queue; call it before Start
+func (p *Pool) WithQueueSize(size int) *Pool {
+	if size > 0 {
+		p.jobs = make(chan Job, size)
 	}
+	return p
 }
 
-// Start starts the worker pool
+// Start starts the worker pool, and the autoscaler when the pool may grow
 func (p *Pool) Start(ctx context.Context) {
-	p.metrics.WorkersActive.Set(float64(p.workers))
+	p.initLanes()
 	
 	// Start workers
+	p.scaleMu.Lock()
 	for i := 0; i < p.workers; i++ {
-		p.wg.Add(1)
-		go p.worker(ctx, i)
+		p.startWorker(ctx, i, nil)
+	}
+	p.scaleMu.Unlock()
+
+	if p.maxWorkers > p.minWorkers {
+		go p.autoscale(ctx)
 	}
 }
 
-// worker is the main worker goroutine
-func (p *Pool) worker(ctx context.Context, id int) {
+// startWorker starts a worker goroutine; callers hold scaleMu. Workers below the minimum
+// own a lane and run until the pool stops, the others until quit is closed.
+func (p *Pool) startWorker(ctx context.Context, id int, quit <-chan struct{}) {
+	p.wg.Add(1)
+	go p.worker(ctx, id, quit)
+}
+
+// worker is the main worker goroutine. It takes jobs from the shared queue and from its
+// own lane, if it has one, until both are closed or it is retired.
+func (p *Pool) worker(ctx context.Context, id int, quit <-chan struct{}) {
 	defer p.wg.Done()
-	
-	for {
+
+	p.metrics.WorkersActive.Inc()
+	defer p.metrics.WorkersActive.Dec()
+
+	jobs := p.jobs
+	var lane chan Job
+	if id < len(p.lanes) {
+		lane = p.lanes[id].jobs
+	}
+	for jobs != nil || lane != nil {
 		select {
 		case <-ctx.Done():
 			// Context is cancelled, exit
 			return
-		case job, ok := <-p.jobs:
+		case <-quit:
+			// Removed by the autoscaler
+			return
+		case job, ok := <-jobs:
 			if !ok {
-				// Channel closed, exit
-				return
+				// Channel closed, keep draining the lane
+				jobs = nil
+				continue
 			}
 			
 			// Process the job
+			p.metrics.WorkQueueSize.Dec()
+			p.processJob(job)
+		case job, ok := <-lane:
+			if !ok {
+				lane = nil
+				continue
+			}
+			p.lanes[id].depth.Dec()
 			p.processJob(job)
 		}
 	}
@@ -82,27 +206,89 @@ func (p *Pool) processJob(job Job) {
 	}()
 	
 	// Record metrics
+	elapsed := time.Since(start)
 	p.metrics.WorkItemsProcessed.Inc()
-	p.metrics.WorkerProcessingTime.Observe(time.Since(start).Seconds())
+	p.metrics.WorkerProcessingTime.Observe(elapsed.Seconds())
+	p.busy.Add(int64(elapsed))
+	p.done.Add(1)
 }
 
-// Submit adds a job to the worker pool
-func (p *Pool) Submit(job Job) {
-	select {
-	case p.jobs <- job:
-		// Job submitted successfully
+// Submit adds a job to the worker pool. When the queue is full, the overflow policy decides:
+// block waits for room and returns the context's error if it is done first (or ErrQueueFull
+// after the block timeout), reject returns ErrQueueFull, and drop discards the job and
+// returns nil. A nil error means the job was queued or deliberately dropped.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	queued, err := offer(p, ctx, p.jobs, job)
+	if queued {
 		p.metrics.WorkQueueSize.Inc()
+	}
+	return err
+}
+
+// offer puts a value on a channel, applying the overflow policy when it is full. It reports
+// whether the value was queued; a dropped value returns false and no error. Callers hold mu.
+func offer[T any](p *Pool, ctx context.Context, ch chan T, value T) (bool, error) {
+	select {
+	case <-p.stopping:
+		return false, ErrPoolStopped
 	default:
-		// Queue is full, log error
-		p.metrics.WorkItemsErrored.Inc()
+	}
+
+	// Fast path: room in the channel
+	select {
+	case ch <- value:
+		return true, nil
+	default:
+	}
+
+	switch p.policy {
+	case OverflowDrop:
+		p.metrics.WorkItemsDropped.Inc()
+		return false, nil
+	case OverflowReject:
+		p.metrics.WorkItemsRejected.Inc()
+		return false, ErrQueueFull
+	}
+
+	var timeout <-chan time.Time
+	if p.blockTimeout > 0 {
+		timer := time.NewTimer(p.blockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case ch <- value:
+		return true, nil
+	case <-timeout:
+		p.metrics.WorkItemsRejected.Inc()
+		return false, ErrQueueFull
+	case <-ctx.Done():
+		p.metrics.WorkItemsRejected.Inc()
+		return false, ctx.Err()
+	case <-p.stopping:
+		return false, ErrPoolStopped
 	}
 }
 
 // Stop gracefully shuts down the worker pool
 func (p *Pool) Stop(ctx context.Context) {
 	p.stopOnce.Do(func() {
-		// Close the jobs channel to signal workers to exit
+		// Stop resizing, release blocked submitters, then close the jobs channel to
+		// signal workers to exit once it is drained
+		p.scaleMu.Lock()
+		p.stopped = true
+		p.scaleMu.Unlock()
+		close(p.stopping)
+		p.initLanes()
+		p.mu.Lock()
 		close(p.jobs)
+		for _, lane := range p.lanes {
+			close(lane.jobs)
+		}
+		p.mu.Unlock()
 		
 		// Wait for all workers to finish with a timeout
 		done := make(chan struct{})
@@ -117,91 +303,22 @@ func (p *Pool) Stop(ctx context.Context) {
 		case <-ctx.Done():
 			// Timeout reached, some workers may still be running
 		}
-		
-		p.metrics.WorkersActive.Set(0)
 	})
 }
 
 // Metrics returns statistics about the worker pool
 func (p *Pool) Metrics() map[string]interface{} {
+	p.scaleMu.Lock()
+	workers := p.workers
+	p.scaleMu.Unlock()
+
 	return map[string]interface{}{
-		"workers":       p.workers,
-		"queue_size":    len(p.jobs),
+		"workers":        workers,
+		"min_workers":    p.minWorkers,
+		"max_workers":    p.maxWorkers,
+		"overflow":       string(p.policy),
+		"queue_size":     len(p.jobs),
 		"queue_capacity": cap(p.jobs),
+		"lane_sizes":     p.laneSizes(),
 	}
 }
-
-// BatchProcessor handles batch processing using a worker pool
-type BatchProcessor struct {
-	pool      *Pool
-	batchSize int
-	ticker    *time.Ticker
-	items     []interface{}
-	mutex     sync.Mutex
-	processor func([]interface{})
-}
-
-// NewBatchProcessor creates a new batch processor
-func NewBatchProcessor(pool *Pool, batchSize int, interval time.Duration, processor func([]interface{})) *BatchProcessor {
-	return &BatchProcessor{
-		pool:      pool,
-		batchSize: batchSize,
-		ticker:    time.NewTicker(interval),
-		items:     make([]interface{}, 0, batchSize),
-		processor: processor,
-	}
-}
-
-// Start starts the batch processor
-func (b *BatchProcessor) Start(ctx context.Context) {
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				b.ticker.Stop()
-				b.flush()
-				return
-			case <-b.ticker.C:
-				b.flush()
-			}
-		}
-	}()
-}
-
-// Add adds an item to the batch
-func (b *BatchProcessor) Add(item interface{}) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-	
-	b.items = append(b.items, item)
-	
-	if len(b.items) >= b.batchSize {
-		// Batch is full, process it
-		b.processCurrentBatch()
-	}
-}
-
-// flush processes any pending items
-func (b *BatchProcessor) flush() {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-	
-	if len(b.items) > 0 {
-		b.processCurrentBatch()
-	}
-}
-
-// processCurrentBatch processes the current batch of items
-func (b *BatchProcessor) processCurrentBatch() {
-	// Copy items to avoid race conditions
-	batch := make([]interface{}, len(b.items))
-	copy(batch, b.items)
-	
-	// Clear the current batch
-	b.items = b.items[:0]
-	
-	// Submit batch processing job to worker pool
-	b.pool.Submit(func() {
-		b.processor(batch)
-	})
-}
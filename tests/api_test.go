@@ -7,16 +7,21 @@ import (
         "io"
         "net/http"
         "net/http/httptest"
+        "strings"
         "testing"
         "time"
 
+        "github.com/spf13/viper"
         "github.com/stretchr/testify/assert"
         "github.com/stretchr/testify/require"
         "github.com/hashicorp/go-hclog"
 
         "github.com/mariasu11/logstreamApp/internal/api"
+        "github.com/mariasu11/logstreamApp/internal/config"
+        "github.com/mariasu11/logstreamApp/internal/processor"
         "github.com/mariasu11/logstreamApp/internal/storage"
         "github.com/mariasu11/logstreamApp/pkg/models"
+        "github.com/mariasu11/logstreamApp/pkg/worker"
 )
 
 func TestAPIServer(t *testing.T) {
@@ -114,6 +119,27 @@ func TestAPIServer(t *testing.T) {
                 assert.Equal(t, "Database connection failed", logs[0].Message)
         })
 
+        t.Run("GetLogs_WithMinLevel", func(t *testing.T) {
+                resp, err := http.Get(testServer.URL + "/api/v1/logs?min_level=warning")
+                require.NoError(t, err)
+                defer resp.Body.Close()
+
+                assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+                var logs []*models.LogEntry
+                err = json.NewDecoder(resp.Body).Decode(&logs)
+                require.NoError(t, err)
+
+                require.Equal(t, 1, len(logs))
+                assert.Equal(t, "error", logs[0].Level)
+
+                // An unknown level is refused instead of matching nothing
+                invalid, err := http.Get(testServer.URL + "/api/v1/logs?min_level=loud")
+                require.NoError(t, err)
+                defer invalid.Body.Close()
+                assert.Equal(t, http.StatusBadRequest, invalid.StatusCode)
+        })
+
         t.Run("GetSources", func(t *testing.T) {
                 resp, err := http.Get(testServer.URL + "/api/v1/logs/sources")
                 require.NoError(t, err)
@@ -228,6 +254,54 @@ func TestAPIServer(t *testing.T) {
                 assert.Equal(t, int64(1), result.Frequency["error"])
         })
 
+        t.Run("ParseSamples", func(t *testing.T) {
+                parseRequest := map[string]interface{}{
+                        "lines": []string{
+                                `{"level":"WARNING","msg":"disk almost full","time":"2025-05-13T00:15:00Z"}`,
+                                `127.0.0.1 - - [13/May/2025:00:15:00 +0000] "GET /index.html HTTP/1.1" 200 512`,
+                                "no recognisable format",
+                        },
+                }
+                requestJSON, err := json.Marshal(parseRequest)
+                require.NoError(t, err)
+
+                resp, err := http.Post(testServer.URL+"/api/v1/parse", "application/json", bytes.NewBuffer(requestJSON))
+                require.NoError(t, err)
+                defer resp.Body.Close()
+
+                assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+                var result struct {
+                        Results []struct {
+                                Parser string          `json:"parser"`
+                                Entry  models.LogEntry `json:"entry"`
+                        } `json:"results"`
+                        Summary []struct {
+                                Parser string `json:"parser"`
+                                Lines  int    `json:"lines"`
+                        } `json:"summary"`
+                }
+                err = json.NewDecoder(resp.Body).Decode(&result)
+                require.NoError(t, err)
+
+                require.Len(t, result.Results, 3)
+                assert.Equal(t, "json_logrus", result.Results[0].Parser)
+                assert.Equal(t, "warn", result.Results[0].Entry.Level)
+                assert.Equal(t, "regex", result.Results[1].Parser)
+                assert.Equal(t, "apache", result.Results[1].Entry.Fields["pattern"])
+                assert.Empty(t, result.Results[2].Parser)
+                assert.Equal(t, true, result.Results[2].Entry.Fields[models.FieldTimestampUnparsed])
+                assert.Len(t, result.Summary, 3)
+
+                // Unknown parser names are rejected
+                requestJSON, err = json.Marshal(map[string]interface{}{"lines": []string{"x"}, "parser": "nope"})
+                require.NoError(t, err)
+                resp2, err := http.Post(testServer.URL+"/api/v1/parse", "application/json", bytes.NewBuffer(requestJSON))
+                require.NoError(t, err)
+                defer resp2.Body.Close()
+                assert.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+        })
+
         t.Run("HealthCheck", func(t *testing.T) {
                 resp, err := http.Get(testServer.URL + "/api/v1/health")
                 require.NoError(t, err)
@@ -273,3 +347,175 @@ func TestAPIServer(t *testing.T) {
                 assert.Contains(t, string(body), "logstream_")
         })
 }
+
+func TestAPIIngestBackpressure(t *testing.T) {
+        logger := hclog.New(&hclog.LoggerOptions{Output: io.Discard})
+        memStorage := storage.NewMemoryStorage()
+
+        // A pool nobody drains, holding one entry and refusing the rest
+        pool := worker.NewPool(1).WithQueueSize(1).WithOverflowPolicy(worker.OverflowReject)
+        server := api.NewServer("localhost", 0, memStorage, logger).
+                WithProcessor(processor.NewProcessor(memStorage, pool))
+        testServer := httptest.NewServer(server.Router)
+        defer testServer.Close()
+
+        post := func(path string, body interface{}) *http.Response {
+                data, err := json.Marshal(body)
+                require.NoError(t, err)
+                resp, err := http.Post(testServer.URL+path, "application/json", bytes.NewReader(data))
+                require.NoError(t, err)
+                return resp
+        }
+
+        resp := post("/api/v1/logs", models.LogEntry{Source: "app", Message: "accepted"})
+        resp.Body.Close()
+        assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+        resp = post("/api/v1/logs/batch", []models.LogEntry{{Source: "app", Message: "a"}, {Source: "app", Message: "b"}})
+        defer resp.Body.Close()
+        assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+        assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+        var result map[string]interface{}
+        require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+        assert.Equal(t, 0.0, result["accepted"])
+}
+
+// contextCheckingStorage refuses entries stored with a cancelled context
+type contextCheckingStorage struct {
+        *storage.MemoryStorage
+}
+
+func (c contextCheckingStorage) Store(ctx context.Context, entry *models.LogEntry) error {
+        if err := ctx.Err(); err != nil {
+                return err
+        }
+        return c.MemoryStorage.Store(ctx, entry)
+}
+
+func TestAPIIngestThroughPipeline(t *testing.T) {
+        logger := hclog.New(&hclog.LoggerOptions{Output: io.Discard})
+        load := func(t *testing.T, yaml string) *config.Config {
+                viper.Reset()
+                t.Cleanup(viper.Reset)
+                viper.SetConfigType("yaml")
+                require.NoError(t, viper.ReadConfig(strings.NewReader(yaml)))
+                cfg, err := config.Load()
+                require.NoError(t, err)
+                return cfg
+        }
+        post := func(t *testing.T, url string, body interface{}) *http.Response {
+                data, err := json.Marshal(body)
+                require.NoError(t, err)
+                resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+                require.NoError(t, err)
+                return resp
+        }
+
+        t.Run("OverCapacity", func(t *testing.T) {
+                // Built as the serve command does, with workers that haven't started
+                cfg := load(t, "collect:\n  workers: 1\n  queue-size: 1\n  overflow: reject\n")
+                store := storage.NewMemoryStorage()
+                pool, err := cfg.Collect.NewPool()
+                require.NoError(t, err)
+                pipeline, err := cfg.NewPipeline(store, pool, nil)
+                require.NoError(t, err)
+                defer pipeline.Close()
+                proc := pipeline.Processor
+                testServer := httptest.NewServer(api.NewServer("localhost", 0, store, logger).WithProcessor(proc).Router)
+                defer testServer.Close()
+
+                resp := post(t, testServer.URL+"/api/v1/logs", models.LogEntry{Source: "app", Message: "accepted"})
+                resp.Body.Close()
+                assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+                resp = post(t, testServer.URL+"/api/v1/logs", models.LogEntry{Source: "app", Message: "refused"})
+                resp.Body.Close()
+                assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+        })
+
+        t.Run("JobsOutliveRequests", func(t *testing.T) {
+                cfg := load(t, "collect:\n  workers: 1\n  batch-size: 1\n")
+                store := contextCheckingStorage{MemoryStorage: storage.NewMemoryStorage()}
+                pool, err := cfg.Collect.NewPool()
+                require.NoError(t, err)
+                pipeline, err := cfg.NewPipeline(store, pool, nil)
+                require.NoError(t, err)
+                defer pipeline.Close()
+                proc := pipeline.Processor
+                testServer := httptest.NewServer(api.NewServer("localhost", 0, store, logger).WithProcessor(proc).Router)
+                defer testServer.Close()
+
+                // The entries are queued before any worker runs, so they are processed after
+                // their requests ended
+                resp := post(t, testServer.URL+"/api/v1/logs/batch", []models.LogEntry{{Source: "app", Message: "a"}, {Source: "app", Message: "b"}})
+                resp.Body.Close()
+                assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+                ctx, cancel := context.WithCancel(context.Background())
+                defer cancel()
+                pool.Start(ctx)
+                pool.Stop(context.Background())
+                proc.Flush(context.Background())
+
+                stats, err := store.GetStats(context.Background())
+                require.NoError(t, err)
+                assert.Equal(t, int64(2), stats.TotalEntries)
+        })
+
+        t.Run("RedactsAndRoutes", func(t *testing.T) {
+                cfg := load(t, `
+collect:
+  workers: 1
+transform:
+  mask_fields:
+    - field: "*"
+      detectors: [credit_card]
+outputs:
+  - name: errors
+    type: memory
+routing:
+  routes:
+    - name: errors
+      filters:
+        - type: level
+          min-level: error
+      outputs: [errors]
+`)
+                store := storage.NewMemoryStorage()
+                pool, err := cfg.Collect.NewPool()
+                require.NoError(t, err)
+                pipeline, err := cfg.NewPipeline(store, pool, nil)
+                require.NoError(t, err)
+                defer pipeline.Close()
+                require.Len(t, pipeline.Routed, 1)
+                testServer := httptest.NewServer(api.NewServer("localhost", 0, store, logger).WithProcessor(pipeline.Processor).Router)
+                defer testServer.Close()
+
+                ctx, cancel := context.WithCancel(context.Background())
+                defer cancel()
+                pool.Start(ctx)
+
+                resp := post(t, testServer.URL+"/api/v1/logs", models.LogEntry{
+                        Source:  "checkout",
+                        Level:   "error",
+                        Message: "payment failed for card 4111 1111 1111 1111",
+                        Fields:  map[string]interface{}{"card": "4111-1111-1111-1111"},
+                })
+                resp.Body.Close()
+                require.Equal(t, http.StatusAccepted, resp.StatusCode)
+                pool.Stop(context.Background())
+                pipeline.Processor.Flush(context.Background())
+
+                // Posted entries take the configured routes, masked like collected ones
+                entries, err := pipeline.Routed[0].Query(context.Background(), models.NewQuery())
+                require.NoError(t, err)
+                require.Len(t, entries, 1)
+                assert.NotContains(t, entries[0].Message, "4111 1111 1111 1111")
+                assert.Contains(t, entries[0].Message, "payment failed for card")
+                assert.NotContains(t, entries[0].Fields["card"], "4111-1111-1111-1111")
+                stored, err := store.Query(context.Background(), models.NewQuery())
+                require.NoError(t, err)
+                assert.Empty(t, stored, "the route stops the entry")
+        })
+}
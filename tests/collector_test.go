@@ -142,6 +142,43 @@ func TestHTTPCollector(t *testing.T) {
         assert.Equal(t, "error", mockProc.entries[1].Level)
 }
 
+func TestHTTPCollectorUndatedEntries(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", "application/json")
+                w.Write([]byte(`[
+                        {"timestamp": "2023-05-01T12:00:00Z", "level": "info", "message": "dated"},
+                        {"level": "info", "message": "undated"}
+                ]`))
+        }))
+        defer server.Close()
+
+        memStorage := storage.NewMemoryStorage()
+        workerPool := worker.NewPool(1)
+        ctx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+        workerPool.Start(ctx)
+        proc := processor.NewProcessor(memStorage, workerPool)
+
+        httpCollector, err := collector.NewHTTPCollector(server.URL, proc)
+        require.NoError(t, err)
+        httpCollector.WithPollInterval(50 * time.Millisecond)
+        collectCtx, collectCancel := context.WithTimeout(ctx, 120*time.Millisecond)
+        defer collectCancel()
+        httpCollector.Start(collectCtx)
+        workerPool.Stop(context.Background())
+
+        logs, err := memStorage.Query(ctx, models.Query{Limit: 100})
+        require.NoError(t, err)
+        require.NotEmpty(t, logs)
+        for _, entry := range logs {
+                // Entries without an event time take the ingest time, flagged as such
+                assert.Equal(t, entry.Message == "dated", entry.TimestampParsed(), entry.Message)
+                if entry.Message == "undated" {
+                        assert.Equal(t, entry.IngestedAt, entry.Timestamp)
+                }
+        }
+}
+
 func TestCollectorFactory(t *testing.T) {
         // Create mock processor
         mockProc := &mockProcessor{
@@ -237,3 +274,68 @@ func TestCollectorConcurrency(t *testing.T) {
         // Should have at least 6 log entries (2 lines from each of 3 files)
         assert.GreaterOrEqual(t, len(logs), 6)
 }
+
+func TestFileCollectorBackpressure(t *testing.T) {
+        memStorage := storage.NewMemoryStorage()
+        // A tiny queue that refuses what doesn't fit, so the collector has to hold back and retry
+        workerPool := worker.NewPool(1).WithQueueSize(1).WithOverflowPolicy(worker.OverflowReject)
+        proc := processor.NewProcessor(memStorage, workerPool)
+
+        ctx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+        workerPool.Start(ctx)
+
+        logFile := filepath.Join(t.TempDir(), "busy.log")
+        lines := make([]byte, 0)
+        for i := 0; i < 50; i++ {
+                lines = append(lines, fmt.Sprintf("line %d\n", i)...)
+        }
+        require.NoError(t, os.WriteFile(logFile, lines, 0644))
+
+        fileCollector, err := collector.NewFileCollector(logFile, proc)
+        require.NoError(t, err)
+        done := make(chan error, 1)
+        go func() {
+                done <- fileCollector.Start(ctx)
+        }()
+
+        // Every line gets through despite the refusals
+        assert.Eventually(t, func() bool {
+                stats, _ := memStorage.GetStats(context.Background())
+                return stats.TotalEntries == 50
+        }, 5*time.Second, 20*time.Millisecond)
+
+        cancel()
+        assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// failingProcessor refuses every batch, counting the calls
+type failingProcessor struct {
+        mockProcessor
+        calls int
+}
+
+func (f *failingProcessor) Process(ctx context.Context, entries []*models.LogEntry) error {
+        f.calls++
+        return fmt.Errorf("storage unavailable")
+}
+
+func TestFileCollectorStopsOnFailure(t *testing.T) {
+        logFile := filepath.Join(t.TempDir(), "app.log")
+        lines := make([]byte, 0)
+        for i := 0; i < 250; i++ {
+                lines = append(lines, fmt.Sprintf("line %d\n", i)...)
+        }
+        require.NoError(t, os.WriteFile(logFile, lines, 0644))
+
+        proc := &failingProcessor{}
+        fileCollector, err := collector.NewFileCollector(logFile, proc)
+        require.NoError(t, err)
+
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        err = fileCollector.Start(ctx)
+        require.Error(t, err)
+        assert.Contains(t, err.Error(), "storage unavailable")
+        assert.Equal(t, 1, proc.calls, "the collector stops at the first failed batch")
+}
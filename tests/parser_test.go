@@ -0,0 +1,659 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mariasu11/logstreamApp/internal/config"
+	"github.com/mariasu11/logstreamApp/internal/processor"
+	"github.com/mariasu11/logstreamApp/internal/storage"
+	"github.com/mariasu11/logstreamApp/pkg/models"
+	"github.com/mariasu11/logstreamApp/pkg/parser"
+	"github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+// readFixtureLines reads all non-empty lines of a fixture file
+func readFixtureLines(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestCEFParser(t *testing.T) {
+	p := parser.NewCEFParser()
+
+	t.Run("HeaderAndExtension", func(t *testing.T) {
+		raw := `CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232 msg=Detected a \= sign in message cs1=line one\nline two`
+		require.True(t, p.CanParse(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "worm successfully stopped", entry.Message)
+		assert.Equal(t, "fatal", entry.Level)
+		assert.Equal(t, "Security", entry.Fields["device_vendor"])
+		assert.Equal(t, "threatmanager", entry.Fields["device_product"])
+		assert.Equal(t, "100", entry.Fields["signature_id"])
+		assert.Equal(t, "10", entry.Fields["severity"])
+		assert.Equal(t, "10.0.0.1", entry.Fields["src"])
+		assert.Equal(t, "1232", entry.Fields["spt"])
+		assert.Equal(t, "Detected a = sign in message", entry.Fields["msg"])
+		assert.Equal(t, "line one\nline two", entry.Fields["cs1"])
+	})
+
+	t.Run("EscapedHeaderPipe", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: `CEF:0|Vendor|Product|1.0|42|detected a \| in name|Medium|act=blocked`}
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "detected a | in name", entry.Message)
+		assert.Equal(t, "warn", entry.Level)
+		assert.Equal(t, "blocked", entry.Fields["act"])
+	})
+
+	t.Run("Timestamps", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: `CEF:0|V|P|1|1|n|1|rt=1747095300000 src=10.0.0.1`}
+		require.NoError(t, p.Parse(entry))
+		assert.True(t, entry.Timestamp.Equal(time.UnixMilli(1747095300000)))
+
+		entry = &models.LogEntry{RawData: `CEF:0|V|P|1|1|n|1|start=May 13 2025 00:36:40 UTC`}
+		require.NoError(t, p.Parse(entry))
+		assert.Equal(t, time.Date(2025, 5, 13, 0, 36, 40, 0, time.UTC), entry.Timestamp.UTC())
+	})
+
+	t.Run("SyslogPrefix", func(t *testing.T) {
+		raw := `May 13 00:36:41 fw01 CEF:0|Check Point|VPN-1|R81|Drop|drop|8|src=198.51.100.23`
+		require.True(t, p.CanParse(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, p.Parse(entry))
+		assert.Equal(t, "May 13 00:36:41 fw01", entry.Fields["syslog_header"])
+		assert.Equal(t, "error", entry.Level)
+	})
+
+	t.Run("Incomplete", func(t *testing.T) {
+		assert.False(t, p.CanParse("not a CEF line"))
+		assert.Error(t, p.Parse(&models.LogEntry{RawData: "CEF:0|Vendor|Product"}))
+	})
+
+	t.Run("Fixtures", func(t *testing.T) {
+		for _, line := range readFixtureLines(t, "../fixtures/logs/cef_events.log") {
+			require.True(t, p.CanParse(line), line)
+			entry := &models.LogEntry{RawData: line}
+			require.NoError(t, p.Parse(entry), line)
+			assert.NotEmpty(t, entry.Level, line)
+			assert.False(t, entry.Timestamp.IsZero(), line)
+		}
+	})
+}
+
+func TestLEEFParser(t *testing.T) {
+	p := parser.NewLEEFParser()
+
+	t.Run("Version1", func(t *testing.T) {
+		raw := "LEEF:1.0|IBM|QRadar|7.5.0|Login Failed|devTime=May 13 2025 00:20:11\tdevTimeFormat=MMM dd yyyy HH:mm:ss\tsrc=10.1.1.44\tsev=5"
+		require.True(t, p.CanParse(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "Login Failed", entry.Message)
+		assert.Equal(t, "warn", entry.Level)
+		assert.Equal(t, "IBM", entry.Fields["device_vendor"])
+		assert.Equal(t, "Login Failed", entry.Fields["event_id"])
+		assert.Equal(t, "10.1.1.44", entry.Fields["src"])
+		assert.Equal(t, time.Date(2025, 5, 13, 0, 20, 11, 0, time.UTC), entry.Timestamp)
+	})
+
+	t.Run("Version2CustomDelimiter", func(t *testing.T) {
+		raw := "LEEF:2.0|Cisco|ASA|9.16|106023|^|devTime=2025-05-13 00:42:05.118^devTimeFormat=yyyy-MM-dd HH:mm:ss.SSS^sev=7^msg=Deny tcp"
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "Deny tcp", entry.Message)
+		assert.Equal(t, "error", entry.Level)
+		assert.Equal(t, time.Date(2025, 5, 13, 0, 42, 5, 118000000, time.UTC), entry.Timestamp)
+	})
+
+	t.Run("Version2HexDelimiter", func(t *testing.T) {
+		raw := "LEEF:2.0|Trend Micro|DSA|20.0|4000012|x09|devTime=1747098333000\tsrc=192.0.2.15\tsev=9"
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "192.0.2.15", entry.Fields["src"])
+		assert.Equal(t, "fatal", entry.Level)
+		assert.True(t, entry.Timestamp.Equal(time.UnixMilli(1747098333000)))
+	})
+
+	t.Run("Fixtures", func(t *testing.T) {
+		for _, line := range readFixtureLines(t, "../fixtures/logs/leef_events.log") {
+			require.True(t, p.CanParse(line), line)
+			entry := &models.LogEntry{RawData: line}
+			require.NoError(t, p.Parse(entry), line)
+			assert.NotEmpty(t, entry.Level, line)
+			assert.False(t, entry.Timestamp.IsZero(), line)
+		}
+	})
+}
+
+func TestStructuredJSONDispatch(t *testing.T) {
+	registry := parser.NewParserRegistry()
+
+	// parserFor returns the name of the first registered parser claiming the line
+	parserFor := func(raw string) string {
+		for _, p := range registry.GetParsers() {
+			if p.CanParse(raw) {
+				return p.Name()
+			}
+		}
+		return ""
+	}
+
+	t.Run("HCLog", func(t *testing.T) {
+		// Generate a line with the same logger configuration as the logstream server
+		var buf bytes.Buffer
+		logger := hclog.New(&hclog.LoggerOptions{
+			Name:       "logstream",
+			Output:     &buf,
+			JSONFormat: true,
+		})
+		logger.Info("HTTP Request", "method", "GET", "status", 200)
+		raw := strings.TrimSpace(buf.String())
+
+		require.Equal(t, "json_hclog", parserFor(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, registry.ParseLogEntry(entry))
+		assert.Equal(t, "HTTP Request", entry.Message)
+		assert.Equal(t, "info", entry.Level)
+		assert.Equal(t, "logstream", entry.Source)
+		assert.Equal(t, "GET", entry.Fields["method"])
+		assert.NotContains(t, entry.Fields, "@level")
+		assert.NotContains(t, entry.Fields, "@message")
+		assert.False(t, entry.Timestamp.IsZero())
+	})
+
+	t.Run("Zap", func(t *testing.T) {
+		raw := `{"level":"error","ts":"2025-05-13T00:15:00.123Z","logger":"payments","caller":"server/handler.go:87","msg":"charge failed","order_id":"A-17","stacktrace":"main.charge\n\t/app/server/handler.go:87\n"}`
+		require.Equal(t, "json_zap", parserFor(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, registry.ParseLogEntry(entry))
+		assert.Equal(t, "charge failed", entry.Message)
+		assert.Equal(t, "payments", entry.Source)
+		assert.Equal(t, time.Date(2025, 5, 13, 0, 15, 0, 123000000, time.UTC), entry.Timestamp.UTC())
+		assert.Equal(t, "server/handler.go", entry.Fields["caller_file"])
+		assert.Equal(t, 87, entry.Fields["caller_line"])
+		assert.Equal(t, "main.charge\n\t/app/server/handler.go:87", entry.Fields["stacktrace"])
+
+		entry = &models.LogEntry{RawData: `{"level":"info","ts":1747095300.5,"msg":"started"}`}
+		require.NoError(t, registry.ParseLogEntry(entry))
+		assert.Equal(t, time.Unix(1747095300, 500000000), entry.Timestamp)
+	})
+
+	t.Run("Logrus", func(t *testing.T) {
+		raw := `{"level":"warning","msg":"disk almost full","time":"2025-05-13T00:30:00.123456789+02:00","mount":"/var"}`
+		require.Equal(t, "json_logrus", parserFor(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, registry.ParseLogEntry(entry))
+		assert.Equal(t, "warning", entry.Level)
+		assert.Equal(t, 123456789, entry.Timestamp.Nanosecond())
+		assert.Equal(t, "/var", entry.Fields["mount"])
+	})
+
+	t.Run("Slog", func(t *testing.T) {
+		raw := `{"time":"2025-05-13T00:45:00.5Z","level":"WARN+2","source":{"function":"main.run","file":"/app/main.go","line":42},"msg":"retrying","attempt":3}`
+		require.Equal(t, "json_slog", parserFor(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, registry.ParseLogEntry(entry))
+		assert.Equal(t, "retrying", entry.Message)
+		assert.Equal(t, "warn", entry.Level)
+		assert.Equal(t, "+2", entry.Fields["level_offset"])
+		assert.Equal(t, "/app/main.go:42", entry.Fields["caller"])
+		assert.Equal(t, "main.run", entry.Fields["function"])
+	})
+
+	t.Run("Bunyan", func(t *testing.T) {
+		raw := `{"name":"checkout","hostname":"web-1","pid":4016,"level":50,"msg":"payment gateway timeout","time":"2025-05-13T01:30:00.000Z","v":0}`
+		require.Equal(t, "json_bunyan", parserFor(raw))
+
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, registry.ParseLogEntry(entry))
+		assert.Equal(t, "error", entry.Level)
+		assert.Equal(t, "checkout", entry.Source)
+		assert.Equal(t, "web-1", entry.Fields["hostname"])
+		assert.NotContains(t, entry.Fields, "v")
+	})
+
+	t.Run("GenericFallback", func(t *testing.T) {
+		raw := `{"timestamp":"2025-05-13T00:15:00Z","level":"error","message":"Connection timeout"}`
+		assert.Equal(t, "json", parserFor(raw))
+	})
+}
+
+func TestJSONParserFlatten(t *testing.T) {
+	raw := `{"message":"request served","http":{"request":{"method":"GET","headers":{"accept":"*/*"}},"status":200},"tags":["api","v2"],"spans":[{"id":"a"},{"id":"b"}]}`
+
+	t.Run("DefaultKeepsNestedObjects", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: raw}
+		require.NoError(t, parser.NewJSONParser().Parse(entry))
+		assert.IsType(t, map[string]interface{}{}, entry.Fields["http"])
+		assert.NotContains(t, entry.Fields, "http.request.method")
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: raw}
+		p := parser.NewJSONParser().WithFlatten(0, parser.ArrayModeIndex)
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "GET", entry.Fields["http.request.method"])
+		assert.Equal(t, "*/*", entry.Fields["http.request.headers.accept"])
+		assert.Equal(t, float64(200), entry.Fields["http.status"])
+		assert.Equal(t, "api", entry.Fields["tags.0"])
+		assert.Equal(t, "b", entry.Fields["spans.1.id"])
+		assert.NotContains(t, entry.Fields, "http")
+
+		// Flattened keys are reachable by the field filter
+		assert.True(t, processor.NewFieldFilter("http.request.method", "GET", true).Apply(entry))
+	})
+
+	t.Run("MaxDepth", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: raw}
+		p := parser.NewJSONParser().WithFlatten(2, parser.ArrayModeKeep)
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "GET", entry.Fields["http.request.method"])
+		assert.Equal(t, map[string]interface{}{"accept": "*/*"}, entry.Fields["http.request.headers"])
+		assert.Equal(t, []interface{}{"api", "v2"}, entry.Fields["tags"])
+	})
+
+	t.Run("JoinArrays", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: raw}
+		p := parser.NewJSONParser().WithFlatten(0, parser.ArrayModeJoin)
+		require.NoError(t, p.Parse(entry))
+
+		assert.Equal(t, "api,v2", entry.Fields["tags"])
+		assert.Equal(t, `{"id":"a"},{"id":"b"}`, entry.Fields["spans"])
+	})
+
+	t.Run("InvalidArrayMode", func(t *testing.T) {
+		_, err := parser.ParseArrayMode("explode")
+		assert.Error(t, err)
+	})
+}
+
+func TestJSONParserFieldMapping(t *testing.T) {
+	// Elastic Common Schema style document
+	raw := `{"@timestamp":"2025-05-13T00:15:00Z","log":{"level":"error","logger":"auth"},"event":{"original":"login failed for bob","dataset":"auth.log"},"service":{"name":"sso"},"user":"bob"}`
+
+	p := parser.NewJSONParser().WithFieldMapping(parser.JSONFieldMapping{
+		Level:   []string{"log.level"},
+		Message: []string{"event.original", "message"},
+		Source:  []string{"service.name"},
+	})
+
+	entry := &models.LogEntry{RawData: raw}
+	require.NoError(t, p.Parse(entry))
+
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, "login failed for bob", entry.Message)
+	assert.Equal(t, "sso", entry.Source)
+	assert.Equal(t, time.Date(2025, 5, 13, 0, 15, 0, 0, time.UTC), entry.Timestamp)
+	assert.Equal(t, "bob", entry.Fields["user"])
+
+	// Mapped values are removed from the remaining fields, and emptied parents pruned
+	assert.Equal(t, map[string]interface{}{"logger": "auth"}, entry.Fields["log"])
+	assert.Equal(t, map[string]interface{}{"dataset": "auth.log"}, entry.Fields["event"])
+	assert.NotContains(t, entry.Fields, "service")
+}
+
+func TestStructuredJSONOptions(t *testing.T) {
+	parse := func(t *testing.T, options parser.JSONOptions, raw string) (*models.LogEntry, string) {
+		entry := &models.LogEntry{RawData: raw}
+		for _, p := range parser.NewDefaultParsers(parser.NewTimestampParser(), options) {
+			if p.CanParse(raw) {
+				require.NoError(t, p.Parse(entry))
+				return entry, p.Name()
+			}
+		}
+		t.Fatalf("no parser for %s", raw)
+		return nil, ""
+	}
+
+	t.Run("FlattenLogrus", func(t *testing.T) {
+		raw := `{"level":"info","msg":"request served","time":"2025-05-13T00:15:00Z","http":{"request":{"method":"GET"},"status":200},"tags":["api","v2"]}`
+		entry, name := parse(t, parser.JSONOptions{Flatten: true, ArrayMode: parser.ArrayModeJoin}, raw)
+		assert.Equal(t, "json_logrus", name)
+		assert.Equal(t, "request served", entry.Message)
+		assert.Equal(t, "GET", entry.Fields["http.request.method"])
+		assert.Equal(t, float64(200), entry.Fields["http.status"])
+		assert.Equal(t, "api,v2", entry.Fields["tags"])
+		assert.NotContains(t, entry.Fields, "http")
+		assert.True(t, processor.NewFieldFilter("http.request.method", "GET", true).Apply(entry))
+	})
+
+	t.Run("FlattenZapWithMaxDepth", func(t *testing.T) {
+		raw := `{"level":"warn","ts":1747095300.5,"msg":"slow","caller":"api/handler.go:42","http":{"request":{"headers":{"accept":"*/*"}}}}`
+		entry, name := parse(t, parser.JSONOptions{Flatten: true, MaxDepth: 2}, raw)
+		assert.Equal(t, "json_zap", name)
+		assert.Equal(t, 42, entry.Fields["caller_line"])
+		assert.Equal(t, map[string]interface{}{"accept": "*/*"}, entry.Fields["http.request.headers"])
+	})
+
+	t.Run("MappingOverridesFormatKeys", func(t *testing.T) {
+		raw := `{"level":"info","msg":"wrapped","time":"2025-05-13T00:15:00Z","log":{"level":"error"},"event":{"original":"login failed for bob"}}`
+		entry, name := parse(t, parser.JSONOptions{Mapping: parser.JSONFieldMapping{
+			Level:   []string{"log.level"},
+			Message: []string{"event.original"},
+		}}, raw)
+		assert.Equal(t, "json_logrus", name)
+		assert.Equal(t, "error", entry.Level)
+		assert.Equal(t, "login failed for bob", entry.Message)
+		assert.NotContains(t, entry.Fields, "log")
+		assert.NotContains(t, entry.Fields, "event")
+	})
+
+	t.Run("DefaultKeepsNestedObjects", func(t *testing.T) {
+		raw := `{"level":"info","msg":"request served","time":"2025-05-13T00:15:00Z","http":{"request":{"method":"GET"}}}`
+		entry, _ := parse(t, parser.JSONOptions{}, raw)
+		assert.IsType(t, map[string]interface{}{}, entry.Fields["http"])
+		assert.Equal(t, "info", entry.Level)
+	})
+}
+
+func TestJSONParsingConfig(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+json:
+  flatten: true
+  arrays: join
+  fields:
+    level: [log.level]
+`)))
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	store := storage.NewMemoryStorage()
+	pool := worker.NewPool(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx)
+	proc, err := cfg.NewProcessor(store, pool, nil)
+	require.NoError(t, err)
+
+	line := `{"log":{"level":"warn"},"msg":"slow request","http":{"request":{"method":"GET"}},"tags":["a","b"]}`
+	require.NoError(t, proc.Process(ctx, []*models.LogEntry{{Source: "app", RawData: line}}))
+	pool.Stop(context.Background())
+	proc.Flush(context.Background())
+
+	results, err := store.Query(ctx, models.NewQuery())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "warn", results[0].Level)
+	assert.Equal(t, "slow request", results[0].Message)
+	assert.Equal(t, "GET", results[0].Fields["http.request.method"])
+	assert.Equal(t, "a,b", results[0].Fields["tags"])
+
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader("json:\n  arrays: explode\n")))
+	_, err = config.Load()
+	assert.Error(t, err)
+}
+
+func TestLevelNormalization(t *testing.T) {
+	normalizer := models.NewLevelNormalizer()
+
+	t.Run("Aliases", func(t *testing.T) {
+		cases := map[string]models.Level{
+			"INFO":    models.LevelInfo,
+			"info":    models.LevelInfo,
+			"I":       models.LevelInfo,
+			"Warning": models.LevelWarn,
+			"WARN":    models.LevelWarn,
+			"crit":    models.LevelFatal,
+			"E":       models.LevelError,
+			"30":      models.LevelInfo,  // bunyan
+			"3":       models.LevelError, // syslog
+			"14":      models.LevelWarn,  // OTel WARN2
+		}
+		for raw, expected := range cases {
+			level, ok := normalizer.Normalize(raw)
+			require.True(t, ok, raw)
+			assert.Equal(t, expected, level, raw)
+		}
+
+		_, ok := normalizer.Normalize("banana")
+		assert.False(t, ok)
+	})
+
+	t.Run("ConfiguredAliasesAndScheme", func(t *testing.T) {
+		custom, err := models.NewLevelNormalizer().WithAliases(map[string]string{"sev1": "fatal"})
+		require.NoError(t, err)
+		custom, err = custom.WithNumericScheme(models.NumericSchemeOTel)
+		require.NoError(t, err)
+
+		level, ok := custom.Normalize("SEV1")
+		require.True(t, ok)
+		assert.Equal(t, models.LevelFatal, level)
+
+		// With the OTel scheme, 3 is TRACE3 rather than a syslog error
+		level, ok = custom.Normalize("3")
+		require.True(t, ok)
+		assert.Equal(t, models.LevelTrace, level)
+
+		_, err = models.NewLevelNormalizer().WithAliases(map[string]string{"x": "loud"})
+		assert.Error(t, err)
+	})
+
+	t.Run("EntryKeepsRawValue", func(t *testing.T) {
+		entry := &models.LogEntry{Level: "Warning"}
+		normalizer.NormalizeEntry(entry)
+
+		assert.Equal(t, "warn", entry.Level)
+		assert.Equal(t, "Warning", entry.Fields["level_raw"])
+		assert.Equal(t, int(models.LevelWarn), entry.Fields["severity_number"])
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		warnFilter := processor.NewLevelFilter([]string{"WARNING"}, true)
+		assert.True(t, warnFilter.Apply(&models.LogEntry{Level: "warn"}))
+		assert.True(t, warnFilter.Apply(&models.LogEntry{Level: "W"}))
+		assert.False(t, warnFilter.Apply(&models.LogEntry{Level: "error"}))
+
+		minFilter, err := processor.NewMinLevelFilter("warn")
+		require.NoError(t, err)
+		assert.True(t, minFilter.Apply(&models.LogEntry{Level: "ERROR"}))
+		assert.True(t, minFilter.Apply(&models.LogEntry{Level: "warning"}))
+		assert.False(t, minFilter.Apply(&models.LogEntry{Level: "info"}))
+		assert.False(t, minFilter.Apply(&models.LogEntry{Level: ""}))
+	})
+
+	t.Run("MinLevelQuery", func(t *testing.T) {
+		store := storage.NewMemoryStorage()
+		ctx := context.Background()
+		for _, level := range []string{"debug", "info", "warn", "error", "fatal"} {
+			require.NoError(t, store.Store(ctx, &models.LogEntry{Timestamp: time.Now(), Level: level, Message: level}))
+		}
+
+		results, err := store.Query(ctx, models.NewQuery().WithMinLevel("warn"))
+		require.NoError(t, err)
+		assert.Len(t, results, 3)
+
+		results, err = store.Query(ctx, models.NewQuery().WithLevels("WARNING"))
+		require.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+}
+
+func TestTimestampParser(t *testing.T) {
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	p := parser.NewTimestampParser().
+		WithClock(func() time.Time { return now }).
+		WithSourceLocation("berlin", berlin)
+
+	t.Run("Layouts", func(t *testing.T) {
+		cases := map[string]time.Time{
+			"2026-01-05T10:30:00.123Z":        time.Date(2026, 1, 5, 10, 30, 0, 123000000, time.UTC),
+			"2026-01-05 10:30:00,250":         time.Date(2026, 1, 5, 10, 30, 0, 250000000, time.UTC),
+			"05/Jan/2026:10:30:00 +0100":      time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC),
+			"Mon Jan  5 10:30:00 2026":        time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC),
+			"1767609000":                      time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC),
+			"1767609000123":                   time.Date(2026, 1, 5, 10, 30, 0, 123000000, time.UTC),
+			"1767609000123456":                time.Date(2026, 1, 5, 10, 30, 0, 123456000, time.UTC),
+			"1767609000123456789":             time.Date(2026, 1, 5, 10, 30, 0, 123456789, time.UTC),
+			"Mon, 05 Jan 2026 10:30:00 -0000": time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC),
+			"2026-01-05 10:30:00.5 +0000 UTC": time.Date(2026, 1, 5, 10, 30, 0, 500000000, time.UTC),
+		}
+		for raw, expected := range cases {
+			ts, err := p.Parse(raw, "")
+			require.NoError(t, err, raw)
+			assert.True(t, expected.Equal(ts), "%s: got %s", raw, ts)
+		}
+
+		ts, err := p.Parse(1767609000.5, "")
+		require.NoError(t, err)
+		assert.True(t, time.Date(2026, 1, 5, 10, 30, 0, 500000000, time.UTC).Equal(ts))
+	})
+
+	t.Run("SyslogYearInference", func(t *testing.T) {
+		ts, err := p.Parse("Jan  5 10:30:00", "")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC), ts)
+
+		// December lines read in early January belong to the previous year
+		ts, err = p.Parse("Dec 31 23:59:59", "")
+		require.NoError(t, err)
+		assert.Equal(t, 2025, ts.Year())
+	})
+
+	t.Run("SourceTimezone", func(t *testing.T) {
+		ts, err := p.Parse("2026-01-05 10:30:00", "berlin")
+		require.NoError(t, err)
+		assert.True(t, time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC).Equal(ts))
+
+		// Explicit zones win over the source default
+		ts, err = p.Parse("2026-01-05T10:30:00Z", "berlin")
+		require.NoError(t, err)
+		assert.True(t, time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC).Equal(ts))
+	})
+
+	t.Run("ClockSkew", func(t *testing.T) {
+		_, err := p.Parse("2026-01-09T00:00:00Z", "")
+		assert.ErrorIs(t, err, parser.ErrTimestampOutOfRange)
+
+		_, err = p.Parse("1999-01-01T00:00:00Z", "")
+		assert.ErrorIs(t, err, parser.ErrTimestampOutOfRange)
+
+		// Seconds mistaken for a tiny epoch value land in 1970
+		_, err = p.Parse(float64(86400), "")
+		assert.ErrorIs(t, err, parser.ErrTimestampOutOfRange)
+
+		_, err = p.Parse("not a time", "")
+		assert.ErrorIs(t, err, parser.ErrUnknownTimestampFormat)
+	})
+
+	t.Run("JSONParserFlagsBadTimestamp", func(t *testing.T) {
+		entry := &models.LogEntry{
+			RawData:    `{"timestamp":"yesterday-ish","level":"info","message":"hello"}`,
+			Timestamp:  now,
+			IngestedAt: now,
+		}
+		require.NoError(t, parser.NewJSONParser().WithTimestampParser(p).Parse(entry))
+
+		assert.Equal(t, now, entry.Timestamp)
+		assert.False(t, entry.TimestampParsed())
+		assert.Equal(t, "yesterday-ish", entry.Fields[models.FieldTimestampRaw])
+	})
+
+	t.Run("RegexParserCompletesYear", func(t *testing.T) {
+		entry := &models.LogEntry{RawData: "[Jan 05 10:30:00] [INFO] started"}
+		require.NoError(t, parser.NewRegexParser().WithTimestampParser(p).Parse(entry))
+
+		assert.Equal(t, time.Date(2026, 1, 5, 10, 30, 0, 0, time.UTC), entry.Timestamp)
+		assert.True(t, entry.TimestampParsed())
+	})
+}
+
+func TestParseSample(t *testing.T) {
+	parsers := parser.DefaultParsers()
+
+	t.Run("ReportsFirstSuccessfulParser", func(t *testing.T) {
+		result := parser.ParseSample(parsers, "app", `{"@level":"info","@message":"ready","@timestamp":"2025-05-13T00:15:00.000000Z"}`)
+
+		assert.Equal(t, "json_hclog", result.Parser)
+		require.Len(t, result.Attempts, 1)
+		assert.Empty(t, result.Attempts[0].Error)
+		assert.Equal(t, "ready", result.Entry.Message)
+		assert.Equal(t, "app", result.Entry.Source)
+		assert.True(t, result.Entry.TimestampParsed())
+	})
+
+	t.Run("RecordsParseErrors", func(t *testing.T) {
+		result := parser.ParseSample(parsers, "", `{"level":"info", broken`)
+
+		assert.Empty(t, result.Parser)
+		require.NotEmpty(t, result.Attempts)
+		assert.Equal(t, "json", result.Attempts[0].Parser)
+		assert.NotEmpty(t, result.Attempts[0].Error)
+		assert.False(t, result.Entry.TimestampParsed())
+	})
+
+	t.Run("SelectsParserOrRule", func(t *testing.T) {
+		selected, err := parser.SelectParsers(parsers, "json_zap")
+		require.NoError(t, err)
+		require.Len(t, selected, 1)
+		assert.Equal(t, "json_zap", selected[0].Name())
+
+		selected, err = parser.SelectParsers(parsers, "common")
+		require.NoError(t, err)
+		require.Len(t, selected, 1)
+		assert.Equal(t, []string{"common"}, selected[0].(*parser.RegexParser).PatternNames())
+
+		// The apache rule does not match lines in the common format
+		result := parser.ParseSample(selected, "", `127.0.0.1 - - [13/May/2025:00:15:00 +0000] "GET / HTTP/1.1" 200 5`)
+		assert.Empty(t, result.Parser)
+
+		_, err = parser.SelectParsers(parsers, "missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		results := []*parser.SampleResult{
+			parser.ParseSample(parsers, "", `{"msg":"a","level":"info","time":"2025-05-13T00:15:00Z"}`),
+			parser.ParseSample(parsers, "", `{"msg":"b","level":"info","time":"2025-05-13T00:15:01Z"}`),
+			parser.ParseSample(parsers, "", "plain text"),
+		}
+
+		assert.Equal(t, []parser.SampleMatch{
+			{Parser: "json_logrus", Lines: 2},
+			{Parser: parser.UnparsedSample, Lines: 1},
+		}, parser.SummarizeSamples(results))
+	})
+}
@@ -1,16 +1,29 @@
 package tests
 
 import (
+        "context"
+        "errors"
         "fmt"
         "io"
+        "strings"
+        "sync"
         "testing"
+        "time"
 
+        "github.com/prometheus/client_golang/prometheus/testutil"
+        "github.com/spf13/viper"
         "github.com/stretchr/testify/assert"
         "github.com/stretchr/testify/require"
         "github.com/hashicorp/go-hclog"
 
+        "github.com/mariasu11/logstreamApp/internal/collector"
+        "github.com/mariasu11/logstreamApp/internal/config"
+        "github.com/mariasu11/logstreamApp/internal/metrics"
+        "github.com/mariasu11/logstreamApp/internal/processor"
+        "github.com/mariasu11/logstreamApp/internal/storage"
         "github.com/mariasu11/logstreamApp/pkg/models"
         "github.com/mariasu11/logstreamApp/pkg/plugin"
+        "github.com/mariasu11/logstreamApp/pkg/worker"
 )
 
 // MockPlugin is a test implementation of the Plugin interface
@@ -199,3 +212,292 @@ func TestBasePlugin(t *testing.T) {
         err = basePlugin.Close()
         require.NoError(t, err)
 }
+
+// mockOutputPlugin records the batches it is given, refusing the first failures of them
+type mockOutputPlugin struct {
+        plugin.BasePlugin
+        mu       sync.Mutex
+        batches  [][]string
+        failures int
+}
+
+func newMockOutputPlugin(name string, failures int) *mockOutputPlugin {
+        return &mockOutputPlugin{
+                BasePlugin: plugin.NewBasePlugin(plugin.PluginInfo{Name: name, Version: "1.0.0"}),
+                failures:   failures,
+        }
+}
+
+func (p *mockOutputPlugin) ProcessLogEntry(entry *models.LogEntry) error {
+        return nil
+}
+
+func (p *mockOutputPlugin) Output(entries []*models.LogEntry) error {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        if p.failures > 0 {
+                p.failures--
+                return errors.New("output unavailable")
+        }
+        messages := make([]string, len(entries))
+        for i, entry := range entries {
+                messages[i] = entry.Message
+        }
+        p.batches = append(p.batches, messages)
+        return nil
+}
+
+func (p *mockOutputPlugin) sent() [][]string {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        return append([][]string(nil), p.batches...)
+}
+
+// blockingOutputPlugin blocks in Output until released
+type blockingOutputPlugin struct {
+        *mockOutputPlugin
+        release chan struct{}
+}
+
+func (p *blockingOutputPlugin) Output(entries []*models.LogEntry) error {
+        <-p.release
+        return p.mockOutputPlugin.Output(entries)
+}
+
+// mockInputPlugin hands the entries it is given to the pipeline once started
+type mockInputPlugin struct {
+        plugin.BasePlugin
+        emit    plugin.EmitFunc
+        entries []*models.LogEntry
+        stopped chan struct{}
+}
+
+func (p *mockInputPlugin) ProcessLogEntry(entry *models.LogEntry) error {
+        return nil
+}
+
+func (p *mockInputPlugin) SetEmitter(emit plugin.EmitFunc) {
+        p.emit = emit
+}
+
+func (p *mockInputPlugin) Start() error {
+        go p.emit(p.entries)
+        return nil
+}
+
+func (p *mockInputPlugin) Stop() error {
+        close(p.stopped)
+        return nil
+}
+
+func TestPluginOutputs(t *testing.T) {
+        m := metrics.GetMetrics()
+        entries := func(messages ...string) []*models.LogEntry {
+                batch := make([]*models.LogEntry, len(messages))
+                for i, message := range messages {
+                        batch[i] = models.NewLogEntry("app", message)
+                }
+                return batch
+        }
+
+        t.Run("BatchesAndRetries", func(t *testing.T) {
+                output := newMockOutputPlugin("retrying-output", 2)
+                errorsBefore := testutil.ToFloat64(m.PluginErrors.WithLabelValues("retrying-output", "output"))
+                sentBefore := testutil.ToFloat64(m.PluginOutputEntries.WithLabelValues("retrying-output", "sent"))
+
+                ctx, cancel := context.WithCancel(context.Background())
+                defer cancel()
+                pool := worker.NewPool(1)
+                pool.Start(ctx)
+                store := storage.NewMemoryStorage()
+                proc := processor.NewLogProcessor(store, pool).
+                        AddOutput(processor.NewPluginOutput(output, 2, time.Hour).WithRetry(3, time.Millisecond))
+
+                require.NoError(t, proc.Process(ctx, entries("a", "b", "c")))
+                pool.Stop(context.Background())
+                proc.Flush(context.Background())
+
+                assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, output.sent())
+                assert.Equal(t, errorsBefore+2, testutil.ToFloat64(m.PluginErrors.WithLabelValues("retrying-output", "output")))
+                assert.Equal(t, sentBefore+3, testutil.ToFloat64(m.PluginOutputEntries.WithLabelValues("retrying-output", "sent")))
+
+                // Outputs don't replace the storage
+                stats, _ := store.GetStats(context.Background())
+                assert.Equal(t, int64(3), stats.TotalEntries)
+        })
+
+        t.Run("DropsRefusedBatches", func(t *testing.T) {
+                output := newMockOutputPlugin("failing-output", 10)
+                o := processor.NewPluginOutput(output, 2, 0).WithRetry(1, time.Millisecond)
+                droppedBefore := testutil.ToFloat64(m.PluginOutputEntries.WithLabelValues("failing-output", "dropped"))
+                errorsBefore := testutil.ToFloat64(m.PluginErrors.WithLabelValues("failing-output", "output"))
+
+                for _, entry := range entries("a", "b", "c") {
+                        require.NoError(t, o.Add(context.Background(), entry))
+                }
+                require.NoError(t, o.Close(context.Background()))
+
+                assert.Empty(t, output.sent())
+                assert.Equal(t, droppedBefore+3, testutil.ToFloat64(m.PluginOutputEntries.WithLabelValues("failing-output", "dropped")))
+                assert.Equal(t, errorsBefore+4, testutil.ToFloat64(m.PluginErrors.WithLabelValues("failing-output", "output")))
+        })
+
+        t.Run("BlockingPluginDoesntHoldWorkers", func(t *testing.T) {
+                output := &blockingOutputPlugin{
+                        mockOutputPlugin: newMockOutputPlugin("blocking-output", 0),
+                        release:          make(chan struct{}),
+                }
+                overflowBefore := testutil.ToFloat64(m.PluginOutputEntries.WithLabelValues("blocking-output", "overflow"))
+
+                ctx, cancel := context.WithCancel(context.Background())
+                defer cancel()
+                pool := worker.NewPool(2)
+                pool.Start(ctx)
+                store := storage.NewMemoryStorage()
+                proc := processor.NewLogProcessor(store, pool).
+                        AddOutput(processor.NewPluginOutput(output, 1, 0).WithBufferSize(5))
+
+                messages := make([]string, 20)
+                for i := range messages {
+                        messages[i] = fmt.Sprintf("entry %d", i)
+                }
+                require.NoError(t, proc.Process(ctx, entries(messages...)))
+                assert.Eventually(t, func() bool {
+                        stats, _ := store.GetStats(context.Background())
+                        return stats.TotalEntries == 20
+                }, 2*time.Second, 5*time.Millisecond, "the workers store entries while the plugin blocks")
+                assert.Greater(t, testutil.ToFloat64(m.PluginOutputEntries.WithLabelValues("blocking-output", "overflow")), overflowBefore)
+
+                close(output.release)
+                pool.Stop(context.Background())
+                proc.Flush(context.Background())
+                sent := output.sent()
+                assert.NotEmpty(t, sent)
+                assert.LessOrEqual(t, len(sent), 7, "one batch in the plugin, five buffered and one being batched")
+        })
+
+        t.Run("Config", func(t *testing.T) {
+                viper.Reset()
+                defer viper.Reset()
+                viper.SetConfigType("yaml")
+                require.NoError(t, viper.ReadConfig(strings.NewReader(`
+plugins:
+  config:
+    endpoint: http://collector
+  output:
+    batch-size: 2
+    flush-interval: 1h
+`)))
+                cfg, err := config.Load()
+                require.NoError(t, err)
+                assert.Equal(t, processor.DefaultOutputRetries, cfg.Plugins.Output.Retries)
+
+                registry := plugin.NewRegistry(hclog.NewNullLogger())
+                output := newMockOutputPlugin("config-output", 0)
+                require.NoError(t, registry.RegisterPlugin(output))
+                require.NoError(t, registry.RegisterPlugin(NewMockPlugin()))
+
+                proc, err := cfg.NewProcessor(storage.NewMemoryStorage(), nil, registry)
+                require.NoError(t, err)
+                assert.Equal(t, "http://collector", output.GetConfig("endpoint"))
+                proc.Flush(context.Background())
+        })
+}
+
+func TestPluginErrorPolicy(t *testing.T) {
+        m := metrics.GetMetrics()
+        run := func(t *testing.T, policy processor.PluginErrorPolicy) int64 {
+                failing := NewMockPlugin()
+                failing.shouldError = true
+
+                ctx, cancel := context.WithCancel(context.Background())
+                defer cancel()
+                pool := worker.NewPool(1)
+                pool.Start(ctx)
+                store := storage.NewMemoryStorage()
+                proc := processor.NewLogProcessor(store, pool).WithPluginErrorPolicy(policy)
+                proc.AddPlugin(failing)
+
+                require.NoError(t, proc.Process(ctx, []*models.LogEntry{models.NewLogEntry("app", "entry")}))
+                pool.Stop(context.Background())
+                proc.Flush(context.Background())
+
+                stats, _ := store.GetStats(context.Background())
+                return stats.TotalEntries
+        }
+
+        errorsBefore := testutil.ToFloat64(m.PluginErrors.WithLabelValues("mock", "process"))
+        assert.Equal(t, int64(1), run(t, processor.PluginErrorIgnore))
+
+        filteredBefore := testutil.ToFloat64(m.LogEntriesFiltered)
+        assert.Equal(t, int64(0), run(t, processor.PluginErrorDrop))
+        assert.Equal(t, filteredBefore+1, testutil.ToFloat64(m.LogEntriesFiltered))
+
+        erroredBefore := testutil.ToFloat64(m.LogEntriesErrored)
+        assert.Equal(t, int64(0), run(t, processor.PluginErrorFail))
+        assert.Equal(t, erroredBefore+1, testutil.ToFloat64(m.LogEntriesErrored))
+
+        assert.Equal(t, errorsBefore+3, testutil.ToFloat64(m.PluginErrors.WithLabelValues("mock", "process")))
+
+        _, err := processor.ParsePluginErrorPolicy("retry")
+        assert.Error(t, err)
+
+        viper.Reset()
+        defer viper.Reset()
+        viper.SetConfigType("yaml")
+        require.NoError(t, viper.ReadConfig(strings.NewReader("plugins:\n  on-error: retry\n")))
+        _, err = config.Load()
+        assert.Error(t, err)
+}
+
+func TestPluginCollector(t *testing.T) {
+        input := &mockInputPlugin{
+                BasePlugin: plugin.NewBasePlugin(plugin.PluginInfo{Name: "events", Version: "1.0.0"}),
+                entries: []*models.LogEntry{
+                        models.NewLogEntry("", "from the plugin"),
+                        models.NewLogEntry("custom", "with its own source"),
+                },
+                stopped: make(chan struct{}),
+        }
+        proc := &syncProcessor{}
+        coll := collector.NewPluginCollector(input, proc)
+        assert.Equal(t, "plugin://events", coll.Source())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error, 1)
+        go func() { done <- coll.Start(ctx) }()
+
+        assert.Eventually(t, func() bool {
+                return len(proc.received()) == 2
+        }, time.Second, 5*time.Millisecond)
+        received := proc.received()
+        assert.Equal(t, "plugin://events", received[0].Source)
+        assert.Equal(t, "custom", received[1].Source)
+
+        // The plugin stops with the collector
+        cancel()
+        assert.ErrorIs(t, <-done, context.Canceled)
+        select {
+        case <-input.stopped:
+        default:
+                t.Fatal("input plugin was not stopped")
+        }
+}
+
+// syncProcessor records the entries it is given, safe for concurrent use
+type syncProcessor struct {
+        mockProcessor
+        mu sync.Mutex
+}
+
+func (s *syncProcessor) Process(ctx context.Context, entries []*models.LogEntry) error {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        return s.mockProcessor.Process(ctx, entries)
+}
+
+func (s *syncProcessor) received() []*models.LogEntry {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        return append([]*models.LogEntry(nil), s.entries...)
+}
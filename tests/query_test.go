@@ -296,6 +296,40 @@ func TestQueryEngineAnalyze(t *testing.T) {
         })
 }
 
+
+func TestQueryEngineAnalyzeSampled(t *testing.T) {
+        now := time.Now()
+        entries := []*models.LogEntry{
+                {Timestamp: now, Source: "app1", Level: "info", Message: "request 1", Fields: map[string]interface{}{models.FieldSampleRate: 0.1}},
+                {Timestamp: now, Source: "app1", Level: "info", Message: "request 2", Fields: map[string]interface{}{models.FieldSampleRate: 0.25}},
+                {Timestamp: now, Source: "app2", Level: "error", Message: "failure"},
+        }
+        mockStorage := new(MockStorage)
+        mockStorage.On("Query", mock.Anything, mock.AnythingOfType("models.Query")).Return(entries, nil)
+        engine := query.NewEngine(mockStorage)
+
+        result, err := engine.Analyze(models.Analysis{Type: models.AnalysisTypeCount})
+        require.NoError(t, err)
+        assert.Equal(t, int64(15), result.Count)
+        assert.True(t, result.Estimated)
+
+        result, err = engine.Analyze(models.Analysis{Type: models.AnalysisTypeFrequency, GroupBy: "level"})
+        require.NoError(t, err)
+        assert.Equal(t, map[string]int64{"info": 14, "error": 1}, result.Frequency)
+
+        result, err = engine.Analyze(models.Analysis{Type: models.AnalysisTypePatterns, PatternConfig: models.PatternConfig{ReplaceNumbers: true}})
+        require.NoError(t, err)
+        for _, pattern := range result.Patterns {
+                if pattern.Pattern == "request {number}" {
+                        assert.Equal(t, 14, pattern.Count)
+                }
+        }
+
+        result, err = engine.Analyze(models.Analysis{Type: models.AnalysisTypeCount, Unweighted: true})
+        require.NoError(t, err)
+        assert.Equal(t, int64(3), result.Count)
+        assert.False(t, result.Estimated)
+}
 func TestParseQuery(t *testing.T) {
         // Create mock storage
         mockStorage := new(MockStorage)
@@ -366,6 +400,41 @@ func TestParseQuery(t *testing.T) {
                                 Limit:   100,
                         },
                 },
+                {
+                        name:        "Minimum Level",
+                        queryString: "level>=warn timeout",
+                        expected: models.Query{
+                                MinLevel: "warn",
+                                Filter:   "timeout",
+                                Limit:    100,
+                        },
+                },
+                {
+                        name:        "Minimum Level With Spaces",
+                        queryString: "level >= warn timeout",
+                        expected: models.Query{
+                                MinLevel: "warn",
+                                Filter:   "timeout",
+                                Limit:    100,
+                        },
+                },
+                {
+                        name:        "Minimum Level Split Operator",
+                        queryString: "source app1 level>= ERROR",
+                        expected: models.Query{
+                                Sources:  []string{"app1"},
+                                MinLevel: "error",
+                                Limit:    100,
+                        },
+                },
+                {
+                        name:        "Minimum Level Operator With Value",
+                        queryString: "LEVEL >=warning",
+                        expected: models.Query{
+                                MinLevel: "warn",
+                                Limit:    100,
+                        },
+                },
                 {
                         name:        "With Limit",
                         queryString: "source app1 limit 50",
@@ -397,7 +466,38 @@ func TestParseQuery(t *testing.T) {
                                         assert.Equal(t, v, result.FilterFields[k])
                                 }
                         }
+                        assert.Equal(t, tc.expected.MinLevel, result.MinLevel)
+                        if tc.expected.MinLevel != "" {
+                                assert.Empty(t, result.Levels)
+                        }
                         assert.Equal(t, tc.expected.Limit, result.Limit)
                 })
         }
+}
+
+func TestLQLParser(t *testing.T) {
+        parser := query.NewLQLParser()
+
+        testCases := []struct {
+                queryString string
+                minLevel    string
+                levels      []string
+                filter      string
+        }{
+                {queryString: "level>=warn timeout", minLevel: "warn", filter: "timeout"},
+                {queryString: "level >= warn timeout", minLevel: "warn", filter: "timeout"},
+                {queryString: "source app1 level>= ERROR", minLevel: "error"},
+                {queryString: "level error", levels: []string{"error"}},
+        }
+
+        for _, tc := range testCases {
+                t.Run(tc.queryString, func(t *testing.T) {
+                        result, err := parser.Parse(tc.queryString)
+                        require.NoError(t, err)
+
+                        assert.Equal(t, tc.minLevel, result.MinLevel)
+                        assert.Equal(t, tc.levels, result.Levels)
+                        assert.Equal(t, tc.filter, result.Filter)
+                })
+        }
 }
\ No newline at end of file
@@ -0,0 +1,179 @@
+package tests
+
+import (
+        "context"
+        "fmt"
+        "os"
+        "path/filepath"
+        "testing"
+        "time"
+
+        "github.com/stretchr/testify/assert"
+        "github.com/stretchr/testify/require"
+
+        "github.com/mariasu11/logstreamApp/pkg/queue"
+)
+
+func TestDiskQueue(t *testing.T) {
+        read := func(t *testing.T, q *queue.DiskQueue) queue.Record {
+                ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+                defer cancel()
+                record, err := q.Read(ctx)
+                require.NoError(t, err)
+                return record
+        }
+
+        t.Run("AppendReadAck", func(t *testing.T) {
+                q, err := queue.OpenDiskQueue(t.TempDir(), 0)
+                require.NoError(t, err)
+                defer q.Close()
+
+                for i := 0; i < 3; i++ {
+                        seq, err := q.Append([]byte(fmt.Sprintf("batch %d", i)))
+                        require.NoError(t, err)
+                        assert.Equal(t, uint64(i+1), seq)
+                }
+                for i := 0; i < 3; i++ {
+                        record := read(t, q)
+                        assert.Equal(t, fmt.Sprintf("batch %d", i), string(record.Data))
+                }
+                assert.Equal(t, 3, q.Len())
+
+                require.NoError(t, q.Ack(2))
+                assert.Equal(t, 2, q.Len())
+                require.NoError(t, q.Ack(1))
+                require.NoError(t, q.Ack(3))
+                assert.Equal(t, 0, q.Len())
+        })
+
+        t.Run("ReadWaits", func(t *testing.T) {
+                q, err := queue.OpenDiskQueue(t.TempDir(), 0)
+                require.NoError(t, err)
+                defer q.Close()
+
+                time.AfterFunc(20*time.Millisecond, func() { q.Append([]byte("late")) })
+                assert.Equal(t, "late", string(read(t, q).Data))
+
+                ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+                defer cancel()
+                _, err = q.Read(ctx)
+                assert.ErrorIs(t, err, context.DeadlineExceeded)
+        })
+
+        t.Run("ReplaysUnacknowledged", func(t *testing.T) {
+                dir := t.TempDir()
+                q, err := queue.OpenDiskQueue(dir, 0)
+                require.NoError(t, err)
+                q.WithSyncPolicy(queue.SyncAlways, 0)
+                for i := 1; i <= 4; i++ {
+                        _, err := q.Append([]byte(fmt.Sprintf("batch %d", i)))
+                        require.NoError(t, err)
+                        read(t, q)
+                }
+                // Batch 3 is acknowledged out of order, behind unacknowledged batch 2
+                require.NoError(t, q.Ack(1))
+                require.NoError(t, q.Ack(3))
+                require.NoError(t, q.Close())
+
+                q, err = queue.OpenDiskQueue(dir, 0)
+                require.NoError(t, err)
+                defer q.Close()
+                assert.Equal(t, 3, q.Len())
+                for _, want := range []string{"batch 2", "batch 3", "batch 4"} {
+                        assert.Equal(t, want, string(read(t, q).Data))
+                }
+
+                seq, err := q.Append([]byte("batch 5"))
+                require.NoError(t, err)
+                assert.Equal(t, uint64(5), seq)
+                assert.Equal(t, "batch 5", string(read(t, q).Data))
+        })
+
+        t.Run("TornTail", func(t *testing.T) {
+                dir := t.TempDir()
+                q, err := queue.OpenDiskQueue(dir, 0)
+                require.NoError(t, err)
+                _, err = q.Append([]byte("complete"))
+                require.NoError(t, err)
+                require.NoError(t, q.Close())
+
+                // A crash in the middle of a write leaves part of a record
+                segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+                require.NoError(t, err)
+                require.NotEmpty(t, segments)
+                file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+                require.NoError(t, err)
+                _, err = file.Write([]byte{0, 0, 0, 42, 1, 2, 3})
+                require.NoError(t, err)
+                require.NoError(t, file.Close())
+
+                q, err = queue.OpenDiskQueue(dir, 0)
+                require.NoError(t, err)
+                defer q.Close()
+                assert.Equal(t, 1, q.Len())
+                assert.Equal(t, "complete", string(read(t, q).Data))
+
+                _, err = q.Append([]byte("next"))
+                require.NoError(t, err)
+                assert.Equal(t, "next", string(read(t, q).Data))
+        })
+
+        t.Run("SizeCapAndSegments", func(t *testing.T) {
+                dir := t.TempDir()
+                // Records take 16 bytes of header plus 84 of payload
+                q, err := queue.OpenDiskQueue(dir, 500)
+                require.NoError(t, err)
+                defer q.Close()
+                q.WithSegmentSize(200)
+
+                payload := make([]byte, 84)
+                for i := 0; i < 5; i++ {
+                        _, err := q.Append(payload)
+                        require.NoError(t, err)
+                }
+                _, err = q.Append(payload)
+                assert.ErrorIs(t, err, queue.ErrFull)
+                assert.Equal(t, int64(500), q.Size())
+
+                segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+                require.NoError(t, err)
+                assert.Len(t, segments, 3)
+
+                // Acknowledging the first segment's records deletes it and frees room
+                for seq := uint64(1); seq <= 2; seq++ {
+                        read(t, q)
+                        require.NoError(t, q.Ack(seq))
+                }
+                segments, err = filepath.Glob(filepath.Join(dir, "*.seg"))
+                require.NoError(t, err)
+                assert.Len(t, segments, 2)
+                assert.Equal(t, int64(300), q.Size())
+                _, err = q.Append(payload)
+                assert.NoError(t, err)
+        })
+
+        t.Run("SizeCapBelowSegmentSize", func(t *testing.T) {
+                // With the default segment size, every record lands in the segment being written
+                q, err := queue.OpenDiskQueue(t.TempDir(), 1000)
+                require.NoError(t, err)
+                defer q.Close()
+
+                payload := make([]byte, 84)
+                for i := 0; i < 50; i++ {
+                        seq, err := q.Append(payload)
+                        require.NoError(t, err, "append %d", i)
+                        assert.Equal(t, seq, read(t, q).Seq)
+                        require.NoError(t, q.Ack(seq))
+                }
+                assert.Equal(t, 0, q.Len())
+                assert.LessOrEqual(t, q.Size(), int64(1000))
+
+                // Unacknowledged records still count against the cap
+                for i := 0; i < 10; i++ {
+                        _, err := q.Append(payload)
+                        require.NoError(t, err)
+                }
+                _, err = q.Append(payload)
+                assert.ErrorIs(t, err, queue.ErrFull)
+        })
+}
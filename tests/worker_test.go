@@ -0,0 +1,171 @@
+package tests
+
+import (
+        "context"
+        "errors"
+        "sync"
+        "sync/atomic"
+        "testing"
+        "time"
+
+        "github.com/stretchr/testify/assert"
+        "github.com/stretchr/testify/require"
+
+        "github.com/mariasu11/logstreamApp/pkg/worker"
+)
+
+func TestBatchProcessor(t *testing.T) {
+        // collect records the batches it is given
+        type collect struct {
+                mu      sync.Mutex
+                batches [][]string
+        }
+        record := func(c *collect) func(context.Context, []string) error {
+                return func(ctx context.Context, batch []string) error {
+                        c.mu.Lock()
+                        defer c.mu.Unlock()
+                        c.batches = append(c.batches, append([]string(nil), batch...))
+                        return nil
+                }
+        }
+        batches := func(c *collect) [][]string {
+                c.mu.Lock()
+                defer c.mu.Unlock()
+                return append([][]string(nil), c.batches...)
+        }
+
+        t.Run("SizeAndBytes", func(t *testing.T) {
+                c := &collect{}
+                b := worker.NewBatchProcessor(nil, 3, 0, record(c)).
+                        WithMaxBytes(6, func(item string) int { return len(item) })
+
+                for _, item := range []string{"a", "b", "c", "dddd", "eeee", "f"} {
+                        require.NoError(t, b.Add(context.Background(), item))
+                }
+                assert.Equal(t, [][]string{{"a", "b", "c"}, {"dddd", "eeee"}}, batches(c))
+
+                require.NoError(t, b.Flush(context.Background()))
+                assert.Equal(t, [][]string{{"a", "b", "c"}, {"dddd", "eeee"}, {"f"}}, batches(c))
+        })
+
+        t.Run("Interval", func(t *testing.T) {
+                c := &collect{}
+                b := worker.NewBatchProcessor(nil, 100, 20*time.Millisecond, record(c))
+
+                require.NoError(t, b.Add(context.Background(), "a"))
+                require.NoError(t, b.Add(context.Background(), "b"))
+                assert.Empty(t, batches(c))
+                assert.Eventually(t, func() bool {
+                        return len(batches(c)) == 1
+                }, time.Second, 5*time.Millisecond)
+                assert.Equal(t, []string{"a", "b"}, batches(c)[0])
+        })
+
+        t.Run("RetryAndDeadLetter", func(t *testing.T) {
+                var attempts atomic.Int32
+                var dead [][]int
+                b := worker.NewBatchProcessor(nil, 2, 0, func(ctx context.Context, batch []int) error {
+                        attempts.Add(1)
+                        return errors.New("unavailable")
+                }).WithRetry(2, time.Millisecond).WithDeadLetter(func(ctx context.Context, batch []int, err error) {
+                        dead = append(dead, batch)
+                })
+
+                require.NoError(t, b.Add(context.Background(), 1))
+                require.NoError(t, b.Add(context.Background(), 2))
+                assert.Equal(t, int32(3), attempts.Load())
+                assert.Equal(t, [][]int{{1, 2}}, dead)
+                assert.NoError(t, b.Flush(context.Background()))
+        })
+
+        t.Run("FlushReportsFailures", func(t *testing.T) {
+                failure := errors.New("unavailable")
+                b := worker.NewBatchProcessor(nil, 10, 0, func(ctx context.Context, batch []int) error {
+                        return failure
+                })
+
+                require.NoError(t, b.Add(context.Background(), 1))
+                assert.ErrorIs(t, b.Flush(context.Background()), failure)
+                assert.NoError(t, b.Flush(context.Background()))
+
+                require.NoError(t, b.Add(context.Background(), 2))
+                assert.ErrorIs(t, b.Close(context.Background()), failure)
+                assert.ErrorIs(t, b.Add(context.Background(), 3), worker.ErrBatchProcessorClosed)
+        })
+
+        t.Run("ConcurrentAdd", func(t *testing.T) {
+                // Slow and failing batches filled by many goroutines at once are processed in
+                // order without the goroutines waiting on each other forever
+                var mu sync.Mutex
+                var processed []int
+                var calls atomic.Int32
+                b := worker.NewBatchProcessor(nil, 5, time.Millisecond, func(ctx context.Context, batch []int) error {
+                        time.Sleep(2 * time.Millisecond)
+                        if calls.Add(1)%3 == 0 {
+                                return errors.New("unavailable")
+                        }
+                        mu.Lock()
+                        processed = append(processed, batch...)
+                        mu.Unlock()
+                        return nil
+                }).WithRetry(1, time.Millisecond).WithDeadLetter(func(ctx context.Context, batch []int, err error) {})
+
+                var wg sync.WaitGroup
+                for g := 0; g < 8; g++ {
+                        wg.Add(1)
+                        go func() {
+                                defer wg.Done()
+                                for i := 0; i < 50; i++ {
+                                        assert.NoError(t, b.Add(context.Background(), i))
+                                }
+                        }()
+                }
+                added := make(chan struct{})
+                go func() {
+                        wg.Wait()
+                        close(added)
+                }()
+                select {
+                case <-added:
+                case <-time.After(10 * time.Second):
+                        t.Fatal("adding to the batch processor deadlocked")
+                }
+
+                ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+                defer cancel()
+                require.NoError(t, b.Close(ctx))
+                mu.Lock()
+                defer mu.Unlock()
+                assert.NotEmpty(t, processed)
+        })
+
+        t.Run("PoolFlushWaits", func(t *testing.T) {
+                ctx, cancel := context.WithCancel(context.Background())
+                defer cancel()
+                pool := worker.NewPool(2)
+                pool.Start(ctx)
+                defer pool.Stop(context.Background())
+
+                var processed atomic.Int32
+                b := worker.NewBatchProcessor(pool, 5, 0, func(ctx context.Context, batch []int) error {
+                        time.Sleep(20 * time.Millisecond)
+                        processed.Add(int32(len(batch)))
+                        return nil
+                })
+                for i := 0; i < 23; i++ {
+                        require.NoError(t, b.Add(ctx, i))
+                }
+                require.NoError(t, b.Close(ctx))
+                assert.Equal(t, int32(23), processed.Load())
+
+                // A context ending first stops the wait
+                b = worker.NewBatchProcessor(pool, 1, 0, func(ctx context.Context, batch []int) error {
+                        time.Sleep(200 * time.Millisecond)
+                        return nil
+                })
+                require.NoError(t, b.Add(ctx, 1))
+                short, stop := context.WithTimeout(ctx, 10*time.Millisecond)
+                defer stop()
+                assert.ErrorIs(t, b.Flush(short), context.DeadlineExceeded)
+        })
+}